@@ -0,0 +1,393 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+	"github.com/cadicallegari/user/pkg/xmail"
+)
+
+// The purposes of the verification tokens, a token is only used for its purpose
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailChange       = "email_change"
+)
+
+type AccountConfig struct {
+	// VerificationURL is the page the verification links point to,
+	// the token is added as the token query param
+	VerificationURL string        `envconfig:"VERIFICATION_URL" default:"http://localhost:8080/verify-email"`
+	VerificationTTL time.Duration `envconfig:"VERIFICATION_TTL" default:"24h"`
+
+	// PasswordResetURL is the page the password reset links point to
+	PasswordResetURL string        `envconfig:"PASSWORD_RESET_URL" default:"http://localhost:8080/reset-password"`
+	PasswordResetTTL time.Duration `envconfig:"PASSWORD_RESET_TTL" default:"1h"`
+
+	// EmailChangeURL is the page the links confirming a new email point to
+	EmailChangeURL string        `envconfig:"EMAIL_CHANGE_URL" default:"http://localhost:8080/confirm-email"`
+	EmailChangeTTL time.Duration `envconfig:"EMAIL_CHANGE_TTL" default:"24h"`
+}
+
+func (cfg *AccountConfig) setDefault() {
+	if cfg.VerificationURL == "" {
+		cfg.VerificationURL = "http://localhost:8080/verify-email"
+	}
+	if cfg.VerificationTTL == 0 {
+		cfg.VerificationTTL = 24 * time.Hour
+	}
+	if cfg.PasswordResetURL == "" {
+		cfg.PasswordResetURL = "http://localhost:8080/reset-password"
+	}
+	if cfg.PasswordResetTTL == 0 {
+		cfg.PasswordResetTTL = time.Hour
+	}
+	if cfg.EmailChangeURL == "" {
+		cfg.EmailChangeURL = "http://localhost:8080/confirm-email"
+	}
+	if cfg.EmailChangeTTL == 0 {
+		cfg.EmailChangeTTL = 24 * time.Hour
+	}
+}
+
+// VerificationToken is a single use token sent by email, only its hash is stored
+type VerificationToken struct {
+	ID      string `json:"id"`
+	UserID  string `json:"user_id" db:"user_id"`
+	Purpose string `json:"purpose"`
+	// Email is the address the token was sent to
+	Email     string     `json:"email"`
+	Hash      string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+}
+
+//go:generate mockgen -package mock -mock_names Mailer=Mailer -destination mock/mailer.go github.com/cadicallegari/user/pkg/xmail Mailer
+
+// AccountService runs the flows confirmed by email
+type AccountService interface {
+	// SendVerification sends a link confirming the email of the user,
+	// it returns ErrInvalid when the email is already verified
+	SendVerification(context.Context, *User) error
+	// VerifyEmail confirms the email the token was sent to, it returns
+	// ErrInvalid for unknown, used and expired tokens
+	VerifyEmail(_ context.Context, token string) (*User, error)
+
+	// ForgotPassword sends a password reset link to the user of the email in background,
+	// so neither the result nor its timing reveal if the email is registered, the
+	// failures are only logged. It returns ErrInvalid for empty emails
+	ForgotPassword(_ context.Context, email string) error
+	// ResetPassword replaces the password of the user the token was sent to,
+	// revoking the refresh tokens of the user. It returns ErrInvalid for unknown,
+	// used and expired tokens, and a PasswordError for passwords breaking the policy
+	ResetPassword(_ context.Context, token, password string) error
+
+	// RequestEmailChange sends a link confirming the new email to it, and a notice
+	// to the current email. It returns ErrInvalid for empty or unchanged emails
+	// and ErrAlreadyExists when the email is taken
+	RequestEmailChange(_ context.Context, _ *User, email string) error
+	// ConfirmEmailChange replaces the email of the user by the email the token was
+	// sent to, it returns ErrInvalid for unknown, used and expired tokens and
+	// ErrAlreadyExists when the email was taken after the request
+	ConfirmEmailChange(_ context.Context, token string) (*User, error)
+}
+
+type accountService struct {
+	users   Service
+	storage Storage
+	tokens  TokenStorage
+	mailer  xmail.Mailer
+
+	cfg *AccountConfig
+}
+
+// NewAccountService creates the email flows, the tokens are kept in
+// tokens and the links are sent by mailer. The new passwords are encoded by users
+func NewAccountService(users Service, storage Storage, tokens TokenStorage, mailer xmail.Mailer, cfg *AccountConfig) *accountService {
+	if cfg == nil {
+		cfg = new(AccountConfig)
+	}
+	cfg.setDefault()
+
+	return &accountService{
+		users:   users,
+		storage: storage,
+		tokens:  tokens,
+		mailer:  mailer,
+		cfg:     cfg,
+	}
+}
+
+// newToken saves a verification token of the purpose sent to email, returning it
+func (s *accountService) newToken(ctx context.Context, usr *User, purpose, email string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := TimeNow()
+
+	err = s.tokens.SaveVerificationToken(ctx, &VerificationToken{
+		ID:        uuid.NewString(),
+		UserID:    usr.ID,
+		Purpose:   purpose,
+		Email:     email,
+		Hash:      hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// useToken returns the valid token of the purpose, marking it as used
+func (s *accountService) useToken(ctx context.Context, token, purpose string) (*VerificationToken, error) {
+	vt, err := s.tokens.UseVerificationToken(ctx, hashToken(token), purpose)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !TimeNow().Before(vt.ExpiresAt) {
+		return nil, ErrInvalid
+	}
+
+	return vt, nil
+}
+
+// link returns the page URL with the token query param
+func link(page, token string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+func (s *accountService) SendVerification(ctx context.Context, usr *User) error {
+	if usr.EmailVerifiedAt != nil {
+		return ErrInvalid
+	}
+
+	token, err := s.newToken(ctx, usr, PurposeEmailVerification, usr.Email, s.cfg.VerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	l, err := link(s.cfg.VerificationURL, token)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &xmail.Message{
+		To:      usr.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email by opening the link below, it expires in %s.\n\n%s\n",
+			usr.FirstName, s.cfg.VerificationTTL, l,
+		),
+	})
+}
+
+func (s *accountService) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	vt, err := s.useToken(ctx, token, PurposeEmailVerification)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := s.storage.VerifyEmail(ctx, vt.UserID, vt.Email)
+	if errors.Is(err, ErrNotFound) {
+		// the user was deleted or changed the email
+		return nil, ErrInvalid
+	}
+
+	return usr, err
+}
+
+func (s *accountService) ForgotPassword(ctx context.Context, email string) error {
+	email = normalizeEmail(email)
+	if email == "" {
+		return ErrInvalid
+	}
+
+	// the request may end before the link is sent, only its logger is kept
+	go s.forgotPassword(xlogger.SetLogger(context.Background(), xlogger.Logger(ctx)), email)
+
+	return nil
+}
+
+// forgotPassword sends the password reset link when the email is registered,
+// the failures are only logged, they would reveal the email is registered
+func (s *accountService) forgotPassword(ctx context.Context, email string) {
+	l, err := s.storage.List(ctx, &ListOptions{Email: email})
+	if err != nil {
+		xlogger.Logger(ctx).WithError(err).Error("unable to fetch user")
+		return
+	}
+
+	if len(l.Users) == 0 {
+		return
+	}
+
+	err = s.sendPasswordReset(ctx, l.Users[0])
+	if err != nil {
+		xlogger.Logger(ctx).WithError(err).WithField("user_id", l.Users[0].ID).Error("unable to send password reset")
+	}
+}
+
+func (s *accountService) sendPasswordReset(ctx context.Context, usr *User) error {
+	token, err := s.newToken(ctx, usr, PurposePasswordReset, usr.Email, s.cfg.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	l, err := link(s.cfg.PasswordResetURL, token)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, &xmail.Message{
+		To:      usr.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA password reset was requested for your account, choose a new password by opening the link below, it expires in %s.\n\n%s\n\nIf you did not request it, you can ignore this email.\n",
+			usr.FirstName, s.cfg.PasswordResetTTL, l,
+		),
+	})
+}
+
+func (s *accountService) ResetPassword(ctx context.Context, token, password string) error {
+	vt, err := s.tokens.GetVerificationToken(ctx, hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if vt.Purpose != PurposePasswordReset || vt.UsedAt != nil || !TimeNow().Before(vt.ExpiresAt) {
+		return ErrInvalid
+	}
+
+	usr, err := s.storage.Get(ctx, vt.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	if usr.Email != vt.Email {
+		// the token was sent to a previous email
+		return ErrInvalid
+	}
+
+	// the password is checked before using the token,
+	// so a password breaking the policy can be fixed
+	encoded, err := s.users.EncodePassword(ctx, usr, password)
+	if err != nil {
+		return err
+	}
+
+	// the token is used in the same transaction setting the password and closing the
+	// sessions opened with the previous one, so a concurrent reset with the same token
+	// fails, and a failed reset can be retried with it
+	err = s.storage.ResetPassword(ctx, usr.ID, hashToken(token), encoded)
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalid
+	}
+
+	return err
+}
+
+func (s *accountService) RequestEmailChange(ctx context.Context, usr *User, email string) error {
+	email = normalizeEmail(email)
+	if strings.EqualFold(email, usr.Email) {
+		return ErrInvalid
+	}
+
+	verr := new(ValidationError)
+	validateEmail(verr, email)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	existing, err := s.storage.List(ctx, &ListOptions{Email: email})
+	if err != nil {
+		return err
+	}
+
+	if existing.Total > 0 {
+		return ErrAlreadyExists
+	}
+
+	token, err := s.newToken(ctx, usr, PurposeEmailChange, email, s.cfg.EmailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	l, err := link(s.cfg.EmailChangeURL, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, &xmail.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm this is the new email of your account by opening the link below, it expires in %s.\n\n%s\n",
+			usr.FirstName, s.cfg.EmailChangeTTL, l,
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the notice lets the owner of the current email react to a change not requested by them
+	err = s.mailer.Send(ctx, &xmail.Message{
+		To:      usr.Email,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA change of the email of your account to %s was requested, it is applied once the new email is confirmed.\n\nIf you did not request it, please reset your password.\n",
+			usr.FirstName, email,
+		),
+	})
+	if err != nil {
+		xlogger.Logger(ctx).WithError(err).WithField("user_id", usr.ID).Error("unable to send email change notice")
+	}
+
+	return nil
+}
+
+func (s *accountService) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	vt, err := s.useToken(ctx, token, PurposeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := s.storage.ChangeEmail(ctx, vt.UserID, vt.Email)
+	if errors.Is(err, ErrNotFound) {
+		// the user was deleted
+		return nil, ErrInvalid
+	}
+
+	return usr, err
+}
@@ -0,0 +1,494 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+	"github.com/cadicallegari/user/pkg/xlogger"
+	"github.com/cadicallegari/user/pkg/xmail"
+)
+
+// tokenFromLink returns the token of the link in the message body
+func tokenFromLink(t *testing.T, body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "http") {
+			u, err := url.Parse(line)
+			require.NoError(t, err)
+			return u.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("no link in %q", body)
+	return ""
+}
+
+func Test_SendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", FirstName: "Alice", Email: "alice@mail.com"}
+
+	var saved *user.VerificationToken
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, vt *user.VerificationToken) error {
+			saved = vt
+			return nil
+		})
+
+	mockMailer := mock.NewMailer(ctrl)
+	mockMailer.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, msg *xmail.Message) error {
+			require.Equal(t, usr.Email, msg.To)
+			require.True(t, strings.HasPrefix(msg.Body, "Hi Alice,"))
+
+			// only the hash of the sent token is stored
+			token := tokenFromLink(t, msg.Body)
+			require.NotEmpty(t, token)
+			require.NotEqual(t, token, saved.Hash)
+			return nil
+		})
+
+	mockStorage := mock.NewStorage(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mockMailer, &user.AccountConfig{
+		VerificationURL: "https://example.com/verify?lang=en",
+		VerificationTTL: time.Hour,
+	})
+
+	err := svc.SendVerification(context.TODO(), usr)
+	require.NoError(t, err)
+	require.Equal(t, usr.ID, saved.UserID)
+	require.Equal(t, usr.Email, saved.Email)
+	require.Equal(t, user.PurposeEmailVerification, saved.Purpose)
+	require.Equal(t, time.Hour, saved.ExpiresAt.Sub(saved.CreatedAt))
+}
+
+func Test_SendVerification_AlreadyVerified(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	usr := &user.User{ID: "id", Email: "alice@mail.com", EmailVerifiedAt: &now}
+
+	mockStorage := mock.NewStorage(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mock.NewTokenStorage(ctrl), mock.NewMailer(ctrl), nil)
+
+	err := svc.SendVerification(context.TODO(), usr)
+	require.ErrorIs(t, err, user.ErrInvalid)
+}
+
+func Test_VerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+	verified := &user.User{ID: "id", Email: "alice@mail.com", EmailVerifiedAt: &now}
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(&user.VerificationToken{
+			UserID:    verified.ID,
+			Email:     verified.Email,
+			ExpiresAt: now.Add(time.Hour),
+		}, nil)
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		VerifyEmail(gomock.Any(), verified.ID, verified.Email).
+		Return(verified, nil)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mock.NewMailer(ctrl), nil)
+
+	got, err := svc.VerifyEmail(context.TODO(), "token")
+	require.NoError(t, err)
+	require.Equal(t, verified, got)
+}
+
+func Test_VerifyEmail_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockStorage := mock.NewStorage(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mock.NewMailer(ctrl), nil)
+
+	// unknown or used
+	mockTokens.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(nil, user.ErrNotFound)
+
+	_, err := svc.VerifyEmail(context.TODO(), "unknown")
+	require.ErrorIs(t, err, user.ErrInvalid)
+
+	// expired
+	mockTokens.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(&user.VerificationToken{UserID: "id", ExpiresAt: time.Now().Add(-time.Second)}, nil)
+
+	_, err = svc.VerifyEmail(context.TODO(), "expired")
+	require.ErrorIs(t, err, user.ErrInvalid)
+
+	// the email changed after the token was sent
+	mockTokens.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(&user.VerificationToken{UserID: "id", Email: "old@mail.com", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	mockStorage.EXPECT().
+		VerifyEmail(gomock.Any(), "id", "old@mail.com").
+		Return(nil, user.ErrNotFound)
+
+	_, err = svc.VerifyEmail(context.TODO(), "changed")
+	require.ErrorIs(t, err, user.ErrInvalid)
+}
+
+// wait fails the test when done is not closed in 5 seconds,
+// e.g. by the mocks called in background
+func wait(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the background call")
+	}
+}
+
+func Test_ForgotPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", FirstName: "Alice", Email: "alice@mail.com"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Users: []*user.User{usr}, Total: 1}, nil)
+
+	var saved *user.VerificationToken
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, vt *user.VerificationToken) error {
+			saved = vt
+			return nil
+		})
+
+	sent := make(chan struct{})
+
+	mockMailer := mock.NewMailer(ctrl)
+	mockMailer.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, msg *xmail.Message) error {
+			defer close(sent)
+			require.Equal(t, usr.Email, msg.To)
+			require.Contains(t, msg.Body, "https://example.com/reset?token=")
+			return nil
+		})
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mockMailer, &user.AccountConfig{
+		PasswordResetURL: "https://example.com/reset",
+	})
+
+	err := svc.ForgotPassword(context.TODO(), usr.Email)
+	require.NoError(t, err)
+
+	// the link is sent in background
+	wait(t, sent)
+	require.Equal(t, user.PurposePasswordReset, saved.Purpose)
+	require.Equal(t, usr.Email, saved.Email)
+	require.Equal(t, time.Hour, saved.ExpiresAt.Sub(saved.CreatedAt))
+}
+
+func Test_ForgotPassword_DoesNotRevealEmails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Email: "alice@mail.com"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockMailer := mock.NewMailer(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mockMailer, nil)
+
+	// unknown email, nothing is sent
+	looked := make(chan struct{})
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "unknown@mail.com"}).
+		DoAndReturn(func(context.Context, *user.ListOptions) (*user.List, error) {
+			close(looked)
+			return &user.List{}, nil
+		})
+
+	err := svc.ForgotPassword(context.TODO(), "unknown@mail.com")
+	require.NoError(t, err)
+	wait(t, looked)
+
+	// the sending failures are only logged
+	ctx := xlogger.SetLogger(context.TODO(), xlogger.New(nil).WithFields(nil))
+
+	sent := make(chan struct{})
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Users: []*user.User{usr}, Total: 1}, nil)
+	mockTokens.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+	mockMailer.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, *xmail.Message) error {
+			close(sent)
+			return errors.New("connection refused")
+		})
+
+	err = svc.ForgotPassword(ctx, usr.Email)
+	require.NoError(t, err)
+	wait(t, sent)
+
+	// the lookup failures as well
+	looked = make(chan struct{})
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		DoAndReturn(func(context.Context, *user.ListOptions) (*user.List, error) {
+			close(looked)
+			return nil, errors.New("connection refused")
+		})
+
+	err = svc.ForgotPassword(ctx, usr.Email)
+	require.NoError(t, err)
+	wait(t, looked)
+}
+
+func Test_ResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Email: "alice@mail.com"}
+	vt := &user.VerificationToken{
+		UserID:    usr.ID,
+		Purpose:   user.PurposePasswordReset,
+		Email:     usr.Email,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockTokens := mock.NewTokenStorage(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mock.NewMailer(ctrl), nil)
+
+	mockTokens.EXPECT().
+		GetVerificationToken(gomock.Any(), gomock.Any()).
+		Return(vt, nil).
+		Times(3)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), usr.ID).
+		Return(usr, nil).
+		Times(3)
+
+	// the password breaking the policy keeps the token
+	err := svc.ResetPassword(context.TODO(), "token", "short")
+	var perr *user.PasswordError
+	require.ErrorAs(t, err, &perr)
+
+	// the token used meanwhile by a concurrent reset
+	mockStorage.EXPECT().
+		ResetPassword(gomock.Any(), usr.ID, gomock.Any(), gomock.Any()).
+		Return(user.ErrNotFound)
+
+	err = svc.ResetPassword(context.TODO(), "token", "correct horse")
+	require.ErrorIs(t, err, user.ErrInvalid)
+
+	mockStorage.EXPECT().
+		ResetPassword(gomock.Any(), usr.ID, gomock.Not("token"), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, _, encoded string) error {
+			require.NoError(t, bcrypt.CompareHashAndPassword([]byte(encoded), []byte("correct horse")))
+			return nil
+		})
+
+	err = svc.ResetPassword(context.TODO(), "token", "correct horse")
+	require.NoError(t, err)
+}
+
+func Test_ResetPassword_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now()
+
+	tcases := []struct {
+		name  string
+		token *user.VerificationToken
+		email string
+	}{
+		{
+			name:  "other purpose",
+			token: &user.VerificationToken{Purpose: user.PurposeEmailVerification, ExpiresAt: now.Add(time.Hour)},
+		},
+		{
+			name:  "used",
+			token: &user.VerificationToken{Purpose: user.PurposePasswordReset, ExpiresAt: now.Add(time.Hour), UsedAt: &now},
+		},
+		{
+			name:  "expired",
+			token: &user.VerificationToken{Purpose: user.PurposePasswordReset, ExpiresAt: now},
+		},
+		{
+			name:  "email changed",
+			token: &user.VerificationToken{Purpose: user.PurposePasswordReset, ExpiresAt: now.Add(time.Hour), Email: "old@mail.com"},
+			email: "new@mail.com",
+		},
+	}
+
+	for _, tc := range tcases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStorage := mock.NewStorage(ctrl)
+			mockTokens := mock.NewTokenStorage(ctrl)
+
+			tc.token.UserID = "id"
+			mockTokens.EXPECT().
+				GetVerificationToken(gomock.Any(), gomock.Any()).
+				Return(tc.token, nil)
+			if tc.email != "" {
+				mockStorage.EXPECT().
+					Get(gomock.Any(), "id").
+					Return(&user.User{ID: "id", Email: tc.email}, nil)
+			}
+
+			svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mock.NewMailer(ctrl), nil)
+
+			err := svc.ResetPassword(context.TODO(), "token", "correct horse")
+			require.ErrorIs(t, err, user.ErrInvalid)
+		})
+	}
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		GetVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil, user.ErrNotFound)
+
+	svc := user.NewAccountService(user.NewService(mock.NewStorage(ctrl), 4), mock.NewStorage(ctrl), mockTokens, mock.NewMailer(ctrl), nil)
+
+	err := svc.ResetPassword(context.TODO(), "unknown", "correct horse")
+	require.ErrorIs(t, err, user.ErrInvalid)
+}
+
+func Test_RequestEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", FirstName: "Alice", Email: "old@mail.com"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "new@mail.com"}).
+		Return(&user.List{}, nil)
+
+	var saved *user.VerificationToken
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, vt *user.VerificationToken) error {
+			saved = vt
+			return nil
+		})
+
+	var sent []*xmail.Message
+
+	mockMailer := mock.NewMailer(ctrl)
+	mockMailer.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, msg *xmail.Message) error {
+			sent = append(sent, msg)
+			return nil
+		}).
+		Times(2)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mockMailer, nil)
+
+	err := svc.RequestEmailChange(context.TODO(), usr, "new@mail.com")
+	require.NoError(t, err)
+
+	require.Equal(t, user.PurposeEmailChange, saved.Purpose)
+	require.Equal(t, "new@mail.com", saved.Email)
+
+	// the confirmation to the new email and the notice without link to the current one
+	require.Len(t, sent, 2)
+	require.Equal(t, "new@mail.com", sent[0].To)
+	require.NotEmpty(t, tokenFromLink(t, sent[0].Body))
+	require.Equal(t, usr.Email, sent[1].To)
+	require.Contains(t, sent[1].Body, "new@mail.com")
+	require.NotContains(t, sent[1].Body, "token=")
+}
+
+func Test_RequestEmailChange_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Email: "old@mail.com"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mock.NewTokenStorage(ctrl), mock.NewMailer(ctrl), nil)
+
+	for _, email := range []string{"", "OLD@mail.com", "New <new@mail.com>", "new"} {
+		err := svc.RequestEmailChange(context.TODO(), usr, email)
+		require.ErrorIs(t, err, user.ErrInvalid, email)
+	}
+
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "taken@mail.com"}).
+		Return(&user.List{Users: []*user.User{{ID: "other"}}, Total: 1}, nil)
+
+	err := svc.RequestEmailChange(context.TODO(), usr, " Taken@Mail.com")
+	require.ErrorIs(t, err, user.ErrAlreadyExists)
+}
+
+func Test_ConfirmEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	changed := &user.User{ID: "id", Email: "new@mail.com"}
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockStorage := mock.NewStorage(ctrl)
+
+	svc := user.NewAccountService(user.NewService(mockStorage, 4), mockStorage, mockTokens, mock.NewMailer(ctrl), nil)
+
+	mockTokens.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailChange).
+		Return(&user.VerificationToken{UserID: changed.ID, Email: changed.Email, ExpiresAt: time.Now().Add(time.Hour)}, nil).
+		Times(2)
+
+	mockStorage.EXPECT().
+		ChangeEmail(gomock.Any(), changed.ID, changed.Email).
+		Return(changed, nil)
+
+	got, err := svc.ConfirmEmailChange(context.TODO(), "token")
+	require.NoError(t, err)
+	require.Equal(t, changed, got)
+
+	// the email was taken after the request
+	mockStorage.EXPECT().
+		ChangeEmail(gomock.Any(), changed.ID, changed.Email).
+		Return(nil, user.ErrAlreadyExists)
+
+	_, err = svc.ConfirmEmailChange(context.TODO(), "token")
+	require.ErrorIs(t, err, user.ErrAlreadyExists)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+
 	"github.com/go-chi/chi/v5"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
@@ -9,10 +11,17 @@ import (
 	"github.com/cadicallegari/user/http"
 	"github.com/cadicallegari/user/mem"
 	"github.com/cadicallegari/user/mysql"
+	"github.com/cadicallegari/user/pkg/xcrypto"
 	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xmysql"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xpostgres"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xsqlite"
 	"github.com/cadicallegari/user/pkg/xhttp"
 	"github.com/cadicallegari/user/pkg/xlogger"
+	"github.com/cadicallegari/user/pkg/xmail"
+	"github.com/cadicallegari/user/pkg/xpwned"
 	"github.com/cadicallegari/user/pkg/xsignal"
+	"github.com/cadicallegari/user/postgres"
+	"github.com/cadicallegari/user/sqlite"
 )
 
 var (
@@ -23,11 +32,26 @@ var (
 )
 
 var cfg struct {
-	Logger xlogger.Config     `envconfig:"LOG"`
-	HTTP   xhttp.ServerConfig `envconfig:"HTTP"`
-	MySQL  xmysql.Config      `envconfig:"MYSQL"`
+	Logger    xlogger.Config       `envconfig:"LOG"`
+	HTTP      xhttp.ServerConfig   `envconfig:"HTTP"`
+	MySQL     xmysql.Config        `envconfig:"MYSQL"`
+	Postgres  xpostgres.Config     `envconfig:"POSTGRES"`
+	SQLite    xsqlite.Config       `envconfig:"SQLITE"`
+	Relay     user.RelayConfig     `envconfig:"RELAY"`
+	Purge     user.PurgeConfig     `envconfig:"PURGE"`
+	Token     user.TokenConfig     `envconfig:"TOKEN"`
+	Auth      http.AuthConfig      `envconfig:"AUTH"`
+	Users     http.UserConfig      `envconfig:"USERS"`
+	Password  user.PasswordConfig  `envconfig:"PASSWORD"`
+	Hasher    user.HasherConfig    `envconfig:"PASSWORD_HASH"`
+	Account   user.AccountConfig   `envconfig:"ACCOUNT"`
+	Lockout   user.LockoutConfig   `envconfig:"LOCKOUT"`
+	TwoFactor user.TwoFactorConfig `envconfig:"TWO_FACTOR"`
+	Mail      xmail.Config         `envconfig:"MAIL"`
 
-	PasswordGenerationCost int `envconfig:"PASSWORD_GENERATION_COST" default:"14"`
+	// Storage selects the user storage, mysql, postgres, sqlite or memory
+	Storage                string `envconfig:"STORAGE" default:"mysql"`
+	PasswordGenerationCost int    `envconfig:"PASSWORD_GENERATION_COST" default:"14"`
 }
 
 func main() {
@@ -37,24 +61,204 @@ func main() {
 		logrus.Fields{"tag": tag, "git_commit": gitCommit},
 	)
 
-	cfg.MySQL.Logger = log
+	var (
+		storage user.Storage
+		outbox  user.Outbox
+		tokens  user.TokenStorage
+		// the login attempts are kept in memory unless the storage has a table for them
+		attempts user.AttemptStorage = mem.NewAttemptStorage()
 
-	db, err := xmysql.Connect(&cfg.MySQL)
-	if err != nil {
-		log.WithError(err).
-			Error("unable to connect to database")
+		twoFactors user.TwoFactorStorage
+		cipher     *xcrypto.Cipher
+	)
+
+	// the TOTP secrets are encrypted at rest by the SQL storages
+	if cfg.Storage != "memory" && cfg.TwoFactor.EncryptionKey != "" {
+		var err error
+
+		cipher, err = xcrypto.NewCipher(cfg.TwoFactor.EncryptionKey)
+		if err != nil {
+			log.WithError(err).Error("invalid two factor encryption key")
+			return
+		}
+	}
+
+	switch cfg.Storage {
+	case "memory":
+		memOutbox := mem.NewOutbox()
+		memTokens := mem.NewTokenStorage()
+		memTwoFactors := mem.NewTwoFactorStorage()
+		memStorage := mem.NewStorage(memOutbox)
+		memStorage.Cascade(memTokens, memTwoFactors)
+
+		storage = memStorage
+		outbox = memOutbox
+		tokens = memTokens
+		twoFactors = memTwoFactors
+
+		log.Warn("using in memory storage, the data is lost on restart")
+
+	case "mysql":
+		cfg.MySQL.Logger = log
+
+		db, err := xmysql.Connect(&cfg.MySQL)
+		if err != nil {
+			log.WithError(err).
+				Error("unable to connect to database")
+			return
+		}
+		defer db.Close()
+
+		storage = mysql.NewStorage(db)
+		outbox = mysql.NewOutbox(db)
+		tokens = mysql.NewTokenStorage(db)
+		twoFactors = mysql.NewTwoFactorStorage(db, cipher)
+		attempts = mysql.NewAttemptStorage(db)
+
+	case "postgres":
+		cfg.Postgres.Logger = log
+
+		db, err := xpostgres.Connect(&cfg.Postgres)
+		if err != nil {
+			log.WithError(err).
+				Error("unable to connect to database")
+			return
+		}
+		defer db.Close()
+
+		storage = postgres.NewStorage(db)
+		outbox = postgres.NewOutbox(db)
+		tokens = postgres.NewTokenStorage(db)
+		twoFactors = postgres.NewTwoFactorStorage(db, cipher)
+
+		log.Warn("the postgres storage keeps the login attempts in memory, with several replicas each one counts its own failures")
+
+	case "sqlite":
+		cfg.SQLite.Logger = log
+
+		db, err := xsqlite.Connect(&cfg.SQLite)
+		if err != nil {
+			log.WithError(err).
+				Error("unable to connect to database")
+			return
+		}
+		defer db.Close()
+
+		storage = sqlite.NewStorage(db)
+		outbox = sqlite.NewOutbox(db)
+		tokens = sqlite.NewTokenStorage(db)
+		twoFactors = sqlite.NewTwoFactorStorage(db, cipher)
+
+		log.Warn("the sqlite storage keeps the login attempts in memory, with several replicas each one counts its own failures")
+
+	default:
+		log.WithField("storage", cfg.Storage).Error("unknown storage")
 		return
 	}
-	defer db.Close()
 
-	storage := mysql.NewStorage(db)
+	// without the key the two-factor is disabled, unless some users have it
+	// enabled, they would log in with the password only
+	if cfg.Storage != "memory" && cipher == nil {
+		n, err := twoFactors.CountTwoFactors(context.Background())
+		if err != nil {
+			log.WithError(err).Error("unable to count two factors")
+			return
+		}
+		if n > 0 {
+			log.WithField("users", n).
+				Error("USER_TWO_FACTOR_ENCRYPTION_KEY is not set, but users have the two-factor enabled")
+			return
+		}
+
+		log.Warn("USER_TWO_FACTOR_ENCRYPTION_KEY is not set, the two-factor authentication is disabled")
+		twoFactors = nil
+	}
+
 	eventSvc := mem.NewEventService()
 
-	userSrv := user.NewService(storage, eventSvc, cfg.PasswordGenerationCost)
+	var breached user.BreachedPasswords
+	if cfg.Password.BreachedFile != "" {
+		list, err := xpwned.Open(cfg.Password.BreachedFile)
+		if err != nil {
+			log.WithError(err).Error("unable to open breached passwords file")
+			return
+		}
+		defer list.Close()
+
+		breached = list
+	}
+
+	cfg.Hasher.BcryptCost = cfg.PasswordGenerationCost
+
+	hasher, err := user.NewPasswordHasher(&cfg.Hasher)
+	if err != nil {
+		log.WithError(err).Error("unable to create password hasher")
+		return
+	}
+
+	var twoFactorSrv user.TwoFactorService
+	if twoFactors != nil {
+		twoFactorSrv = user.NewTwoFactorService(twoFactors, &cfg.TwoFactor)
+	}
+
+	lockout := user.NewLockout(attempts, &cfg.Lockout)
+
+	userSrv := user.NewService(
+		storage,
+		cfg.PasswordGenerationCost,
+		user.WithPasswordPolicy(user.NewPasswordPolicy(&cfg.Password, breached)),
+		user.WithPasswordHasher(hasher),
+		user.WithLockout(lockout),
+		user.WithTwoFactor(twoFactorSrv),
+	)
+
+	tokenSrv, err := user.NewTokenService(storage, tokens, &cfg.Token)
+	if err != nil {
+		log.WithError(err).Error("unable to create token service")
+		return
+	}
+
+	mailer, err := xmail.New(&cfg.Mail)
+	if err != nil {
+		log.WithError(err).Error("unable to create mailer")
+		return
+	}
+	if cfg.Mail.Driver != xmail.DriverSMTP {
+		log.Warnf("using the %s mail driver, the emails and their links are not sent, for local development only", cfg.Mail.Driver)
+	}
+
+	accountSrv := user.NewAccountService(userSrv, storage, tokens, mailer, &cfg.Account)
+
+	ctx, cancel := context.WithCancel(xlogger.SetLogger(context.Background(), log))
+	defer cancel()
+
+	relay := user.NewRelay(outbox, eventSvc, &cfg.Relay)
+	go relay.Run(ctx)
+
+	purger := user.NewPurger(storage, &cfg.Purge)
+	go purger.Run(ctx)
+
+	go lockout.Run(ctx)
+
+	realIP, err := xhttp.RealIP(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		log.WithError(err).Error("invalid trusted proxies")
+		return
+	}
+	if len(cfg.HTTP.TrustedProxies) == 0 {
+		log.Warn("USER_HTTP_TRUSTED_PROXIES is not set, behind a proxy all the clients share its IP in the login throttling")
+	}
 
 	r := xhttp.NewRouter(log)
+	r.Use(realIP)
+	r.Use(http.Authenticate(&cfg.Auth, tokenSrv))
 	r.Route("/", func(r chi.Router) {
-		http.NewUserHandler(r, userSrv)
+		http.NewUserHandler(r, userSrv, &cfg.Users)
+		http.NewAuthHandler(r, userSrv, tokenSrv)
+		http.NewAccountHandler(r, userSrv, accountSrv)
+		if twoFactorSrv != nil {
+			http.NewTwoFactorHandler(r, userSrv, twoFactorSrv)
+		}
 	})
 
 	httpSrv := xhttp.NewServer(
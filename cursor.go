@@ -0,0 +1,106 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Cursor is the position of the last user of a page, it holds the
+// values of the sort fields of that user
+type Cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// NewCursor returns the opaque cursor pointing after the given user
+// in the order defined by fields
+func NewCursor(fields []SortField, usr *User) string {
+	c := Cursor{
+		Sort:   FormatSort(fields),
+		Values: make([]string, 0, len(fields)),
+	}
+
+	for _, f := range fields {
+		switch v := f.Value(usr).(type) {
+		case time.Time:
+			c.Values = append(c.Values, v.UTC().Format(time.RFC3339Nano))
+		case float64:
+			c.Values = append(c.Values, strconv.FormatFloat(v, 'g', -1, 64))
+		case string:
+			c.Values = append(c.Values, v)
+		}
+	}
+
+	buf, _ := json.Marshal(&c)
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// ParseCursor decodes the cursor created by NewCursor, returning the values of the
+// sort fields, time.Time for time fields, float64 for the score and string for the others.
+// It returns ErrInvalid if the cursor is malformed or was created with another order.
+func ParseCursor(s string, fields []SortField) ([]interface{}, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	var c Cursor
+	err = json.Unmarshal(buf, &c)
+	if err != nil || c.Sort != FormatSort(fields) || len(c.Values) != len(fields) {
+		return nil, ErrInvalid
+	}
+
+	values := make([]interface{}, 0, len(fields))
+	for i, f := range fields {
+		switch {
+		case f.IsTime():
+			t, err := time.Parse(time.RFC3339Nano, c.Values[i])
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			values = append(values, t)
+		case f.Name == SortScore:
+			score, err := strconv.ParseFloat(c.Values[i], 64)
+			if err != nil {
+				return nil, ErrInvalid
+			}
+			values = append(values, score)
+		default:
+			values = append(values, c.Values[i])
+		}
+	}
+
+	return values, nil
+}
+
+// CursorUser returns a user holding the cursor values, it can be
+// compared with other users using the SortField.Compare
+func CursorUser(fields []SortField, values []interface{}) *User {
+	var u User
+
+	for i, f := range fields {
+		switch f.Name {
+		case SortEmail:
+			u.Email = values[i].(string)
+		case SortCreatedAt:
+			u.CreatedAt = values[i].(time.Time)
+		case SortUpdatedAt:
+			u.UpdatedAt = values[i].(time.Time)
+		case SortLastName:
+			u.LastName = values[i].(string)
+		case SortCountry:
+			u.Country = values[i].(string)
+		case SortNickname:
+			u.Nickname = values[i].(string)
+		case SortID:
+			u.ID = values[i].(string)
+		case SortScore:
+			u.Score = values[i].(float64)
+		}
+	}
+
+	return &u
+}
@@ -0,0 +1,63 @@
+package user_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+)
+
+func Test_Cursor(t *testing.T) {
+	fields, err := user.ParseSort("-created_at,last_name")
+	require.NoError(t, err)
+
+	u := &user.User{
+		ID:        "id",
+		Email:     "email@mail.com",
+		LastName:  "last",
+		CreatedAt: time.Date(2022, 8, 10, 19, 30, 12, 123456000, time.UTC),
+	}
+
+	values, err := user.ParseCursor(user.NewCursor(fields, u), fields)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{u.CreatedAt, u.LastName, u.Email, u.ID}, values)
+
+	c := user.CursorUser(fields, values)
+	for _, f := range fields {
+		require.Zero(t, f.Compare(u, c))
+	}
+}
+
+func Test_Cursor_Score(t *testing.T) {
+	fields, err := user.ParseSort("")
+	require.NoError(t, err)
+	fields = append([]user.SortField{{Name: user.SortScore, Desc: true}}, fields...)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", Score: 0.9031903743743896}
+
+	values, err := user.ParseCursor(user.NewCursor(fields, u), fields)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{u.Score, u.Email, u.ID}, values)
+
+	c := user.CursorUser(fields, values)
+	require.Zero(t, fields[0].Compare(u, c))
+	require.Equal(t, -1, fields[0].Compare(u, &user.User{Score: 0.5}))
+}
+
+func Test_Cursor_Invalid(t *testing.T) {
+	fields, err := user.ParseSort("")
+	require.NoError(t, err)
+
+	otherSort, err := user.ParseSort("country")
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	for _, invalid := range []string{"invalid", "e30", "bnVsbA", user.NewCursor(otherSort, u)} {
+		values, err := user.ParseCursor(invalid, fields)
+		require.ErrorIs(t, err, user.ErrInvalid, invalid)
+		require.Nil(t, values)
+	}
+}
@@ -0,0 +1,310 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	HashBcrypt   = "bcrypt"
+	HashScrypt   = "scrypt"
+	HashArgon2id = "argon2id"
+)
+
+// ErrUnknownHash is returned for encoded hashes of unknown algorithms or malformed ones
+var ErrUnknownHash = errors.New("unknown password hash")
+
+// PasswordHasher hashes the passwords, the encoded hashes record the algorithm
+// and its parameters, so they are verified after the parameters change
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports if the password matches the encoded hash
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports if the encoded hash was not made with the current
+	// algorithm and parameters, it should be replaced on the next login
+	NeedsRehash(encoded string) bool
+}
+
+type HasherConfig struct {
+	// Algorithm hashes the new passwords, bcrypt, scrypt or argon2id,
+	// the hashes of the other algorithms are still verified
+	Algorithm string `envconfig:"ALGORITHM" default:"argon2id"`
+
+	// BcryptCost is set from USER_PASSWORD_GENERATION_COST, kept for compatibility
+	BcryptCost int `ignored:"true"`
+
+	// ScryptN is the log2 of the scrypt CPU/memory cost
+	ScryptN int `envconfig:"SCRYPT_N" default:"15"`
+	ScryptR int `envconfig:"SCRYPT_R" default:"8"`
+	ScryptP int `envconfig:"SCRYPT_P" default:"1"`
+
+	// Argon2Memory is in KiB
+	Argon2Memory      uint32 `envconfig:"ARGON2_MEMORY" default:"65536"`
+	Argon2Iterations  uint32 `envconfig:"ARGON2_ITERATIONS" default:"3"`
+	Argon2Parallelism uint8  `envconfig:"ARGON2_PARALLELISM" default:"2"`
+}
+
+func (cfg *HasherConfig) setDefault() {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = HashArgon2id
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = 12
+	}
+	if cfg.ScryptN == 0 {
+		cfg.ScryptN = 15
+	}
+	if cfg.ScryptR == 0 {
+		cfg.ScryptR = 8
+	}
+	if cfg.ScryptP == 0 {
+		cfg.ScryptP = 1
+	}
+	if cfg.Argon2Memory == 0 {
+		cfg.Argon2Memory = 64 * 1024
+	}
+	if cfg.Argon2Iterations == 0 {
+		cfg.Argon2Iterations = 3
+	}
+	if cfg.Argon2Parallelism == 0 {
+		cfg.Argon2Parallelism = 2
+	}
+}
+
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+// hashAlgorithm returns the algorithm of the encoded hash
+func hashAlgorithm(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return HashBcrypt
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return HashScrypt
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return HashArgon2id
+	}
+
+	return ""
+}
+
+func randomSalt() ([]byte, error) {
+	salt := make([]byte, saltLength)
+	_, err := rand.Read(salt)
+
+	return salt, err
+}
+
+var b64 = base64.RawStdEncoding
+
+// BcryptHasher uses the bcrypt encoding, $2a$cost$saltandhash
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	encoded, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	return string(encoded), err
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	return true, nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != h.Cost
+}
+
+// ScryptHasher uses the PHC string format, $scrypt$ln=15,r=8,p=1$salt$hash
+type ScryptHasher struct {
+	// N is the log2 of the CPU/memory cost
+	N, R, P int
+}
+
+func (h *ScryptHasher) params() string {
+	return fmt.Sprintf("ln=%d,r=%d,p=%d", h.N, h.R, h.P)
+}
+
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.N, h.R, h.P, keyLength)
+	if err != nil {
+		return "", err
+	}
+
+	return "$scrypt$" + h.params() + "$" + b64.EncodeToString(salt) + "$" + b64.EncodeToString(key), nil
+}
+
+func (h *ScryptHasher) Verify(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != HashScrypt {
+		return false, ErrUnknownHash
+	}
+
+	var ln, r, p int
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &ln, &r, &p); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	salt, err := b64.DecodeString(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	want, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	got, err := scrypt.Key([]byte(password), salt, 1<<ln, r, p, len(want))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func (h *ScryptHasher) NeedsRehash(encoded string) bool {
+	return !strings.HasPrefix(encoded, "$scrypt$"+h.params()+"$")
+}
+
+// Argon2idHasher uses the PHC string format, $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+type Argon2idHasher struct {
+	// Memory is in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (h *Argon2idHasher) params() string {
+	return fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2.Version, h.Memory, h.Iterations, h.Parallelism)
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt()
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, keyLength)
+
+	return "$argon2id$" + h.params() + "$" + b64.EncodeToString(salt) + "$" + b64.EncodeToString(key), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return false, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("%w: argon2 version %q", ErrUnknownHash, parts[2])
+	}
+
+	var (
+		memory, iterations uint32
+		parallelism        uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &parallelism); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	want, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, parallelism, uint32(len(want)))
+
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	return !strings.HasPrefix(encoded, "$argon2id$"+h.params()+"$")
+}
+
+// multiHasher hashes with the current algorithm and verifies the hashes of any algorithm
+type multiHasher struct {
+	current    string
+	algorithms map[string]PasswordHasher
+}
+
+// NewPasswordHasher creates the hasher of the configured algorithm, it also
+// verifies the hashes of the other algorithms, which need a rehash
+func NewPasswordHasher(cfg *HasherConfig) (PasswordHasher, error) {
+	if cfg == nil {
+		cfg = new(HasherConfig)
+	}
+	cfg.setDefault()
+
+	h := &multiHasher{
+		current: cfg.Algorithm,
+		algorithms: map[string]PasswordHasher{
+			HashBcrypt: &BcryptHasher{Cost: cfg.BcryptCost},
+			HashScrypt: &ScryptHasher{N: cfg.ScryptN, R: cfg.ScryptR, P: cfg.ScryptP},
+			HashArgon2id: &Argon2idHasher{
+				Memory:      cfg.Argon2Memory,
+				Iterations:  cfg.Argon2Iterations,
+				Parallelism: cfg.Argon2Parallelism,
+			},
+		},
+	}
+
+	if _, ok := h.algorithms[cfg.Algorithm]; !ok {
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.Algorithm)
+	}
+
+	return h, nil
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.algorithms[h.current].Hash(password)
+}
+
+func (h *multiHasher) Verify(encoded, password string) (bool, error) {
+	hasher, ok := h.algorithms[hashAlgorithm(encoded)]
+	if !ok {
+		return false, ErrUnknownHash
+	}
+
+	return hasher.Verify(encoded, password)
+}
+
+func (h *multiHasher) NeedsRehash(encoded string) bool {
+	if hashAlgorithm(encoded) != h.current {
+		return true
+	}
+
+	return h.algorithms[h.current].NeedsRehash(encoded)
+}
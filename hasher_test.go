@@ -0,0 +1,145 @@
+package user_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+// the parameters are low to keep the tests fast
+func testHasherConfig(algorithm string) *user.HasherConfig {
+	return &user.HasherConfig{
+		Algorithm:         algorithm,
+		BcryptCost:        4,
+		ScryptN:           10,
+		ScryptR:           8,
+		ScryptP:           1,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func Test_PasswordHasher(t *testing.T) {
+	testCases := []struct {
+		Algorithm string
+		Prefix    string
+	}{
+		{user.HashBcrypt, "$2a$04$"},
+		{user.HashScrypt, "$scrypt$ln=10,r=8,p=1$"},
+		{user.HashArgon2id, "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Algorithm, func(t *testing.T) {
+			h, err := user.NewPasswordHasher(testHasherConfig(tc.Algorithm))
+			require.NoError(t, err)
+
+			encoded, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(encoded, tc.Prefix), encoded)
+			require.False(t, h.NeedsRehash(encoded))
+
+			ok, err := h.Verify(encoded, "correct horse")
+			require.NoError(t, err)
+			require.True(t, ok)
+
+			ok, err = h.Verify(encoded, "wrong horse")
+			require.NoError(t, err)
+			require.False(t, ok)
+
+			// the same password gets other salt
+			other, err := h.Hash("correct horse")
+			require.NoError(t, err)
+			require.NotEqual(t, encoded, other)
+		})
+	}
+}
+
+func Test_PasswordHasher_NeedsRehash(t *testing.T) {
+	bcryptHasher, err := user.NewPasswordHasher(testHasherConfig(user.HashBcrypt))
+	require.NoError(t, err)
+
+	old, err := bcryptHasher.Hash("correct horse")
+	require.NoError(t, err)
+
+	cfg := testHasherConfig(user.HashArgon2id)
+	h, err := user.NewPasswordHasher(cfg)
+	require.NoError(t, err)
+
+	// the hashes of other algorithms are verified and upgraded
+	ok, err := h.Verify(old, "correct horse")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, h.NeedsRehash(old))
+
+	current, err := h.Hash("correct horse")
+	require.NoError(t, err)
+	require.False(t, h.NeedsRehash(current))
+
+	// and so are the hashes of other parameters
+	cfg.Argon2Iterations = 2
+	stronger, err := user.NewPasswordHasher(cfg)
+	require.NoError(t, err)
+	require.True(t, stronger.NeedsRehash(current))
+
+	ok, err = stronger.Verify(current, "correct horse")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func Test_PasswordHasher_Unknown(t *testing.T) {
+	_, err := user.NewPasswordHasher(&user.HasherConfig{Algorithm: "md5"})
+	require.Error(t, err)
+
+	h, err := user.NewPasswordHasher(testHasherConfig(user.HashArgon2id))
+	require.NoError(t, err)
+
+	for _, encoded := range []string{"", "plain", "$argon2id$v=19$broken", "$scrypt$ln=10$a$b"} {
+		ok, err := h.Verify(encoded, "correct horse")
+		require.ErrorIs(t, err, user.ErrUnknownHash, encoded)
+		require.False(t, ok)
+	}
+}
+
+func Test_Authenticate_Rehash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	old := &user.BcryptHasher{Cost: 4}
+	encoded, err := old.Hash("correct horse")
+	require.NoError(t, err)
+
+	usr := &user.User{ID: "id", Email: "email", EncodedPassword: encoded}
+
+	h, err := user.NewPasswordHasher(testHasherConfig(user.HashArgon2id))
+	require.NoError(t, err)
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{usr}}, nil)
+
+	mockStorage.EXPECT().
+		SetPassword(gomock.Any(), usr.ID, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _, encoded string) error {
+			require.True(t, strings.HasPrefix(encoded, "$argon2id$"), encoded)
+			return nil
+		})
+
+	mockStorage.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, usr).
+		Return(nil)
+
+	svc := user.NewService(mockStorage, 4, user.WithPasswordHasher(h))
+
+	gotUser, err := svc.Authenticate(context.TODO(), usr.Email, "correct horse")
+	require.NoError(t, err)
+	require.False(t, h.NeedsRehash(gotUser.EncodedPassword))
+}
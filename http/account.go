@@ -0,0 +1,190 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type AccountHandler struct {
+	userSrv    user.Service
+	accountSrv user.AccountService
+}
+
+type tokenRequest struct {
+	Token string `json:"token"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type emailChangeRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewAccountHandler(r chi.Router, userSvc user.Service, accountSvc user.AccountService) *AccountHandler {
+	h := &AccountHandler{
+		userSrv:    userSvc,
+		accountSrv: accountSvc,
+	}
+
+	r.With(xhttp.RequirePrincipal, requireOwnerOr(user.PermissionUsersWrite)).
+		Post("/v1/users/{id}/verification", h.sendVerification)
+	r.With(xhttp.RequirePrincipal, requireOwnerOr(user.PermissionUsersWrite)).
+		Post("/v1/users/{id}/email", h.requestEmailChange)
+
+	// the token is the credential
+	r.Post("/v1/verify-email", h.verifyEmail)
+	r.Post("/v1/password/forgot", h.forgotPassword)
+	r.Post("/v1/password/reset", h.resetPassword)
+	r.Post("/v1/confirm-email", h.confirmEmailChange)
+
+	return h
+}
+
+func (h *AccountHandler) sendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, err := h.userSrv.Get(ctx, xhttp.URLParam(r, "id"))
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch user")
+		return
+	}
+
+	err = h.accountSrv.SendVerification(ctx, u)
+	if errors.Is(err, user.ErrInvalid) {
+		xhttp.ResponseWithProblem(ctx, w, http.StatusConflict, &xhttp.Problem{
+			Detail: "the email is already verified",
+		})
+		return
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to send verification")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusAccepted, nil)
+}
+
+func (h *AccountHandler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req tokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	u, err := h.accountSrv.VerifyEmail(ctx, req.Token)
+	if errors.Is(err, user.ErrInvalid) {
+		xlogger.Logger(ctx).Info("invalid verification token")
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to verify email")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
+
+func (h *AccountHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req forgotPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	err = h.accountSrv.ForgotPassword(ctx, req.Email)
+	if err != nil {
+		problem(ctx, w, err, "unable to send password reset")
+		return
+	}
+
+	// the same response for unknown emails
+	xhttp.ResponseWithStatus(ctx, w, http.StatusAccepted, nil)
+}
+
+func (h *AccountHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req resetPasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	err = h.accountSrv.ResetPassword(ctx, req.Token, req.Password)
+	if errors.Is(err, user.ErrInvalid) {
+		xlogger.Logger(ctx).WithError(err).Info("invalid password reset")
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to reset password")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusNoContent, nil)
+}
+
+func (h *AccountHandler) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req emailChangeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	u, err := h.userSrv.Get(ctx, xhttp.URLParam(r, "id"))
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch user")
+		return
+	}
+
+	err = h.accountSrv.RequestEmailChange(ctx, u, req.Email)
+	if err != nil {
+		problem(ctx, w, err, "unable to request email change")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusAccepted, nil)
+}
+
+func (h *AccountHandler) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req tokenRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	u, err := h.accountSrv.ConfirmEmailChange(ctx, req.Token)
+	if errors.Is(err, user.ErrInvalid) {
+		xlogger.Logger(ctx).Info("invalid email change token")
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to change email")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
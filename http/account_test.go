@@ -0,0 +1,332 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xmail"
+)
+
+func Test_SendVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+	suite.tokensMock.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+	suite.mailerMock.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/id/verification", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, u.ID))
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func Test_SendVerification_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	now := time.Now()
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), "verified").
+		Return(&user.User{ID: "verified", EmailVerifiedAt: &now}, nil)
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), "inexistent").
+		Return(nil, user.ErrNotFound)
+
+	tcases := []struct {
+		id     string
+		auth   string
+		status int
+	}{
+		{id: "verified", status: http.StatusConflict},
+		{id: "inexistent", status: http.StatusNotFound},
+		{id: "other", auth: bearer(t, suite, "id"), status: http.StatusForbidden},
+	}
+
+	for _, tc := range tcases {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/"+tc.id+"/verification", nil)
+		require.NoError(t, err)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		} else {
+			admin(req)
+		}
+
+		resp := serve(t, suite, req)
+		resp.Body.Close()
+
+		require.Equal(t, tc.status, resp.StatusCode, tc.id)
+	}
+}
+
+func Test_VerifyEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	now := time.Now()
+	u := &user.User{ID: "id", Email: "email@mail.com", EmailVerifiedAt: &now}
+
+	suite.tokensMock.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(&user.VerificationToken{UserID: u.ID, Email: u.Email, ExpiresAt: now.Add(time.Hour)}, nil)
+	suite.storageMock.EXPECT().
+		VerifyEmail(gomock.Any(), u.ID, u.Email).
+		Return(u, nil)
+
+	// the token is the credential
+	req, err := http.NewRequest(http.MethodPost, "/v1/verify-email", bytes.NewBufferString(`{"token":"token"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, u.ID, got.ID)
+	require.NotNil(t, got.EmailVerifiedAt)
+}
+
+func Test_VerifyEmail_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.tokensMock.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailVerification).
+		Return(nil, user.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/verify-email", bytes.NewBufferString(`{"token":"used"}`))
+	require.NoError(t, err)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func Test_ForgotPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	// the link is sent in background, done once for each email
+	done := make(chan struct{}, 2)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Users: []*user.User{u}, Total: 1}, nil)
+	suite.tokensMock.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+	suite.mailerMock.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, *xmail.Message) error {
+			done <- struct{}{}
+			return nil
+		})
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "unknown@mail.com"}).
+		DoAndReturn(func(context.Context, *user.ListOptions) (*user.List, error) {
+			done <- struct{}{}
+			return &user.List{}, nil
+		})
+
+	// the same response for unknown emails
+	for _, email := range []string{u.Email, "unknown@mail.com"} {
+		req, err := http.NewRequest(http.MethodPost, "/v1/password/forgot", bytes.NewBufferString(`{"email":"`+email+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+
+		resp := serve(t, suite, req)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusAccepted, resp.StatusCode, email)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the password reset")
+		}
+	}
+}
+
+func Test_ResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	suite.tokensMock.EXPECT().
+		GetVerificationToken(gomock.Any(), gomock.Any()).
+		Return(&user.VerificationToken{
+			UserID:    u.ID,
+			Purpose:   user.PurposePasswordReset,
+			Email:     u.Email,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}, nil).
+		Times(2)
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(2)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/password/reset", bytes.NewBufferString(`{"token":"token","password":"short"}`))
+	require.NoError(t, err)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	var body xhttp.Problem
+	body.Errors = &[]user.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, &[]user.FieldError{
+		{Field: "password", Code: user.PasswordTooShort},
+	}, body.Errors)
+
+	suite.storageMock.EXPECT().
+		ResetPassword(gomock.Any(), u.ID, gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	req, err = http.NewRequest(http.MethodPost, "/v1/password/reset", bytes.NewBufferString(`{"token":"token","password":"correct horse"}`))
+	require.NoError(t, err)
+
+	resp = serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func Test_ResetPassword_InvalidToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.tokensMock.EXPECT().
+		GetVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil, user.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/password/reset", bytes.NewBufferString(`{"token":"unknown","password":"correct horse"}`))
+	require.NoError(t, err)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func Test_RequestEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Email: "old@mail.com"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(2)
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "new@mail.com"}).
+		Return(&user.List{}, nil)
+	suite.tokensMock.EXPECT().
+		SaveVerificationToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+	suite.mailerMock.EXPECT().
+		Send(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(2)
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "taken@mail.com"}).
+		Return(&user.List{Total: 1}, nil)
+
+	tcases := []struct {
+		email  string
+		status int
+	}{
+		{email: "new@mail.com", status: http.StatusAccepted},
+		{email: "taken@mail.com", status: http.StatusConflict},
+	}
+
+	for _, tc := range tcases {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/id/email", bytes.NewBufferString(`{"email":"`+tc.email+`"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", bearer(t, suite, u.ID))
+
+		resp := serve(t, suite, req)
+		resp.Body.Close()
+
+		require.Equal(t, tc.status, resp.StatusCode, tc.email)
+	}
+}
+
+func Test_ConfirmEmailChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Email: "new@mail.com"}
+
+	suite.tokensMock.EXPECT().
+		UseVerificationToken(gomock.Any(), gomock.Any(), user.PurposeEmailChange).
+		Return(&user.VerificationToken{UserID: u.ID, Email: u.Email, ExpiresAt: time.Now().Add(time.Hour)}, nil)
+	suite.storageMock.EXPECT().
+		ChangeEmail(gomock.Any(), u.ID, u.Email).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/confirm-email", bytes.NewBufferString(`{"token":"token"}`))
+	require.NoError(t, err)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, u.Email, got.Email)
+}
@@ -0,0 +1,218 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// twoFactorRequiredType is the problem type of the logins missing the
+// two-factor code of the users with two-factor enabled
+const twoFactorRequiredType = "/problems/two-factor-required"
+
+type AuthHandler struct {
+	userSrv  user.Service
+	tokenSrv user.TokenService
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Code is the TOTP or recovery code of the users with two-factor enabled
+	Code string `json:"code"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewAuthHandler(r chi.Router, userSvc user.Service, tokenSvc user.TokenService) *AuthHandler {
+	h := &AuthHandler{
+		userSrv:  userSvc,
+		tokenSrv: tokenSvc,
+	}
+
+	r.Route("/v1/auth", func(r chi.Router) {
+		r.Post("/login", h.login)
+		r.Post("/token", h.token)
+		r.Post("/refresh", h.refresh)
+		r.Post("/revoke", h.revoke)
+	})
+
+	r.Get("/.well-known/jwks.json", h.jwks)
+
+	return h
+}
+
+// authenticate decodes the credentials of the login request and authenticates
+// the user, responding the errors itself, it returns false when it did
+func (h *AuthHandler) authenticate(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
+	ctx := r.Context()
+
+	var req loginRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return nil, false
+	}
+
+	ctx = user.WithClientIP(ctx, clientIP(r))
+	ctx = user.WithTwoFactorCode(ctx, req.Code)
+
+	u, err := h.userSrv.Authenticate(ctx, req.Email, req.Password)
+	if lockedOut(ctx, w, err) {
+		return nil, false
+	}
+	if twoFactorRequired(ctx, w, err) {
+		return nil, false
+	}
+	if errors.Is(err, user.ErrInvalidCredentials) {
+		// the same response for unknown emails and wrong passwords
+		xlogger.Logger(ctx).Info("invalid credentials")
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnauthorized, nil)
+		return nil, false
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to authenticate user")
+		return nil, false
+	}
+
+	return u, true
+}
+
+func (h *AuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
+
+func (h *AuthHandler) token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.tokenSrv.Issue(ctx, u)
+	if err != nil {
+		problem(ctx, w, err, "unable to issue tokens")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req refreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	tokens, err := h.tokenSrv.Refresh(ctx, req.RefreshToken)
+	if errors.Is(err, user.ErrInvalidCredentials) {
+		xlogger.Logger(ctx).Info("invalid refresh token")
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnauthorized, nil)
+		return
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to refresh tokens")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req refreshRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	// unknown tokens are not reported, as in RFC 7009
+	err = h.tokenSrv.Revoke(ctx, req.RefreshToken)
+	if err != nil {
+		problem(ctx, w, err, "unable to revoke token")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, nil)
+}
+
+func (h *AuthHandler) jwks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, h.tokenSrv.JWKS())
+}
+
+// clientIP returns the IP of the client of r, the X-Forwarded-For
+// of the trusted proxies is handled before by xhttp.RealIP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// lockedOut responds 429 with Retry-After when err is a user.LockedError
+func lockedOut(ctx context.Context, w http.ResponseWriter, err error) bool {
+	var locked *user.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	retry := math.Ceil(time.Until(locked.Until).Seconds())
+	if retry < 1 {
+		retry = 1
+	}
+
+	xlogger.Logger(ctx).WithField("until", locked.Until).Info("login locked")
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry)))
+	xhttp.ResponseWithProblem(ctx, w, http.StatusTooManyRequests, &xhttp.Problem{
+		Detail: "too many failed logins, retry later",
+	})
+
+	return true
+}
+
+// twoFactorRequired responds 401 telling the client to ask for the
+// two-factor code when err is user.ErrTwoFactorRequired
+func twoFactorRequired(ctx context.Context, w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, user.ErrTwoFactorRequired) {
+		return false
+	}
+
+	xlogger.Logger(ctx).Info("two factor required")
+	xhttp.ResponseWithProblem(ctx, w, http.StatusUnauthorized, &xhttp.Problem{
+		Type:   twoFactorRequiredType,
+		Detail: "the two-factor code is required",
+	})
+
+	return true
+}
@@ -0,0 +1,223 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xjwt"
+)
+
+func post(t *testing.T, suite userTestSuite, path, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	require.NoError(t, err)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+func Test_Login(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", EncodedPassword: string(encoded)}
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil)
+
+	suite.storageMock.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, u).
+		Return(nil)
+
+	resp := post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "passwd"}`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, u.ID, got.ID)
+	require.Empty(t, got.EncodedPassword)
+}
+
+func Test_Login_InvalidCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", EncodedPassword: string(encoded)}
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "unknown@mail.com"}).
+		Return(&user.List{Users: []*user.User{}}, nil)
+
+	bodies := make([]string, 0)
+
+	for _, body := range []string{
+		`{"email": "email@mail.com", "password": "wrong"}`,
+		`{"email": "unknown@mail.com", "password": "passwd"}`,
+		`{"email": "email@mail.com"}`,
+	} {
+		resp := post(t, suite, "/v1/auth/login", body)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, body)
+
+		buf, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(buf))
+	}
+
+	// the response does not tell which part of the credentials is wrong
+	require.Equal(t, bodies[0], bodies[1])
+	require.Equal(t, bodies[0], bodies[2])
+}
+
+func Test_Login_InvalidBody(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	resp := post(t, suite, "/v1/auth/login", `{"email":`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func Test_Token(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", EncodedPassword: string(encoded)}
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil)
+
+	suite.storageMock.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, u).
+		Return(nil)
+
+	suite.tokensMock.EXPECT().
+		SaveRefreshToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	resp := post(t, suite, "/v1/auth/token", `{"email": "email@mail.com", "password": "passwd"}`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.Tokens
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, user.TokenTypeBearer, got.TokenType)
+	require.NotEmpty(t, got.RefreshToken)
+
+	claims, err := suite.tokenSvc.Verify(suite.ctx, got.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, u.ID, claims.Subject)
+}
+
+func Test_Token_InvalidCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "unknown@mail.com"}).
+		Return(&user.List{Users: []*user.User{}}, nil)
+
+	resp := post(t, suite, "/v1/auth/token", `{"email": "unknown@mail.com", "password": "passwd"}`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func Test_Refresh_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.tokensMock.EXPECT().
+		GetRefreshToken(gomock.Any(), gomock.Any()).
+		Return(nil, user.ErrNotFound)
+
+	resp := post(t, suite, "/v1/auth/refresh", `{"refresh_token": "unknown"}`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func Test_Revoke(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.tokensMock.EXPECT().
+		RevokeRefreshToken(gomock.Any(), gomock.Any()).
+		Return(user.ErrNotFound)
+
+	resp := post(t, suite, "/v1/auth/revoke", `{"refresh_token": "unknown"}`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_JWKS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	req, err := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	require.NoError(t, err)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got xjwt.JWKS
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Len(t, got.Keys, 1)
+	require.Equal(t, xjwt.AlgorithmEdDSA, got.Keys[0].Algorithm)
+}
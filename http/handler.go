@@ -3,8 +3,10 @@ package http
 import (
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
@@ -13,30 +15,65 @@ import (
 	"github.com/cadicallegari/user/pkg/xlogger"
 )
 
+type UserConfig struct {
+	// RequireIfMatch rejects the updates and deletes without
+	// the If-Match header with 428 Precondition Required
+	RequireIfMatch bool `envconfig:"REQUIRE_IF_MATCH" default:"false"`
+}
+
 type UserHandler struct {
 	userSrv user.Service
+
+	cfg *UserConfig
 }
 
 type contextKey string
 
 var userCtxKey = contextKey("user")
 
-func NewUserHandler(r chi.Router, userSvc user.Service) *UserHandler {
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+func NewUserHandler(r chi.Router, userSvc user.Service, cfg *UserConfig) *UserHandler {
+	if cfg == nil {
+		cfg = new(UserConfig)
+	}
+
 	h := &UserHandler{
 		userSrv: userSvc,
+		cfg:     cfg,
 	}
 
+	// the sign up is public, the other routes need the Authenticate middleware
 	r.Route("/v1/users", func(r chi.Router) {
-		r.Get("/", h.list)
+		r.With(xhttp.RequirePrincipal, requirePermission(user.PermissionUsersRead)).Get("/", h.list)
 		r.Post("/", h.create)
 		r.Route("/{id}", func(r chi.Router) {
-			r = r.With(h.loadUser)
-			r.Get("/", h.get)
-			r.Put("/", h.update)
-			r.Delete("/", h.delete)
+			r.Use(xhttp.RequirePrincipal)
+
+			read := r.With(requireOwnerOr(user.PermissionUsersRead), h.loadUser)
+			read.Get("/", h.get)
+			read.Get("/roles", h.roles)
+
+			write := r.With(requireOwnerOr(user.PermissionUsersWrite), h.loadUser)
+			write.Put("/", h.update)
+			write.Patch("/", h.patch)
+			write.Delete("/", h.delete)
+
+			admin := r.With(requirePermission(user.PermissionUsersAdmin), h.loadUser)
+			admin.Put("/roles/{role}", h.grantRole)
+			admin.Delete("/roles/{role}", h.revokeRole)
+			admin.Delete("/lockout", h.unlock)
+
+			// the deleted users are not found by loadUser
+			r.With(requirePermission(user.PermissionUsersAdmin)).Post("/restore", h.restore)
 		})
 	})
 
+	r.With(xhttp.RequirePrincipal, requirePermission(user.PermissionUsersRead)).Get("/v1/roles", h.listRoles)
+
 	return h
 }
 
@@ -47,12 +84,8 @@ func (h *UserHandler) loadUser(next http.Handler) http.Handler {
 		id := xhttp.URLParam(r, "id")
 
 		u, err := h.userSrv.Get(ctx, id)
-		if errors.Is(err, user.ErrNotFound) {
-			xhttp.ResponseWithStatus(ctx, w, http.StatusNotFound, nil)
-		}
 		if err != nil {
-			xlogger.Logger(ctx).WithError(err).Error("unable to fetch user")
-			xhttp.ResponseWithStatus(ctx, w, http.StatusInternalServerError, nil)
+			problem(ctx, w, err, "unable to fetch user")
 			return
 		}
 
@@ -69,15 +102,44 @@ func (h *UserHandler) list(w http.ResponseWriter, r *http.Request) {
 	opts := user.NewListOptions()
 	err := xhttp.DecodeQuery(r, opts)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to decode request")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusBadRequest, nil)
+		malformed(ctx, w, err)
+		return
+	}
+
+	verr := new(user.ValidationError)
+
+	if fields, err := user.ParseSort(opts.Sort); err != nil {
+		verr.Add("sort", user.FieldFormat, "comma separated fields, prefixed with - for descending order")
+	} else if opts.Cursor != "" {
+		if _, err := user.ParseCursor(opts.Cursor, fields); err != nil {
+			verr.Add("cursor", user.FieldFormat, "next_cursor of a previous page with the same sort")
+		}
+	}
+
+	if !user.ValidSearchMode(opts.SearchMode) {
+		verr.Add("search_mode", user.FieldEnum, user.SearchModeNatural+" or "+user.SearchModeBoolean)
+	}
+
+	// the malformed query params are a bad request, listed as the invalid fields
+	if err := verr.Err(); err != nil {
+		xlogger.Logger(ctx).WithError(err).Info("invalid list options")
+		xhttp.ResponseWithProblem(ctx, w, http.StatusBadRequest, &xhttp.Problem{
+			Detail: "the query has invalid params",
+			Errors: verr.Fields,
+		})
+		return
+	}
+
+	if opts.IncludeDeleted && !xhttp.PrincipalFromContext(ctx).HasPermission(user.PermissionUsersAdmin) {
+		xhttp.ResponseWithProblem(ctx, w, http.StatusForbidden, &xhttp.Problem{
+			Detail: "include_deleted needs the " + user.PermissionUsersAdmin + " permission",
+		})
 		return
 	}
 
 	list, err := h.userSrv.List(ctx, opts)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to fetch users")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusInternalServerError, nil)
+		problem(ctx, w, err, "unable to fetch users")
 		return
 	}
 
@@ -87,23 +149,70 @@ func (h *UserHandler) list(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	var usrReq *user.User
+	// a value, so a null body is decoded as an empty user
+	var usrReq user.User
 	err := json.NewDecoder(r.Body).Decode(&usrReq)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to decode request")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusBadRequest, nil)
+		malformed(ctx, w, err)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
 		return
 	}
 
 	usrReq.ID = xhttp.URLParam(r, "id")
+	usrReq.Version = version
+
+	u, err := h.userSrv.Update(ctx, &usrReq)
+	if err != nil {
+		problem(ctx, w, err, "unable to update user")
+		return
+	}
+
+	w.Header().Set("ETag", etag(u))
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
+
+// patch applies a RFC 7396 JSON merge patch, the RFC 6902 JSON patch is not supported
+func (h *UserHandler) patch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if ct := r.Header.Get("Content-Type"); strings.HasPrefix(ct, jsonPatchContentType) {
+		w.Header().Set("Accept-Patch", mergePatchContentType)
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnsupportedMediaType, &xhttp.Problem{
+			Detail: "only the " + mergePatchContentType + " patches are supported",
+		})
+		return
+	}
 
-	u, err := h.userSrv.Update(ctx, usrReq)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to update user")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusInternalServerError, nil)
+		malformed(ctx, w, err)
 		return
 	}
 
+	patch, err := user.ParseMergePatch(body)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	patch.Version = version
+
+	u, err := h.userSrv.Patch(ctx, xhttp.URLParam(r, "id"), patch)
+	if err != nil {
+		problem(ctx, w, err, "unable to patch user")
+		return
+	}
+
+	w.Header().Set("ETag", etag(u))
 	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
 }
 
@@ -111,45 +220,96 @@ func (h *UserHandler) get(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	usr := ctx.Value(userCtxKey).(*user.User)
 
+	w.Header().Set("ETag", etag(usr))
 	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, usr)
 }
 
 func (h *UserHandler) delete(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	usr := ctx.Value(userCtxKey).(*user.User)
+	usr := *ctx.Value(userCtxKey).(*user.User)
+
+	version, ok := h.ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	usr.Version = version
 
-	err := h.userSrv.Delete(ctx, usr)
+	err := h.userSrv.Delete(ctx, &usr)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to delete user")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusInternalServerError, nil)
+		problem(ctx, w, err, "unable to delete user")
 		return
 	}
 
 	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, nil)
 }
 
-func (h *UserHandler) create(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) restore(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	var usrReq *user.User
-	err := json.NewDecoder(r.Body).Decode(&usrReq)
+	u, err := h.userSrv.Restore(ctx, xhttp.URLParam(r, "id"))
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to decode request")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusBadRequest, nil)
+		problem(ctx, w, err, "unable to restore user")
 		return
 	}
 
-	u, err := h.userSrv.Save(ctx, usrReq)
-	if err == user.ErrAlreadyExists {
-		xhttp.ResponseWithStatus(ctx, w, http.StatusConflict, nil)
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
+
+func (h *UserHandler) create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// a value, so a null body is decoded as an empty user
+	var usrReq user.User
+	err := json.NewDecoder(r.Body).Decode(&usrReq)
+	if err != nil {
+		malformed(ctx, w, err)
 		return
 	}
 
+	u, err := h.userSrv.Save(ctx, &usrReq)
 	if err != nil {
-		xlogger.Logger(ctx).WithError(err).Error("unable to save user")
-		xhttp.ResponseWithStatus(ctx, w, http.StatusInternalServerError, nil)
+		problem(ctx, w, err, "unable to save user")
 		return
 	}
 
 	xhttp.ResponseWithStatus(ctx, w, http.StatusCreated, u)
 }
+
+// etag is the strong entity tag of the user version
+func etag(u *user.User) string {
+	return fmt.Sprintf(`"%d"`, u.Version)
+}
+
+// ifMatch checks the If-Match header against the loaded user, returning the version
+// the change is conditioned to, zero when there is no header or it is *
+func (h *UserHandler) ifMatch(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	ctx := r.Context()
+	usr := ctx.Value(userCtxKey).(*user.User)
+
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if h.cfg.RequireIfMatch {
+			xhttp.ResponseWithProblem(ctx, w, http.StatusPreconditionRequired, &xhttp.Problem{
+				Detail: "the If-Match header is required",
+			})
+			return 0, false
+		}
+
+		return 0, true
+	}
+
+	if strings.TrimSpace(header) == "*" {
+		return 0, true
+	}
+
+	// the weak tags never match, If-Match uses the strong comparison
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == etag(usr) {
+			return usr.Version, true
+		}
+	}
+
+	problem(ctx, w, user.ErrConflict, "")
+	return 0, false
+}
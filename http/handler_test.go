@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
@@ -15,38 +16,73 @@ import (
 
 	"github.com/cadicallegari/user"
 	userHttp "github.com/cadicallegari/user/http"
+	"github.com/cadicallegari/user/mem"
 	"github.com/cadicallegari/user/mock"
 	"github.com/cadicallegari/user/pkg/xhttp"
 	"github.com/cadicallegari/user/pkg/xlogger"
 )
 
 type userTestSuite struct {
-	ctx         context.Context
-	log         *logrus.Entry
-	router      *xhttp.Router
-	svc         user.Service
-	storageMock *mock.Storage
-	eventMock   *mock.EventService
+	ctx        context.Context
+	log        *logrus.Entry
+	router     *xhttp.Router
+	svc        user.Service
+	tokenSvc   user.TokenService
+	accountSvc user.AccountService
+	// twoFactorSvc keeps the enrollments in memory
+	twoFactorSvc user.TwoFactorService
+	storageMock  *mock.Storage
+	tokensMock   *mock.TokenStorage
+	mailerMock   *mock.Mailer
 }
 
+const adminAPIKey = "admin-key"
+
 func serviceWithMocks(t *testing.T, ctrl *gomock.Controller) userTestSuite {
 	var s userTestSuite
 
 	s.log = xlogger.New(nil).WithFields(nil)
 	s.ctx = xlogger.SetLogger(context.TODO(), s.log)
 	s.storageMock = mock.NewStorage(ctrl)
-	s.eventMock = mock.NewEventService(ctrl)
 
-	s.svc = user.NewService(s.storageMock, s.eventMock, 4)
+	s.tokensMock = mock.NewTokenStorage(ctrl)
+
+	s.twoFactorSvc = user.NewTwoFactorService(mem.NewTwoFactorStorage(), nil)
+	s.svc = user.NewService(
+		s.storageMock,
+		4,
+		user.WithLockout(user.NewLockout(mem.NewAttemptStorage(), nil)),
+		user.WithTwoFactor(s.twoFactorSvc),
+	)
+
+	tokenSvc, err := user.NewTokenService(s.storageMock, s.tokensMock, nil)
+	require.NoError(t, err)
+	s.tokenSvc = tokenSvc
+
+	s.mailerMock = mock.NewMailer(ctrl)
+	s.accountSvc = user.NewAccountService(s.svc, s.storageMock, s.tokensMock, s.mailerMock, nil)
 
 	s.router = xhttp.NewRouter(s.log)
 
+	s.router.Use(userHttp.Authenticate(&userHttp.AuthConfig{
+		APIKeys:           map[string]string{"admin": adminAPIKey},
+		ClientCommonNames: []string{"admin.internal"},
+	}, s.tokenSvc))
+
 	// to setup routes
-	_ = userHttp.NewUserHandler(s.router, s.svc)
+	_ = userHttp.NewUserHandler(s.router, s.svc, nil)
+	_ = userHttp.NewAuthHandler(s.router, s.svc, s.tokenSvc)
+	_ = userHttp.NewAccountHandler(s.router, s.svc, s.accountSvc)
+	_ = userHttp.NewTwoFactorHandler(s.router, s.svc, s.twoFactorSvc)
 
 	return s
 }
 
+// admin authenticates the request with the API key of an admin
+func admin(req *http.Request) {
+	req.Header.Set(xhttp.APIKeyHeader, adminAPIKey)
+}
+
 func Test_Create(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -55,21 +91,19 @@ func Test_Create(t *testing.T) {
 
 	u := &user.User{
 		FirstName: "first name",
-		Email:     "email",
+		Email:     "email@mail.com",
+		Password:  "correct horse battery",
+		Country:   "DE",
 	}
 
 	suite.storageMock.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: u.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
 		Return(&user.List{}, nil)
 
 	suite.storageMock.EXPECT().
-		Save(gomock.Any(), u).
+		Save(gomock.Any(), gomock.Any()).
 		Return(u, nil)
 
-	suite.eventMock.EXPECT().
-		UserCreated(gomock.Any(), u).
-		Return(nil)
-
 	buf, err := json.Marshal(u)
 	require.NoError(t, err)
 
@@ -95,15 +129,17 @@ func Test_Create_SaveError(t *testing.T) {
 
 	u := &user.User{
 		FirstName: "first name",
-		Email:     "email",
+		Email:     "email@mail.com",
+		Password:  "correct horse battery",
+		Country:   "DE",
 	}
 
 	suite.storageMock.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: u.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
 		Return(&user.List{}, nil)
 
 	suite.storageMock.EXPECT().
-		Save(gomock.Any(), u).
+		Save(gomock.Any(), gomock.Any()).
 		Return(nil, errors.New("any error"))
 
 	buf, err := json.Marshal(u)
@@ -123,7 +159,7 @@ func Test_Create_SaveError(t *testing.T) {
 	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
 }
 
-func Test_Create_SendEventError(t *testing.T) {
+func Test_Create_InvalidPassword(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -131,36 +167,86 @@ func Test_Create_SendEventError(t *testing.T) {
 
 	u := &user.User{
 		FirstName: "first name",
-		Email:     "email",
+		Email:     "email@mail.com",
+		Password:  "a",
+		Country:   "DE",
 	}
 
 	suite.storageMock.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: u.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
 		Return(&user.List{}, nil)
 
-	suite.storageMock.EXPECT().
-		Save(gomock.Any(), u).
-		Return(u, nil)
-
-	suite.eventMock.EXPECT().
-		UserCreated(gomock.Any(), u).
-		Return(errors.New("some error"))
-
 	buf, err := json.Marshal(u)
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodPost, "/v1/users", bytes.NewBuffer(buf))
 	require.NoError(t, err)
 
-	req = req.WithContext(suite.ctx)
-	w := httptest.NewRecorder()
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
 
-	suite.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"))
 
-	resp := w.Result()
+	var body xhttp.Problem
+	body.Errors = &[]user.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, http.StatusUnprocessableEntity, body.Status)
+	require.Equal(t, &[]user.FieldError{{Field: "password", Code: user.PasswordTooShort}}, body.Errors)
+}
+
+func Test_Create_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	resp := post(t, suite, "/v1/users", `{"first_name": "first", "email": "invalid", "password": "correct horse battery"}`)
 	defer resp.Body.Close()
 
-	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"))
+
+	var body xhttp.Problem
+	body.Errors = &[]user.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, "Unprocessable Entity", body.Title)
+	require.Equal(t, http.StatusUnprocessableEntity, body.Status)
+	require.Equal(t, &[]user.FieldError{
+		{Field: "country", Code: user.FieldRequired},
+		{Field: "email", Code: user.FieldFormat},
+	}, body.Errors)
+}
+
+func Test_Create_Malformed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	resp := post(t, suite, "/v1/users", `{"first_name": `)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body xhttp.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, "Bad Request", body.Title)
+	require.Equal(t, http.StatusBadRequest, body.Status)
+}
+
+func Test_Create_Null(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// a null body is an empty user
+	resp := post(t, suite, "/v1/users", `null`)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"))
 }
 
 func Test_Create_AlreadyExists(t *testing.T) {
@@ -171,11 +257,13 @@ func Test_Create_AlreadyExists(t *testing.T) {
 
 	u := &user.User{
 		FirstName: "first name",
-		Email:     "email",
+		Email:     "email@mail.com",
+		Password:  "correct horse battery",
+		Country:   "DE",
 	}
 
 	suite.storageMock.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: u.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
 		Return(&user.List{
 			Total: uint64(1),
 			Users: []*user.User{u},
@@ -212,6 +300,7 @@ func Test_Get_NotFound(t *testing.T) {
 
 	req, err := http.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
 	require.NoError(t, err)
+	admin(req)
 
 	req = req.WithContext(suite.ctx)
 	w := httptest.NewRecorder()
@@ -235,6 +324,7 @@ func Test_Update(t *testing.T) {
 		ID:        id,
 		FirstName: "first name",
 		Email:     "email",
+		Country:   "DE",
 	}
 
 	suite.storageMock.EXPECT().
@@ -245,15 +335,12 @@ func Test_Update(t *testing.T) {
 		Update(gomock.Any(), u).
 		Return(u, nil)
 
-	suite.eventMock.EXPECT().
-		UserUpdated(gomock.Any(), u).
-		Return(nil)
-
 	buf, err := json.Marshal(u)
 	require.NoError(t, err)
 
 	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+id, bytes.NewBuffer(buf))
 	require.NoError(t, err)
+	admin(req)
 
 	req = req.WithContext(suite.ctx)
 	w := httptest.NewRecorder()
@@ -266,6 +353,29 @@ func Test_Update(t *testing.T) {
 	require.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func Test_Update_Null(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Country: "DE"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID, bytes.NewBufferString(`null`))
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"))
+}
+
 func Test_Update_UserNotfound(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -288,6 +398,7 @@ func Test_Update_UserNotfound(t *testing.T) {
 
 	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+id, bytes.NewBuffer(buf))
 	require.NoError(t, err)
+	admin(req)
 
 	req = req.WithContext(suite.ctx)
 	w := httptest.NewRecorder()
@@ -300,6 +411,295 @@ func Test_Update_UserNotfound(t *testing.T) {
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
 
+func Test_Get_ETag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/"+u.ID, nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, `"3"`, resp.Header.Get("ETag"))
+}
+
+func Test_Update_IfMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+	updated := &user.User{ID: "id", FirstName: "updated", Email: "email", Version: 4}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	suite.storageMock.EXPECT().
+		Update(gomock.Any(), &user.User{ID: u.ID, FirstName: "updated", Country: "DE", Version: 3}).
+		Return(updated, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID, bytes.NewBufferString(`{"first_name": "updated", "country": "DE"}`))
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("If-Match", `"2", "3"`)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, `"4"`, resp.Header.Get("ETag"))
+}
+
+func Test_Update_IfMatch_Mismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(3)
+
+	// the weak tags do not match
+	for _, tag := range []string{`"2"`, `W/"3"`, `3`} {
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID, bytes.NewBufferString(`{"first_name": "updated"}`))
+		require.NoError(t, err)
+		admin(req)
+		req.Header.Set("If-Match", tag)
+
+		resp := serve(t, suite, req)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, tag)
+	}
+}
+
+func Test_Update_Conflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	// changed after being loaded
+	suite.storageMock.EXPECT().
+		Update(gomock.Any(), gomock.Any()).
+		Return(nil, user.ErrConflict)
+
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID, bytes.NewBufferString(`{"first_name": "updated", "country": "DE"}`))
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("If-Match", `"3"`)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
+func Test_IfMatch_Required(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	router := xhttp.NewRouter(suite.log)
+	router.Use(userHttp.Authenticate(&userHttp.AuthConfig{
+		APIKeys: map[string]string{"admin": adminAPIKey},
+	}, suite.tokenSvc))
+	_ = userHttp.NewUserHandler(router, suite.svc, &userHttp.UserConfig{RequireIfMatch: true})
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(3)
+
+	suite.storageMock.EXPECT().
+		Delete(gomock.Any(), &user.User{ID: u.ID, FirstName: u.FirstName, Email: u.Email}).
+		Return(nil)
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req, err := http.NewRequest(method, "/v1/users/"+u.ID, bytes.NewBufferString(`{"first_name": "updated"}`))
+		require.NoError(t, err)
+		req.Header.Set(xhttp.APIKeyHeader, adminAPIKey)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req.WithContext(suite.ctx))
+
+		require.Equal(t, http.StatusPreconditionRequired, w.Code, method)
+	}
+
+	// * matches any version
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set(xhttp.APIKeyHeader, adminAPIKey)
+	req.Header.Set("If-Match", "*")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req.WithContext(suite.ctx))
+
+	require.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_Delete_IfMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(2)
+
+	suite.storageMock.EXPECT().
+		Delete(gomock.Any(), u).
+		Return(user.ErrConflict)
+
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID, nil)
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("If-Match", `"3"`)
+
+	resp := serve(t, suite, req)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID, nil)
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("If-Match", `"2"`)
+
+	resp = serve(t, suite, req)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
+func Test_Patch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", LastName: "last", Email: "email", Country: "DE", Version: 3}
+	want := &user.User{ID: "id", FirstName: "first name", Email: "email", Country: "BR", Version: 3}
+
+	// loaded by the handler and the service
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		Times(2)
+
+	suite.storageMock.EXPECT().
+		Update(gomock.Any(), want).
+		Return(&user.User{ID: "id", FirstName: "first name", Email: "email", Country: "BR", Version: 4}, nil)
+
+	req, err := http.NewRequest(http.MethodPatch, "/v1/users/"+u.ID, bytes.NewBufferString(`{"last_name": null, "country": "BR"}`))
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"3"`)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, `"4"`, resp.Header.Get("ETag"))
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, "BR", got.Country)
+	require.Equal(t, "first name", got.FirstName)
+}
+
+func Test_Patch_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Country: "DE", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		AnyTimes()
+
+	tests := []struct {
+		contentType string
+		body        string
+		want        int
+	}{
+		{"application/merge-patch+json", `{"first_name": 1}`, http.StatusBadRequest},
+		{"application/merge-patch+json", `[]`, http.StatusBadRequest},
+		// the first name is required
+		{"application/merge-patch+json", `{"first_name": null}`, http.StatusUnprocessableEntity},
+		{"application/json-patch+json", `[{"op": "remove", "path": "/nickname"}]`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/"+u.ID, bytes.NewBufferString(tt.body))
+		require.NoError(t, err)
+		admin(req)
+		req.Header.Set("Content-Type", tt.contentType)
+
+		resp := serve(t, suite, req)
+		resp.Body.Close()
+
+		require.Equal(t, tt.want, resp.StatusCode, tt.body)
+	}
+}
+
+func Test_Patch_IfMatch_Mismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email", Country: "DE", Version: 3}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodPatch, "/v1/users/"+u.ID, bytes.NewBufferString(`{"country": "BR"}`))
+	require.NoError(t, err)
+	admin(req)
+	req.Header.Set("If-Match", `"2"`)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+}
+
 func Test_Delete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -321,12 +721,9 @@ func Test_Delete(t *testing.T) {
 		Delete(gomock.Any(), u).
 		Return(nil)
 
-	suite.eventMock.EXPECT().
-		UserDeleted(gomock.Any(), u).
-		Return(nil)
-
 	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+id, nil)
 	require.NoError(t, err)
+	admin(req)
 
 	req = req.WithContext(suite.ctx)
 	w := httptest.NewRecorder()
@@ -361,6 +758,7 @@ func Test_Delete_UserNotfound(t *testing.T) {
 
 	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+id, bytes.NewBuffer(buf))
 	require.NoError(t, err)
+	admin(req)
 
 	req = req.WithContext(suite.ctx)
 	w := httptest.NewRecorder()
@@ -372,3 +770,298 @@ func Test_Delete_UserNotfound(t *testing.T) {
 
 	require.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
+
+func Test_Restore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	id := "some-valid-id"
+	u := &user.User{ID: id, FirstName: "first name", Email: "email"}
+
+	suite.storageMock.EXPECT().
+		Restore(gomock.Any(), id).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/"+id+"/restore", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, id, got.ID)
+}
+
+func Test_Restore_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		Restore(gomock.Any(), "notfound").
+		Return(nil, user.ErrNotFound)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/notfound/restore", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func Test_Restore_EmailTaken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		Restore(gomock.Any(), "id").
+		Return(nil, user.ErrAlreadyExists)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/id/restore", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func Test_Restore_Forbidden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// not even the deleted user can restore itself
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/id/restore", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, "id", user.RoleSupport))
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func Test_List_IncludeDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{PerPage: user.DefaultPerPage, IncludeDeleted: true}).
+		Return(&user.List{Users: []*user.User{}}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?include_deleted=true", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the deleted users are only listed to the admins
+	req, err = http.NewRequest(http.MethodGet, "/v1/users?include_deleted=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, "support-id", user.RoleSupport))
+
+	resp = serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func Test_List_Cursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email"}
+
+	fields, err := user.ParseSort("")
+	require.NoError(t, err)
+	cursor := user.NewCursor(fields, u)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{PerPage: user.DefaultPerPage, Cursor: cursor}).
+		Return(&user.List{Users: []*user.User{u}, NextCursor: cursor}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?cursor="+cursor, nil)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.List
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, cursor, got.NextCursor)
+}
+
+func Test_List_InvalidCursor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// rejected before reaching the storage
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?cursor=invalid", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	var body xhttp.Problem
+	body.Errors = &[]user.FieldError{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, "cursor", (*body.Errors.(*[]user.FieldError))[0].Field)
+}
+
+func Test_List_Sort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{PerPage: user.DefaultPerPage, Sort: "-created_at,last_name"}).
+		Return(&user.List{}, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?sort=-created_at,last_name", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_List_InvalidSort(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?sort=password", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func Test_List_Filters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{
+			PerPage:       user.DefaultPerPage,
+			Country:       "BR,US",
+			Nickname:      "nick",
+			Search:        "john",
+			CreatedAfter:  time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+			CreatedBefore: time.Date(2022, 8, 10, 12, 30, 0, 0, time.UTC),
+		}).
+		Return(&user.List{}, nil)
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		"/v1/users?country=BR,US&nickname=nick&search=john&created_after=2022-08-01&created_before=2022-08-10T12:30:00Z",
+		nil,
+	)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_List_InvalidTimeFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?updated_since=yesterday", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func Test_List_InvalidSearchMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users?search=alice&search_mode=regexp", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
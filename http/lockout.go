@@ -0,0 +1,21 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+)
+
+func (h *UserHandler) unlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	usr := ctx.Value(userCtxKey).(*user.User)
+
+	err := h.userSrv.Unlock(ctx, usr)
+	if err != nil {
+		problem(ctx, w, err, "unable to unlock user")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, nil)
+}
@@ -0,0 +1,82 @@
+package http_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+)
+
+func Test_Login_Locked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", EncodedPassword: string(encoded)}
+
+	// the fifth failure locks the account, the next logins are not checked
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil).
+		Times(5)
+
+	for i := 0; i < 5; i++ {
+		resp := post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "wrong"}`)
+		resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	for _, path := range []string{"/v1/auth/login", "/v1/auth/token"} {
+		resp := post(t, suite, path, `{"email": "email@mail.com", "password": "passwd"}`)
+		resp.Body.Close()
+		require.Equal(t, http.StatusTooManyRequests, resp.StatusCode, path)
+		require.Equal(t, "60", resp.Header.Get("Retry-After"), path)
+	}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID+"/lockout", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil)
+
+	suite.storageMock.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, u).
+		Return(nil)
+
+	resp = post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "passwd"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_Unlock_Forbidden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/id/lockout", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, "id"))
+
+	resp := serve(t, suite, req)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
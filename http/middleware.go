@@ -0,0 +1,124 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+)
+
+type AuthConfig struct {
+	// APIKeys maps the names of the API keys to the keys, e.g. billing:s3cr3t,
+	// the API keys are used by other services and have the admin role
+	APIKeys map[string]string `envconfig:"API_KEYS"`
+	// ClientCommonNames are the common names of the accepted client
+	// certificates, as the API keys they have the admin role
+	ClientCommonNames []string `envconfig:"CLIENT_COMMON_NAMES"`
+}
+
+// Authenticate identifies the callers by their access token, API key or client certificate,
+// the roles and permissions of the users come from their access tokens
+func Authenticate(cfg *AuthConfig, tokenSvc user.TokenService) func(http.Handler) http.Handler {
+	if cfg == nil {
+		cfg = new(AuthConfig)
+	}
+
+	verify := func(ctx context.Context, token string) (*xhttp.Principal, error) {
+		claims, err := tokenSvc.Verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		return &xhttp.Principal{
+			Subject:     claims.Subject,
+			Roles:       claims.Roles,
+			Permissions: claims.Permissions,
+		}, nil
+	}
+
+	admin := func(subject string) *xhttp.Principal {
+		return &xhttp.Principal{
+			Subject:     subject,
+			Roles:       []string{user.RoleAdmin},
+			Permissions: user.Permissions(user.DefaultRoles, []string{user.RoleAdmin}),
+		}
+	}
+
+	keys := make(map[string]*xhttp.Principal)
+	for name, key := range cfg.APIKeys {
+		keys[key] = admin(name)
+	}
+
+	identities := make(map[string]*xhttp.Principal)
+	for _, cn := range cfg.ClientCommonNames {
+		identities[cn] = admin(cn)
+	}
+
+	return xhttp.Authenticate(
+		xhttp.BearerAuthenticator(verify),
+		xhttp.APIKeyAuthenticator(keys),
+		xhttp.MTLSAuthenticator(identities),
+	)
+}
+
+// requirePermission allows only the callers with the permission
+func requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if !xhttp.PrincipalFromContext(ctx).HasPermission(permission) {
+				xhttp.ResponseWithProblem(ctx, w, http.StatusForbidden, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// requireOwnerOr allows the user of the {id} param and the callers with the permission, it
+// runs before loading the user so the forbidden requests do not reveal which users exist
+func requireOwnerOr(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			p := xhttp.PrincipalFromContext(ctx)
+
+			if !isOwner(r, p) && !p.HasPermission(permission) {
+				xhttp.ResponseWithProblem(ctx, w, http.StatusForbidden, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// requireOwner allows only the user of the {id} param, for the
+// requests not made by others on behalf of the user, e.g. the two-factor enrollment
+func requireOwner(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if !isOwner(r, xhttp.PrincipalFromContext(ctx)) {
+			xhttp.ResponseWithProblem(ctx, w, http.StatusForbidden, nil)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// isOwner reports if the caller is the user of the {id} param,
+// only the subject of the access tokens is an user ID
+func isOwner(r *http.Request, p *xhttp.Principal) bool {
+	return p.Method == xhttp.AuthMethodBearer && p.Subject == xhttp.URLParam(r, "id")
+}
@@ -0,0 +1,208 @@
+package http_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+)
+
+// bearer returns the Authorization header of an access token of the user with the roles
+func bearer(t *testing.T, suite userTestSuite, id string, roles ...string) string {
+	suite.tokensMock.EXPECT().
+		SaveRefreshToken(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	if len(roles) > 0 {
+		suite.storageMock.EXPECT().
+			Roles(gomock.Any()).
+			Return(user.DefaultRoles, nil)
+	}
+
+	tokens, err := suite.tokenSvc.Issue(suite.ctx, &user.User{ID: id, Roles: roles})
+	require.NoError(t, err)
+
+	return "Bearer " + tokens.AccessToken
+}
+
+func serve(t *testing.T, suite userTestSuite, req *http.Request) *http.Response {
+	req = req.WithContext(suite.ctx)
+	w := httptest.NewRecorder()
+
+	suite.router.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+func Test_Auth_Anonymous(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	for _, path := range []string{"/v1/users", "/v1/users/id"} {
+		// without credentials and with an unsupported scheme
+		for _, auth := range []string{"", "Basic dXNlcjpwYXNz"} {
+			req, err := http.NewRequest(http.MethodGet, path, nil)
+			require.NoError(t, err)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+
+			resp := serve(t, suite, req)
+			resp.Body.Close()
+
+			require.Equal(t, http.StatusUnauthorized, resp.StatusCode, path)
+			require.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+			require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func Test_Auth_InvalidCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	for header, value := range map[string]string{
+		"Authorization": "Bearer invalid",
+		"X-API-Key":     "invalid",
+	} {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users", nil)
+		require.NoError(t, err)
+		req.Header.Set(header, value)
+
+		resp := serve(t, suite, req)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode, header)
+		require.Equal(t, "application/problem+json; charset=UTF-8", resp.Header.Get("Content-Type"), header)
+	}
+}
+
+func Test_Auth_Owner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", FirstName: "first name", Email: "email"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/"+u.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, u.ID))
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_Auth_Forbidden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	testCases := []struct {
+		Method string
+		Path   string
+	}{
+		{http.MethodGet, "/v1/users"},
+		{http.MethodGet, "/v1/users/other"},
+		{http.MethodPut, "/v1/users/other"},
+		{http.MethodDelete, "/v1/users/other"},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.Method, tc.Path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", bearer(t, suite, "id"))
+
+		resp := serve(t, suite, req)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, tc)
+	}
+}
+
+func Test_Auth_Permissions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	other := &user.User{ID: "other", FirstName: "first name", Email: "email"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), other.ID).
+		Return(other, nil)
+
+	// the support role reads every user
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/"+other.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, "id", user.RoleSupport))
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// but it does not change them
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req, err := http.NewRequest(method, "/v1/users/"+other.ID, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", bearer(t, suite, "id", user.RoleSupport))
+
+		resp := serve(t, suite, req)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, method)
+	}
+}
+
+func Test_Auth_ClientCertificate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// the certificate was verified by the server
+	state := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "billing"}}}},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/id", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	req.TLS = state
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	// unknown common name
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), "id").
+		Return(&user.User{ID: "id"}, nil)
+
+	state.VerifiedChains[0][0].Subject.CommonName = "admin.internal"
+
+	resp = serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// problem answers the error as a RFC 7807 problem, listing the invalid fields of the
+// ErrInvalid errors. The unexpected errors are logged with msg, as 500 Internal Server Error
+func problem(ctx context.Context, w http.ResponseWriter, err error, msg string) {
+	var verr *user.ValidationError
+	var perr *user.PasswordError
+
+	switch {
+	case errors.As(err, &verr):
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnprocessableEntity, &xhttp.Problem{
+			Detail: "the request has invalid fields",
+			Errors: verr.Fields,
+		})
+	case errors.As(err, &perr):
+		// the codes are the rules broken
+		fields := make([]user.FieldError, 0, len(perr.Violations))
+		for _, v := range perr.Violations {
+			fields = append(fields, user.FieldError{Field: "password", Code: v})
+		}
+
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnprocessableEntity, &xhttp.Problem{
+			Detail: "the password does not follow the password policy",
+			Errors: fields,
+		})
+	case errors.Is(err, user.ErrInvalid):
+		xhttp.ResponseWithProblem(ctx, w, http.StatusUnprocessableEntity, nil)
+	case errors.Is(err, user.ErrNotFound):
+		xhttp.ResponseWithProblem(ctx, w, http.StatusNotFound, nil)
+	case errors.Is(err, user.ErrAlreadyExists):
+		xhttp.ResponseWithProblem(ctx, w, http.StatusConflict, nil)
+	case errors.Is(err, user.ErrConflict):
+		xhttp.ResponseWithProblem(ctx, w, http.StatusPreconditionFailed, &xhttp.Problem{
+			Detail: "the user was changed since the given version",
+		})
+	default:
+		xlogger.Logger(ctx).WithError(err).Error(msg)
+		xhttp.ResponseWithProblem(ctx, w, http.StatusInternalServerError, nil)
+	}
+}
+
+// malformed answers the requests that can not be decoded with 400 Bad Request
+func malformed(ctx context.Context, w http.ResponseWriter, err error) {
+	xlogger.Logger(ctx).WithError(err).Error("unable to decode request")
+	xhttp.ResponseWithProblem(ctx, w, http.StatusBadRequest, &xhttp.Problem{
+		Detail: "the request can not be decoded",
+	})
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+)
+
+type userRolesResponse struct {
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+type rolesResponse struct {
+	Roles []*user.Role `json:"roles"`
+}
+
+func (h *UserHandler) listRoles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	roles, err := h.userSrv.Roles(ctx)
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch roles")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, &rolesResponse{Roles: roles})
+}
+
+func (h *UserHandler) roles(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	usr := ctx.Value(userCtxKey).(*user.User)
+
+	roles, err := h.userSrv.Roles(ctx)
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch roles")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, &userRolesResponse{
+		Roles:       usr.Roles,
+		Permissions: user.Permissions(roles, usr.Roles),
+	})
+}
+
+func (h *UserHandler) grantRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	usr := ctx.Value(userCtxKey).(*user.User)
+
+	u, err := h.userSrv.GrantRole(ctx, usr, xhttp.URLParam(r, "role"))
+	if errors.Is(err, user.ErrInvalid) {
+		problem(ctx, w, &user.ValidationError{
+			Fields: []user.FieldError{{Field: "role", Code: user.FieldEnum, Detail: "unknown role"}},
+		}, "")
+		return
+	}
+	if err != nil {
+		problem(ctx, w, err, "unable to grant role")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
+
+func (h *UserHandler) revokeRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	usr := ctx.Value(userCtxKey).(*user.User)
+
+	u, err := h.userSrv.RevokeRole(ctx, usr, xhttp.URLParam(r, "role"))
+	if err != nil {
+		problem(ctx, w, err, "unable to revoke role")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, u)
+}
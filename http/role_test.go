@@ -0,0 +1,173 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+)
+
+func Test_ListRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	suite.storageMock.EXPECT().
+		Roles(gomock.Any()).
+		Return(user.DefaultRoles, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/roles", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Roles []*user.Role `json:"roles"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, user.DefaultRoles, body.Roles)
+}
+
+func Test_UserRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Roles: []string{user.RoleSupport}}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	suite.storageMock.EXPECT().
+		Roles(gomock.Any()).
+		Return(user.DefaultRoles, nil)
+
+	req, err := http.NewRequest(http.MethodGet, "/v1/users/"+u.ID+"/roles", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, u.ID))
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, []string{user.RoleSupport}, body.Roles)
+	require.Equal(t, []string{user.PermissionUsersRead}, body.Permissions)
+}
+
+func Test_GrantRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Roles: []string{}}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	suite.storageMock.EXPECT().
+		GrantRole(gomock.Any(), u.ID, user.RoleSupport).
+		Return(&user.User{ID: u.ID, Roles: []string{user.RoleSupport}}, nil)
+
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID+"/roles/"+user.RoleSupport, nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got user.User
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, []string{user.RoleSupport}, got.Roles)
+}
+
+func Test_GrantRole_Unknown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id"}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	suite.storageMock.EXPECT().
+		GrantRole(gomock.Any(), u.ID, "unknown").
+		Return(nil, user.ErrInvalid)
+
+	req, err := http.NewRequest(http.MethodPut, "/v1/users/"+u.ID+"/roles/unknown", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func Test_RevokeRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	u := &user.User{ID: "id", Roles: []string{user.RoleAdmin}}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil)
+
+	suite.storageMock.EXPECT().
+		RevokeRole(gomock.Any(), u.ID, user.RoleAdmin).
+		Return(&user.User{ID: u.ID, Roles: []string{}}, nil)
+
+	req, err := http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID+"/roles/"+user.RoleAdmin, nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_GrantRole_Forbidden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// the users do not grant roles to themselves
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req, err := http.NewRequest(method, "/v1/users/id/roles/"+user.RoleAdmin, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", bearer(t, suite, "id", user.RoleSupport))
+
+		resp := serve(t, suite, req)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusForbidden, resp.StatusCode, method)
+	}
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type TwoFactorHandler struct {
+	userSrv      user.Service
+	twoFactorSrv user.TwoFactorService
+}
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+type twoFactorResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewTwoFactorHandler(r chi.Router, userSvc user.Service, twoFactorSvc user.TwoFactorService) *TwoFactorHandler {
+	h := &TwoFactorHandler{
+		userSrv:      userSvc,
+		twoFactorSrv: twoFactorSvc,
+	}
+
+	r.Route("/v1/users/{id}/2fa", func(r chi.Router) {
+		r.Use(xhttp.RequirePrincipal)
+
+		r.With(requireOwnerOr(user.PermissionUsersRead)).Get("/", h.get)
+		// the secret is only shown to the user
+		r.With(requireOwner).Post("/", h.enroll)
+		r.With(requireOwner).Post("/confirm", h.confirm)
+		r.With(requirePermission(user.PermissionUsersAdmin)).Delete("/", h.reset)
+	})
+
+	return h
+}
+
+// user returns the user of the {id} param, responding the errors
+func (h *TwoFactorHandler) user(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
+	ctx := r.Context()
+
+	u, err := h.userSrv.Get(ctx, xhttp.URLParam(r, "id"))
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch user")
+		return nil, false
+	}
+
+	return u, true
+}
+
+func (h *TwoFactorHandler) get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+
+	enabled, err := h.twoFactorSrv.Enabled(ctx, u)
+	if err != nil {
+		problem(ctx, w, err, "unable to fetch two factor")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, &twoFactorResponse{Enabled: enabled})
+}
+
+func (h *TwoFactorHandler) enroll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.twoFactorSrv.Enroll(ctx, u)
+	if err != nil {
+		problem(ctx, w, err, "unable to enroll two factor")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, enrollment)
+}
+
+func (h *TwoFactorHandler) confirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req twoFactorRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		malformed(ctx, w, err)
+		return
+	}
+
+	u, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactorSrv.Confirm(ctx, u, req.Code)
+	if errors.Is(err, user.ErrInvalid) {
+		xlogger.Logger(ctx).Info("invalid two factor code")
+	}
+	// ErrNotFound when not enrolled or already confirmed
+	if err != nil {
+		problem(ctx, w, err, "unable to confirm two factor")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, &recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) reset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	u, ok := h.user(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.twoFactorSrv.Reset(ctx, u)
+	if err != nil {
+		problem(ctx, w, err, "unable to reset two factor")
+		return
+	}
+
+	xhttp.ResponseWithStatus(ctx, w, http.StatusOK, nil)
+}
@@ -0,0 +1,124 @@
+package http_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xhttp"
+	"github.com/cadicallegari/user/pkg/xtotp"
+)
+
+func Test_TwoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	u := &user.User{ID: "id", Email: "email@mail.com", EncodedPassword: string(encoded)}
+
+	suite.storageMock.EXPECT().
+		Get(gomock.Any(), u.ID).
+		Return(u, nil).
+		AnyTimes()
+
+	auth := bearer(t, suite, u.ID)
+
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/"+u.ID+"/2fa", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", auth)
+
+	resp := serve(t, suite, req)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var enrollment user.TwoFactorEnrollment
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&enrollment))
+	require.NotEmpty(t, enrollment.Secret)
+
+	code, err := xtotp.Code(enrollment.Secret, xtotp.Step(user.TimeNow())-1)
+	require.NoError(t, err)
+
+	req, err = http.NewRequest(http.MethodPost, "/v1/users/"+u.ID+"/2fa/confirm", bytes.NewBufferString(`{"code": "`+code+`"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", auth)
+
+	resp = serve(t, suite, req)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.RecoveryCodes, 10)
+
+	suite.storageMock.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: u.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{u}}, nil).
+		Times(3)
+
+	resp = post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "passwd"}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	var problem xhttp.Problem
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+	require.Equal(t, "/problems/two-factor-required", problem.Type)
+
+	suite.storageMock.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, u).
+		Return(nil).
+		Times(2)
+
+	resp = post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "passwd", "code": "`+body.RecoveryCodes[0]+`"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// an admin resets the two-factor
+	req, err = http.NewRequest(http.MethodDelete, "/v1/users/"+u.ID+"/2fa", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp = serve(t, suite, req)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = post(t, suite, "/v1/auth/login", `{"email": "email@mail.com", "password": "passwd"}`)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func Test_TwoFactor_Forbidden(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	suite := serviceWithMocks(t, ctrl)
+
+	// the enrollment is only made by the user, not even by an admin
+	req, err := http.NewRequest(http.MethodPost, "/v1/users/id/2fa", nil)
+	require.NoError(t, err)
+	admin(req)
+
+	resp := serve(t, suite, req)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// and the reset only by an admin
+	req, err = http.NewRequest(http.MethodDelete, "/v1/users/id/2fa", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", bearer(t, suite, "id"))
+
+	resp = serve(t, suite, req)
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
@@ -0,0 +1,250 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// ErrLocked is returned by Authenticate while the account or the client IP
+// is locked, the credentials are not checked
+var ErrLocked = errors.New("locked")
+
+// LockedError tells until when the account or the client IP is locked
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("locked until %s", e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+type LockoutConfig struct {
+	// MaxFailures is the failed logins in a row locking the account
+	MaxFailures int `envconfig:"MAX_FAILURES" default:"5"`
+	// Duration is the first lockout, doubled by each failure after it
+	Duration    time.Duration `envconfig:"DURATION" default:"1m"`
+	MaxDuration time.Duration `envconfig:"MAX_DURATION" default:"24h"`
+	// ResetAfter is the time without failures forgetting the failures of an account
+	ResetAfter time.Duration `envconfig:"RESET_AFTER" default:"24h"`
+
+	// IPMaxFailures is the failed logins of an IP, of any account, throttling
+	// the IP until IPWindow passes without failures
+	IPMaxFailures int           `envconfig:"IP_MAX_FAILURES" default:"100"`
+	IPWindow      time.Duration `envconfig:"IP_WINDOW" default:"15m"`
+
+	// ExpireInterval is how often the attempts no longer counted are removed
+	ExpireInterval time.Duration `envconfig:"EXPIRE_INTERVAL" default:"10m"`
+}
+
+func (cfg *LockoutConfig) setDefault() {
+	if cfg.MaxFailures == 0 {
+		cfg.MaxFailures = 5
+	}
+	if cfg.Duration == 0 {
+		cfg.Duration = time.Minute
+	}
+	if cfg.MaxDuration == 0 {
+		cfg.MaxDuration = 24 * time.Hour
+	}
+	if cfg.ResetAfter == 0 {
+		cfg.ResetAfter = 24 * time.Hour
+	}
+	if cfg.IPMaxFailures == 0 {
+		cfg.IPMaxFailures = 100
+	}
+	if cfg.IPWindow == 0 {
+		cfg.IPWindow = 15 * time.Minute
+	}
+	if cfg.ExpireInterval == 0 {
+		cfg.ExpireInterval = 10 * time.Minute
+	}
+}
+
+// Attempts are the failed logins of a key, an account or an IP
+type Attempts struct {
+	Key            string    `json:"key" db:"attempt_key"`
+	Failures       int       `json:"failures"`
+	FirstFailureAt time.Time `json:"first_failure_at" db:"first_failure_at"`
+	LastFailureAt  time.Time `json:"last_failure_at" db:"last_failure_at"`
+}
+
+// AttemptStorage keeps the failed logins
+type AttemptStorage interface {
+	// Get returns the attempts of the key, nil when there are none
+	Get(_ context.Context, key string) (*Attempts, error)
+	// Fail records a failed login of the key at the given time, returning its attempts.
+	// The failures are forgotten when the last one is older than window
+	Fail(_ context.Context, key string, at time.Time, window time.Duration) (*Attempts, error)
+	// Reset forgets the failures of the key
+	Reset(_ context.Context, key string) error
+	// Expire forgets the keys starting with prefix whose last failure is before
+	// the given time, returning the number of keys removed
+	Expire(_ context.Context, prefix string, before time.Time) (int, error)
+}
+
+// Lockout locks the accounts after failed logins in a row, for exponentially
+// longer durations, and throttles the IPs failing too many logins
+type Lockout struct {
+	attempts AttemptStorage
+
+	cfg *LockoutConfig
+}
+
+func NewLockout(attempts AttemptStorage, cfg *LockoutConfig) *Lockout {
+	if cfg == nil {
+		cfg = new(LockoutConfig)
+	}
+	cfg.setDefault()
+
+	return &Lockout{
+		attempts: attempts,
+		cfg:      cfg,
+	}
+}
+
+// the accounts are identified by the email, so the unknown emails
+// are locked as well and the lockout does not reveal them
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Run expires the attempts every ExpireInterval until the context is done, the keys
+// are created before the users are looked up, so any email or IP adds one
+func (l *Lockout) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.ExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := l.Expire(ctx)
+		if err != nil {
+			xlogger.Logger(ctx).WithError(err).Error("unable to expire login attempts")
+		}
+		if n > 0 {
+			xlogger.Logger(ctx).WithField("expired", n).Debug("login attempts expired")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire removes the attempts neither counted nor locking anymore, the accounts after
+// the longest of ResetAfter and MaxDuration and the IPs after IPWindow without failures
+func (l *Lockout) Expire(ctx context.Context) (int, error) {
+	now := TimeNow()
+
+	accountTTL := l.cfg.ResetAfter
+	if l.cfg.MaxDuration > accountTTL {
+		accountTTL = l.cfg.MaxDuration
+	}
+
+	accounts, err := l.attempts.Expire(ctx, accountKey(""), now.Add(-accountTTL))
+	if err != nil {
+		return accounts, err
+	}
+
+	ips, err := l.attempts.Expire(ctx, ipKey(""), now.Add(-l.cfg.IPWindow))
+
+	return accounts + ips, err
+}
+
+// Check returns a LockedError while the account of the email or the IP is locked
+func (l *Lockout) Check(ctx context.Context, email, ip string) error {
+	now := TimeNow()
+
+	a, err := l.attempts.Get(ctx, accountKey(email))
+	if err != nil {
+		return err
+	}
+
+	if until := l.lockedUntil(a); now.Before(until) {
+		return &LockedError{Until: until}
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	a, err = l.attempts.Get(ctx, ipKey(ip))
+	if err != nil {
+		return err
+	}
+
+	if a != nil && a.Failures >= l.cfg.IPMaxFailures {
+		if until := a.LastFailureAt.Add(l.cfg.IPWindow); now.Before(until) {
+			return &LockedError{Until: until}
+		}
+	}
+
+	return nil
+}
+
+// lockedUntil returns the end of the lockout of the account attempts
+func (l *Lockout) lockedUntil(a *Attempts) time.Time {
+	if a == nil || a.Failures < l.cfg.MaxFailures {
+		return time.Time{}
+	}
+
+	d := l.cfg.MaxDuration
+	if n := a.Failures - l.cfg.MaxFailures; n < 32 {
+		if exp := l.cfg.Duration << n; exp > 0 && exp < d {
+			d = exp
+		}
+	}
+
+	return a.LastFailureAt.Add(d)
+}
+
+// Fail records a failed login of the account of the email from the IP
+func (l *Lockout) Fail(ctx context.Context, email, ip string) error {
+	now := TimeNow()
+
+	_, err := l.attempts.Fail(ctx, accountKey(email), now, l.cfg.ResetAfter)
+	if err != nil {
+		return err
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	_, err = l.attempts.Fail(ctx, ipKey(ip), now, l.cfg.IPWindow)
+
+	return err
+}
+
+// Unlock forgets the failed logins of the account of the email, the failures
+// of the IPs are kept, so a successful login does not reset the IP throttling
+func (l *Lockout) Unlock(ctx context.Context, email string) error {
+	return l.attempts.Reset(ctx, accountKey(email))
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx with the IP of the client, used to
+// throttle the IPs failing too many logins
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the IP of the client set by WithClientIP
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,168 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mem"
+	"github.com/cadicallegari/user/mock"
+)
+
+func Test_Lockout(t *testing.T) {
+	now := time.Now().UTC()
+
+	defer func(now func() time.Time) { user.TimeNow = now }(user.TimeNow)
+	user.TimeNow = func() time.Time { return now }
+
+	ctx := context.TODO()
+	l := user.NewLockout(mem.NewAttemptStorage(), &user.LockoutConfig{
+		MaxFailures: 3,
+		Duration:    time.Minute,
+		MaxDuration: 3 * time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, l.Fail(ctx, "email@mail.com", ""))
+		require.NoError(t, l.Check(ctx, "email@mail.com", ""))
+	}
+
+	// the lockout is doubled by each failure, up to MaxDuration
+	for _, d := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		require.NoError(t, l.Fail(ctx, "email@mail.com", ""))
+
+		err := l.Check(ctx, "EMAIL@mail.com", "")
+		require.ErrorIs(t, err, user.ErrLocked)
+
+		var locked *user.LockedError
+		require.ErrorAs(t, err, &locked)
+		require.Equal(t, now.Add(d), locked.Until)
+	}
+
+	require.NoError(t, l.Check(ctx, "other@mail.com", ""))
+
+	now = now.Add(3 * time.Minute)
+	require.NoError(t, l.Check(ctx, "email@mail.com", ""))
+
+	require.NoError(t, l.Unlock(ctx, "email@mail.com"))
+	require.NoError(t, l.Fail(ctx, "email@mail.com", ""))
+	require.NoError(t, l.Check(ctx, "email@mail.com", ""))
+}
+
+func Test_Lockout_IP(t *testing.T) {
+	now := time.Now().UTC()
+
+	defer func(now func() time.Time) { user.TimeNow = now }(user.TimeNow)
+	user.TimeNow = func() time.Time { return now }
+
+	ctx := context.TODO()
+	l := user.NewLockout(mem.NewAttemptStorage(), &user.LockoutConfig{
+		IPMaxFailures: 2,
+		IPWindow:      time.Minute,
+	})
+
+	require.NoError(t, l.Fail(ctx, "a@mail.com", "10.0.0.1"))
+	require.NoError(t, l.Fail(ctx, "b@mail.com", "10.0.0.1"))
+
+	// any account from the IP is throttled
+	require.ErrorIs(t, l.Check(ctx, "c@mail.com", "10.0.0.1"), user.ErrLocked)
+	require.NoError(t, l.Check(ctx, "c@mail.com", "10.0.0.2"))
+
+	// unlocking the account does not reset the IP
+	require.NoError(t, l.Unlock(ctx, "a@mail.com"))
+	require.ErrorIs(t, l.Check(ctx, "a@mail.com", "10.0.0.1"), user.ErrLocked)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, l.Check(ctx, "c@mail.com", "10.0.0.1"))
+}
+
+func Test_Lockout_Expire(t *testing.T) {
+	now := time.Now().UTC()
+
+	defer func(now func() time.Time) { user.TimeNow = now }(user.TimeNow)
+	user.TimeNow = func() time.Time { return now }
+
+	ctx := context.TODO()
+	attempts := mem.NewAttemptStorage()
+	l := user.NewLockout(attempts, &user.LockoutConfig{
+		MaxFailures: 1,
+		Duration:    2 * time.Hour,
+		MaxDuration: 2 * time.Hour,
+		ResetAfter:  time.Hour,
+		IPWindow:    time.Minute,
+	})
+
+	// random emails from the same IP
+	for _, email := range []string{"a@mail.com", "b@mail.com", "c@mail.com"} {
+		require.NoError(t, l.Fail(ctx, email, "10.0.0.1"))
+	}
+
+	n, err := l.Expire(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// the IP window passed, the accounts are still locked
+	now = now.Add(time.Hour + time.Minute)
+
+	n, err = l.Expire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.ErrorIs(t, l.Check(ctx, "a@mail.com", ""), user.ErrLocked)
+
+	now = now.Add(time.Hour)
+
+	n, err = l.Expire(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+
+	for _, key := range []string{"account:a@mail.com", "ip:10.0.0.1"} {
+		a, err := attempts.Get(ctx, key)
+		require.NoError(t, err)
+		require.Nil(t, a)
+	}
+}
+
+func Test_Authenticate_Locked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	usr := &user.User{ID: "id", Email: "email", EncodedPassword: string(encoded)}
+
+	// the locked logins do not reach the storage
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{usr}}, nil).
+		Times(3)
+
+	mockStorage.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, usr).
+		Return(nil)
+
+	lockout := user.NewLockout(mem.NewAttemptStorage(), &user.LockoutConfig{MaxFailures: 2})
+	svc := user.NewService(mockStorage, 4, user.WithLockout(lockout))
+
+	ctx := user.WithClientIP(context.TODO(), "10.0.0.1")
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.Authenticate(ctx, usr.Email, "wrong")
+		require.ErrorIs(t, err, user.ErrInvalidCredentials)
+	}
+
+	_, err = svc.Authenticate(ctx, usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrLocked)
+
+	require.NoError(t, svc.Unlock(ctx, usr))
+
+	gotUser, err := svc.Authenticate(ctx, usr.Email, "passwd")
+	require.NoError(t, err)
+	require.Equal(t, usr.ID, gotUser.ID)
+}
@@ -0,0 +1,76 @@
+package mem
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cadicallegari/user"
+)
+
+type AttemptStorage struct {
+	mu       sync.Mutex
+	attempts map[string]*user.Attempts
+}
+
+func NewAttemptStorage() *AttemptStorage {
+	return &AttemptStorage{
+		attempts: make(map[string]*user.Attempts),
+	}
+}
+
+func (s *AttemptStorage) Get(_ context.Context, key string) (*user.Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+
+	got := *a
+	return &got, nil
+}
+
+func (s *AttemptStorage) Fail(_ context.Context, key string, at time.Time, window time.Duration) (*user.Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || a.LastFailureAt.Before(at.Add(-window)) {
+		a = &user.Attempts{Key: key, FirstFailureAt: at}
+		s.attempts[key] = a
+	}
+
+	a.Failures++
+	a.LastFailureAt = at
+
+	got := *a
+	return &got, nil
+}
+
+func (s *AttemptStorage) Reset(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *AttemptStorage) Expire(_ context.Context, prefix string, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired int
+
+	for key, a := range s.attempts {
+		if strings.HasPrefix(key, prefix) && a.LastFailureAt.Before(before) {
+			delete(s.attempts, key)
+			expired++
+		}
+	}
+
+	return expired, nil
+}
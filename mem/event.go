@@ -27,3 +27,28 @@ func (s *memEventService) UserDeleted(context.Context, *user.User) error {
 	// publish into user.deleted topic for example
 	return nil
 }
+
+func (s *memEventService) UserRestored(context.Context, *user.User) error {
+	// publish into user.restored topic for example
+	return nil
+}
+
+func (s *memEventService) UserPurged(context.Context, *user.User) error {
+	// publish into user.purged topic for example
+	return nil
+}
+
+func (s *memEventService) UserLoggedIn(context.Context, *user.User) error {
+	// publish into user.logged_in topic for example
+	return nil
+}
+
+func (s *memEventService) UserEmailVerified(context.Context, *user.User) error {
+	// publish into user.email_verified topic for example
+	return nil
+}
+
+func (s *memEventService) UserEmailChanged(context.Context, *user.EmailChange) error {
+	// publish into user.email_changed topic for example
+	return nil
+}
@@ -0,0 +1,101 @@
+package mem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cadicallegari/user"
+)
+
+type OutboxStorage struct {
+	mu     sync.Mutex
+	seq    uint64
+	events []*user.Event
+}
+
+func NewOutbox() *OutboxStorage {
+	return &OutboxStorage{
+		events: make([]*user.Event, 0),
+	}
+}
+
+func (s *OutboxStorage) add(typ string, usr *user.User) error {
+	evt, err := user.NewEvent(typ, usr)
+	if err != nil {
+		return err
+	}
+
+	s.save(evt)
+
+	return nil
+}
+
+func (s *OutboxStorage) save(evt *user.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	now := TimeNow()
+
+	evt.ID = s.seq
+	evt.CreatedAt = now
+	evt.NextAttemptAt = now
+
+	s.events = append(s.events, evt)
+}
+
+func (s *OutboxStorage) Fetch(_ context.Context, limit int) ([]*user.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := TimeNow()
+	seen := make(map[string]bool)
+	events := make([]*user.Event, 0)
+
+	for _, evt := range s.events {
+		if len(events) >= limit {
+			break
+		}
+
+		// only the head of each user queue, to keep the events ordered
+		head := !seen[evt.UserID]
+		seen[evt.UserID] = true
+
+		if head && !evt.NextAttemptAt.After(now) {
+			e := *evt
+			events = append(events, &e)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *OutboxStorage) Ack(_ context.Context, evt *user.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, e := range s.events {
+		if e.ID == evt.ID {
+			s.events = append(s.events[:i], s.events[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *OutboxStorage) Retry(_ context.Context, evt *user.Event, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.events {
+		if e.ID == evt.ID {
+			e.Attempts++
+			e.NextAttemptAt = next
+			break
+		}
+	}
+
+	return nil
+}
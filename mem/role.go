@@ -0,0 +1,95 @@
+package mem
+
+import (
+	"context"
+	"sort"
+
+	"github.com/cadicallegari/user"
+)
+
+func (s *UserStorage) Roles(_ context.Context) ([]*user.Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := make([]*user.Role, 0, len(s.roles))
+	for _, r := range s.roles {
+		roles = append(roles, &user.Role{
+			Name:        r.Name,
+			Permissions: append([]string{}, r.Permissions...),
+		})
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+
+	return roles, nil
+}
+
+func (s *UserStorage) GrantRole(_ context.Context, userID, role string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	if _, ok := s.roles[role]; !ok {
+		return nil, user.ErrInvalid
+	}
+
+	for _, r := range current.Roles {
+		// granting a role twice does not change the user
+		if r == role {
+			return clone(current), nil
+		}
+	}
+
+	updated := clone(current)
+	updated.Roles = append(updated.Roles, role)
+	sort.Strings(updated.Roles)
+	updated.Version++
+
+	err := s.addEvent(user.EventUserUpdated, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[updated.ID] = updated
+
+	return clone(updated), nil
+}
+
+func (s *UserStorage) RevokeRole(_ context.Context, userID, role string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	updated := clone(current)
+	updated.Roles = updated.Roles[:0]
+	for _, r := range current.Roles {
+		if r != role {
+			updated.Roles = append(updated.Roles, r)
+		}
+	}
+
+	if len(updated.Roles) == len(current.Roles) {
+		return updated, nil
+	}
+
+	updated.Version++
+
+	err := s.addEvent(user.EventUserUpdated, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[updated.ID] = updated
+
+	return clone(updated), nil
+}
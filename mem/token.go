@@ -0,0 +1,156 @@
+package mem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cadicallegari/user"
+)
+
+type TokenStorage struct {
+	mu            sync.Mutex
+	tokens        map[string]*user.RefreshToken
+	verifications map[string]*user.VerificationToken
+}
+
+func NewTokenStorage() *TokenStorage {
+	return &TokenStorage{
+		tokens:        make(map[string]*user.RefreshToken),
+		verifications: make(map[string]*user.VerificationToken),
+	}
+}
+
+func (s *TokenStorage) SaveRefreshToken(_ context.Context, rt *user.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *rt
+	s.tokens[rt.Hash] = &saved
+
+	return nil
+}
+
+func (s *TokenStorage) GetRefreshToken(_ context.Context, hash string) (*user.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[hash]
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	got := *rt
+	return &got, nil
+}
+
+func (s *TokenStorage) RevokeRefreshToken(_ context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.tokens[hash]
+	if !ok || rt.RevokedAt != nil {
+		return user.ErrNotFound
+	}
+
+	now := TimeNow()
+	rt.RevokedAt = &now
+
+	return nil
+}
+
+func (s *TokenStorage) RevokeRefreshTokens(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := TimeNow()
+
+	for _, rt := range s.tokens {
+		if rt.UserID == userID && rt.RevokedAt == nil {
+			revokedAt := now
+			rt.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) SaveVerificationToken(_ context.Context, vt *user.VerificationToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *vt
+	s.verifications[vt.Hash] = &saved
+
+	return nil
+}
+
+func (s *TokenStorage) UseVerificationToken(_ context.Context, hash, purpose string) (*user.VerificationToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vt, ok := s.verifications[hash]
+	if !ok || vt.Purpose != purpose || vt.UsedAt != nil {
+		return nil, user.ErrNotFound
+	}
+
+	now := TimeNow()
+	vt.UsedAt = &now
+
+	got := *vt
+	return &got, nil
+}
+
+func (s *TokenStorage) GetVerificationToken(_ context.Context, hash string) (*user.VerificationToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vt, ok := s.verifications[hash]
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	got := *vt
+	return &got, nil
+}
+
+// resetPassword uses the password reset token of the user and revokes the refresh
+// tokens of the user, it returns ErrNotFound for unknown, used or other users tokens
+func (s *TokenStorage) resetPassword(userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vt, ok := s.verifications[hash]
+	if !ok || vt.UserID != userID || vt.Purpose != user.PurposePasswordReset || vt.UsedAt != nil {
+		return user.ErrNotFound
+	}
+
+	now := TimeNow()
+	vt.UsedAt = &now
+
+	for _, rt := range s.tokens {
+		if rt.UserID == userID && rt.RevokedAt == nil {
+			revokedAt := now
+			rt.RevokedAt = &revokedAt
+		}
+	}
+
+	return nil
+}
+
+// deleteUser removes the tokens of the purged user
+func (s *TokenStorage) deleteUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, rt := range s.tokens {
+		if rt.UserID == userID {
+			delete(s.tokens, hash)
+		}
+	}
+
+	for hash, vt := range s.verifications {
+		if vt.UserID == userID {
+			delete(s.verifications, hash)
+		}
+	}
+}
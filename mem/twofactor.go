@@ -0,0 +1,141 @@
+package mem
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cadicallegari/user"
+)
+
+type recoveryCode struct {
+	userID string
+	used   bool
+}
+
+type TwoFactorStorage struct {
+	mu         sync.Mutex
+	twoFactors map[string]*user.TwoFactor
+	// recoveryCodes are indexed by hash
+	recoveryCodes map[string]*recoveryCode
+}
+
+func NewTwoFactorStorage() *TwoFactorStorage {
+	return &TwoFactorStorage{
+		twoFactors:    make(map[string]*user.TwoFactor),
+		recoveryCodes: make(map[string]*recoveryCode),
+	}
+}
+
+func (s *TwoFactorStorage) SaveTwoFactor(_ context.Context, tf *user.TwoFactor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *tf
+	s.twoFactors[tf.UserID] = &saved
+
+	return nil
+}
+
+func (s *TwoFactorStorage) GetTwoFactor(_ context.Context, userID string) (*user.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactors[userID]
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	got := *tf
+	return &got, nil
+}
+
+func (s *TwoFactorStorage) ConfirmTwoFactor(_ context.Context, userID string, step int64, recoveryHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactors[userID]
+	if !ok || tf.ConfirmedAt != nil {
+		return user.ErrNotFound
+	}
+
+	now := TimeNow()
+	tf.ConfirmedAt = &now
+	tf.LastStep = step
+
+	s.deleteRecoveryCodes(userID)
+	for _, hash := range recoveryHashes {
+		s.recoveryCodes[hash] = &recoveryCode{userID: userID}
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseTwoFactorStep(_ context.Context, userID string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactors[userID]
+	if !ok || step <= tf.LastStep {
+		return user.ErrNotFound
+	}
+
+	tf.LastStep = step
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseRecoveryCode(_ context.Context, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rc, ok := s.recoveryCodes[hash]
+	if !ok || rc.userID != userID || rc.used {
+		return user.ErrNotFound
+	}
+
+	rc.used = true
+
+	return nil
+}
+
+func (s *TwoFactorStorage) DeleteTwoFactor(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.twoFactors, userID)
+	s.deleteRecoveryCodes(userID)
+
+	return nil
+}
+
+func (s *TwoFactorStorage) CountTwoFactors(_ context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, tf := range s.twoFactors {
+		if tf.ConfirmedAt != nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// deleteUser removes the two-factor of the purged user
+func (s *TwoFactorStorage) deleteUser(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.twoFactors, userID)
+	s.deleteRecoveryCodes(userID)
+}
+
+// deleteRecoveryCodes must be called holding the lock
+func (s *TwoFactorStorage) deleteRecoveryCodes(userID string) {
+	for hash, rc := range s.recoveryCodes {
+		if rc.userID == userID {
+			delete(s.recoveryCodes, hash)
+		}
+	}
+}
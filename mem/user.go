@@ -0,0 +1,554 @@
+package mem
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/cadicallegari/user"
+)
+
+// UserStorage keeps the users in memory, it follows the same semantics
+// of mysql.UserStorage and is meant for local runs and tests
+type UserStorage struct {
+	mu    sync.RWMutex
+	users map[string]*user.User
+	roles map[string]*user.Role
+
+	outbox *OutboxStorage
+	// tokens and twoFactors have the data of the users removed by the purge
+	tokens     *TokenStorage
+	twoFactors *TwoFactorStorage
+}
+
+var TimeNow = func() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// NewStorage creates an in memory storage, the changes are recorded
+// in the given outbox when it is not nil
+func NewStorage(outbox *OutboxStorage) *UserStorage {
+	roles := make(map[string]*user.Role, len(user.DefaultRoles))
+	for _, r := range user.DefaultRoles {
+		roles[r.Name] = r
+	}
+
+	return &UserStorage{
+		users:  make(map[string]*user.User),
+		roles:  roles,
+		outbox: outbox,
+	}
+}
+
+// Cascade makes the purge remove the tokens and two-factors of the users as well,
+// and the password reset use the token, as the other storages do in their transactions
+func (s *UserStorage) Cascade(tokens *TokenStorage, twoFactors *TwoFactorStorage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = tokens
+	s.twoFactors = twoFactors
+}
+
+// clone returns a copy of the stored user, so the callers can not change it
+func clone(u *user.User) *user.User {
+	c := *u
+	c.Roles = append([]string{}, u.Roles...)
+
+	return &c
+}
+
+func validateUser(u *user.User) error {
+	verr := new(user.ValidationError)
+	verr.Required("id", u.ID)
+	verr.Required("first_name", u.FirstName)
+	verr.Required("email", u.Email)
+	verr.Required("password", u.EncodedPassword)
+	verr.Required("country", u.Country)
+
+	return verr.Err()
+}
+
+// active returns the stored user unless it is deleted
+func (s *UserStorage) active(id string) (*user.User, bool) {
+	u, ok := s.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, false
+	}
+
+	return u, true
+}
+
+// emailTaken reports if an active user other than the given one has the email,
+// the deleted users do not hold their emails
+func (s *UserStorage) emailTaken(userID, email string) bool {
+	for _, u := range s.users {
+		if u.ID != userID && u.DeletedAt == nil && strings.EqualFold(u.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *UserStorage) addEvent(typ string, usr *user.User) error {
+	if s.outbox == nil {
+		return nil
+	}
+
+	return s.outbox.add(typ, usr)
+}
+
+func match(u *user.User, opts *user.ListOptions) bool {
+	if u.DeletedAt != nil && !opts.IncludeDeleted {
+		return false
+	}
+
+	if countries := opts.Countries(); len(countries) > 0 {
+		found := false
+		for _, c := range countries {
+			found = found || strings.EqualFold(u.Country, c)
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if opts.Email != "" && !strings.EqualFold(u.Email, opts.Email) {
+		return false
+	}
+
+	if opts.Nickname != "" && !strings.EqualFold(u.Nickname, opts.Nickname) {
+		return false
+	}
+
+	if opts.Search != "" {
+		term := strings.ToLower(opts.Search)
+		found := false
+		for _, field := range []string{u.FirstName, u.LastName, u.Nickname, u.Email} {
+			found = found || strings.Contains(strings.ToLower(field), term)
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !opts.CreatedAfter.IsZero() && !u.CreatedAt.After(opts.CreatedAfter) {
+		return false
+	}
+
+	if !opts.CreatedBefore.IsZero() && !u.CreatedAt.Before(opts.CreatedBefore) {
+		return false
+	}
+
+	if !opts.UpdatedSince.IsZero() && u.UpdatedAt.Before(opts.UpdatedSince) {
+		return false
+	}
+
+	return true
+}
+
+// less orders the users by the sort fields
+func less(fields []user.SortField, a, b *user.User) bool {
+	for _, f := range fields {
+		if c := f.Compare(a, b); c != 0 {
+			return c < 0
+		}
+	}
+
+	return false
+}
+
+func (s *UserStorage) List(_ context.Context, opts *user.ListOptions) (*user.List, error) {
+	if opts.PerPage == 0 {
+		opts.PerPage = user.DefaultPerPage
+	}
+
+	// there is no full text index, the search modes use the substring search
+	if !user.ValidSearchMode(opts.SearchMode) {
+		return nil, user.ErrInvalid
+	}
+
+	fields, err := user.ParseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor *user.User
+	if opts.Cursor != "" {
+		values, err := user.ParseCursor(opts.Cursor, fields)
+		if err != nil {
+			return nil, err
+		}
+		cursor = user.CursorUser(fields, values)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	filtered := make([]*user.User, 0)
+	for _, u := range s.users {
+		if match(u, opts) {
+			filtered = append(filtered, u)
+		}
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return less(fields, filtered[i], filtered[j])
+	})
+
+	list := new(user.List)
+	list.Users = make([]*user.User, 0)
+
+	var start uint64
+	if cursor == nil {
+		list.Total = uint64(len(filtered))
+		start = opts.Page * opts.PerPage
+	} else {
+		start = uint64(sort.Search(len(filtered), func(i int) bool {
+			return less(fields, cursor, filtered[i])
+		}))
+	}
+
+	for i := start; i < uint64(len(filtered)) && i < start+opts.PerPage; i++ {
+		list.Users = append(list.Users, clone(filtered[i]))
+	}
+
+	hasNext := uint64(len(filtered)) > start+opts.PerPage
+
+	// the page numbers are kept for backwards compatibility
+	if cursor == nil {
+		if opts.Page > 0 {
+			prev := opts.Page - 1
+			list.PrevPage = &prev
+		}
+
+		if hasNext {
+			next := opts.Page + 1
+			list.NextPage = &next
+		}
+	}
+
+	if hasNext {
+		list.NextCursor = user.NewCursor(fields, list.Users[len(list.Users)-1])
+	}
+
+	return list, nil
+}
+
+func (s *UserStorage) Save(_ context.Context, usr *user.User) (*user.User, error) {
+	if usr.ID == "" {
+		usr.ID = uuid.NewString()
+	}
+
+	err := validateUser(usr)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[usr.ID]; ok {
+		return nil, user.ErrAlreadyExists
+	}
+
+	if s.emailTaken(usr.ID, usr.Email) {
+		return nil, user.ErrAlreadyExists
+	}
+
+	now := TimeNow()
+
+	saved := &user.User{
+		ID:              usr.ID,
+		FirstName:       usr.FirstName,
+		LastName:        usr.LastName,
+		Nickname:        usr.Nickname,
+		Email:           usr.Email,
+		EncodedPassword: usr.EncodedPassword,
+		Country:         usr.Country,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Version:         1,
+		Roles:           []string{},
+	}
+
+	err = s.addEvent(user.EventUserCreated, saved)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[saved.ID] = saved
+
+	return clone(saved), nil
+}
+
+func (s *UserStorage) Update(_ context.Context, usr *user.User) (*user.User, error) {
+	if usr.ID == "" {
+		return nil, user.ErrInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(usr.ID)
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	if usr.Version != 0 && usr.Version != current.Version {
+		return nil, user.ErrConflict
+	}
+
+	updated := clone(current)
+	updated.FirstName = usr.FirstName
+	updated.LastName = usr.LastName
+	updated.Nickname = usr.Nickname
+	updated.Country = usr.Country
+	updated.UpdatedAt = TimeNow()
+	updated.Version++
+
+	if usr.EncodedPassword != "" {
+		updated.EncodedPassword = usr.EncodedPassword
+	}
+
+	err := s.addEvent(user.EventUserUpdated, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[updated.ID] = updated
+
+	return clone(updated), nil
+}
+
+// SetPassword does not record an event, the users do not change when their
+// passwords are rehashed, but as any write it increments the version
+func (s *UserStorage) SetPassword(_ context.Context, userID, encodedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok {
+		return user.ErrNotFound
+	}
+
+	updated := clone(current)
+	updated.EncodedPassword = encodedPassword
+	updated.Version++
+	s.users[userID] = updated
+
+	return nil
+}
+
+// ResetPassword needs the token storage given to Cascade,
+// without it the tokens are unknown
+func (s *UserStorage) ResetPassword(_ context.Context, userID, tokenHash, encodedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok || s.tokens == nil {
+		return user.ErrNotFound
+	}
+
+	// the token is used holding the lock of the users, as in a transaction
+	err := s.tokens.resetPassword(userID, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	updated := clone(current)
+	updated.EncodedPassword = encodedPassword
+	updated.Version++
+	s.users[userID] = updated
+
+	return nil
+}
+
+func (s *UserStorage) VerifyEmail(_ context.Context, userID, email string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok || current.Email != email {
+		return nil, user.ErrNotFound
+	}
+
+	if current.EmailVerifiedAt != nil {
+		return clone(current), nil
+	}
+
+	now := TimeNow()
+
+	updated := clone(current)
+	updated.EmailVerifiedAt = &now
+	updated.UpdatedAt = now
+	updated.Version++
+
+	err := s.addEvent(user.EventUserEmailVerified, updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[userID] = updated
+
+	return clone(updated), nil
+}
+
+func (s *UserStorage) ChangeEmail(_ context.Context, userID, email string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(userID)
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	// already changed
+	if current.Email == email {
+		return clone(current), nil
+	}
+
+	if s.emailTaken(userID, email) {
+		return nil, user.ErrAlreadyExists
+	}
+
+	now := TimeNow()
+
+	updated := clone(current)
+	updated.Email = email
+	// the email was confirmed by the token sent to it
+	updated.EmailVerifiedAt = &now
+	updated.UpdatedAt = now
+	updated.Version++
+
+	if s.outbox != nil {
+		evt, err := user.NewEmailChangedEvent(updated, current.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		s.outbox.save(evt)
+	}
+
+	s.users[userID] = updated
+
+	return clone(updated), nil
+}
+
+func (s *UserStorage) Get(_ context.Context, id string) (*user.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current, ok := s.active(id)
+	if !ok {
+		return nil, user.ErrNotFound
+	}
+
+	return clone(current), nil
+}
+
+func (s *UserStorage) Delete(_ context.Context, usr *user.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.active(usr.ID)
+	if !ok {
+		return user.ErrNotFound
+	}
+
+	if usr.Version != 0 && usr.Version != current.Version {
+		return user.ErrConflict
+	}
+
+	now := TimeNow()
+
+	deleted := clone(current)
+	deleted.DeletedAt = &now
+	deleted.UpdatedAt = now
+	deleted.Version++
+
+	err := s.addEvent(user.EventUserDeleted, deleted)
+	if err != nil {
+		return err
+	}
+
+	s.users[usr.ID] = deleted
+
+	return nil
+}
+
+func (s *UserStorage) Restore(_ context.Context, userID string) (*user.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[userID]
+	if !ok || current.DeletedAt == nil {
+		return nil, user.ErrNotFound
+	}
+
+	// another active user took the email meanwhile
+	if s.emailTaken(userID, current.Email) {
+		return nil, user.ErrAlreadyExists
+	}
+
+	restored := clone(current)
+	restored.DeletedAt = nil
+	restored.UpdatedAt = TimeNow()
+	restored.Version++
+
+	err := s.addEvent(user.EventUserRestored, restored)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users[userID] = restored
+
+	return clone(restored), nil
+}
+
+func (s *UserStorage) Purge(_ context.Context, deletedBefore time.Time, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int
+
+	for id, u := range s.users {
+		if purged >= limit {
+			break
+		}
+
+		if u.DeletedAt == nil || !u.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		err := s.addEvent(user.EventUserPurged, u)
+		if err != nil {
+			return purged, err
+		}
+
+		delete(s.users, id)
+		if s.tokens != nil {
+			s.tokens.deleteUser(id)
+		}
+		if s.twoFactors != nil {
+			s.twoFactors.deleteUser(id)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *UserStorage) AddEvent(_ context.Context, typ string, usr *user.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addEvent(typ, usr)
+}
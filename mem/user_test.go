@@ -0,0 +1,140 @@
+package mem_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mem"
+	"github.com/cadicallegari/user/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) user.Storage {
+		return mem.NewStorage(nil)
+	})
+}
+
+func TestStorages(t *testing.T) {
+	storagetest.RunStorages(t, func(t *testing.T) *storagetest.Storages {
+		tokens := mem.NewTokenStorage()
+		twoFactors := mem.NewTwoFactorStorage()
+
+		s := mem.NewStorage(nil)
+		s.Cascade(tokens, twoFactors)
+
+		return &storagetest.Storages{Users: s, Tokens: tokens, TwoFactors: twoFactors}
+	})
+}
+
+func Test_Outbox(t *testing.T) {
+	outbox := mem.NewOutbox()
+	s := mem.NewStorage(outbox)
+
+	u, err := s.Save(context.TODO(), &user.User{
+		FirstName:       "first",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	require.NoError(t, err)
+
+	err = s.AddEvent(context.TODO(), user.EventUserLoggedIn, u)
+	require.NoError(t, err)
+
+	u.FirstName = "updated"
+	u, err = s.Update(context.TODO(), u)
+	require.NoError(t, err)
+
+	err = s.Delete(context.TODO(), u)
+	require.NoError(t, err)
+
+	// failed changes are not recorded
+	err = s.Delete(context.TODO(), u)
+	require.ErrorIs(t, err, user.ErrNotFound)
+
+	u, err = s.Restore(context.TODO(), u.ID)
+	require.NoError(t, err)
+
+	err = s.Delete(context.TODO(), u)
+	require.NoError(t, err)
+
+	n, err := s.Purge(context.TODO(), time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	wantTypes := []string{
+		user.EventUserCreated,
+		user.EventUserLoggedIn,
+		user.EventUserUpdated,
+		user.EventUserDeleted,
+		user.EventUserRestored,
+		user.EventUserDeleted,
+		user.EventUserPurged,
+	}
+	for _, typ := range wantTypes {
+		events, err := outbox.Fetch(context.TODO(), 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, typ, events[0].Type)
+		require.Equal(t, u.ID, events[0].UserID)
+		require.NoError(t, outbox.Ack(context.TODO(), events[0]))
+	}
+
+	events, err := outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func Test_Outbox_EmailChanged(t *testing.T) {
+	outbox := mem.NewOutbox()
+	s := mem.NewStorage(outbox)
+
+	u, err := s.Save(context.TODO(), &user.User{
+		FirstName:       "first",
+		Email:           "old@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	require.NoError(t, err)
+
+	_, err = s.ChangeEmail(context.TODO(), u.ID, "new@mail.com")
+	require.NoError(t, err)
+
+	events, err := outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Ack(context.TODO(), events[0]))
+
+	events, err = outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, user.EventUserEmailChanged, events[0].Type)
+
+	var change user.EmailChange
+	require.NoError(t, json.Unmarshal(events[0].Payload, &change))
+	require.Equal(t, "old@mail.com", change.OldEmail)
+	require.Equal(t, "new@mail.com", change.NewEmail)
+	require.Equal(t, u.ID, change.ID)
+}
+
+func TestTokenStorage(t *testing.T) {
+	storagetest.RunTokens(t, func(t *testing.T) user.TokenStorage {
+		return mem.NewTokenStorage()
+	})
+}
+
+func TestAttemptStorage(t *testing.T) {
+	storagetest.RunAttempts(t, func(t *testing.T) user.AttemptStorage {
+		return mem.NewAttemptStorage()
+	})
+}
+
+func TestTwoFactorStorage(t *testing.T) {
+	storagetest.RunTwoFactors(t, func(t *testing.T) user.TwoFactorStorage {
+		return mem.NewTwoFactorStorage()
+	})
+}
@@ -63,6 +63,76 @@ func (mr *EventServiceMockRecorder) UserDeleted(arg0, arg1 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserDeleted", reflect.TypeOf((*EventService)(nil).UserDeleted), arg0, arg1)
 }
 
+// UserEmailChanged mocks base method.
+func (m *EventService) UserEmailChanged(arg0 context.Context, arg1 *user.EmailChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserEmailChanged", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UserEmailChanged indicates an expected call of UserEmailChanged.
+func (mr *EventServiceMockRecorder) UserEmailChanged(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserEmailChanged", reflect.TypeOf((*EventService)(nil).UserEmailChanged), arg0, arg1)
+}
+
+// UserEmailVerified mocks base method.
+func (m *EventService) UserEmailVerified(arg0 context.Context, arg1 *user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserEmailVerified", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UserEmailVerified indicates an expected call of UserEmailVerified.
+func (mr *EventServiceMockRecorder) UserEmailVerified(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserEmailVerified", reflect.TypeOf((*EventService)(nil).UserEmailVerified), arg0, arg1)
+}
+
+// UserLoggedIn mocks base method.
+func (m *EventService) UserLoggedIn(arg0 context.Context, arg1 *user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserLoggedIn", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UserLoggedIn indicates an expected call of UserLoggedIn.
+func (mr *EventServiceMockRecorder) UserLoggedIn(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserLoggedIn", reflect.TypeOf((*EventService)(nil).UserLoggedIn), arg0, arg1)
+}
+
+// UserPurged mocks base method.
+func (m *EventService) UserPurged(arg0 context.Context, arg1 *user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserPurged", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UserPurged indicates an expected call of UserPurged.
+func (mr *EventServiceMockRecorder) UserPurged(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserPurged", reflect.TypeOf((*EventService)(nil).UserPurged), arg0, arg1)
+}
+
+// UserRestored mocks base method.
+func (m *EventService) UserRestored(arg0 context.Context, arg1 *user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserRestored", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UserRestored indicates an expected call of UserRestored.
+func (mr *EventServiceMockRecorder) UserRestored(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserRestored", reflect.TypeOf((*EventService)(nil).UserRestored), arg0, arg1)
+}
+
 // UserUpdated mocks base method.
 func (m *EventService) UserUpdated(arg0 context.Context, arg1 *user.User) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,80 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/cadicallegari/user (interfaces: Outbox)
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	user "github.com/cadicallegari/user"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// Outbox is a mock of Outbox interface.
+type Outbox struct {
+	ctrl     *gomock.Controller
+	recorder *OutboxMockRecorder
+}
+
+// OutboxMockRecorder is the mock recorder for Outbox.
+type OutboxMockRecorder struct {
+	mock *Outbox
+}
+
+// NewOutbox creates a new mock instance.
+func NewOutbox(ctrl *gomock.Controller) *Outbox {
+	mock := &Outbox{ctrl: ctrl}
+	mock.recorder = &OutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Outbox) EXPECT() *OutboxMockRecorder {
+	return m.recorder
+}
+
+// Ack mocks base method.
+func (m *Outbox) Ack(arg0 context.Context, arg1 *user.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ack", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack.
+func (mr *OutboxMockRecorder) Ack(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*Outbox)(nil).Ack), arg0, arg1)
+}
+
+// Fetch mocks base method.
+func (m *Outbox) Fetch(arg0 context.Context, arg1 int) ([]*user.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", arg0, arg1)
+	ret0, _ := ret[0].([]*user.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *OutboxMockRecorder) Fetch(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*Outbox)(nil).Fetch), arg0, arg1)
+}
+
+// Retry mocks base method.
+func (m *Outbox) Retry(arg0 context.Context, arg1 *user.Event, arg2 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Retry", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Retry indicates an expected call of Retry.
+func (mr *OutboxMockRecorder) Retry(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Retry", reflect.TypeOf((*Outbox)(nil).Retry), arg0, arg1, arg2)
+}
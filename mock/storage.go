@@ -7,6 +7,7 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	user "github.com/cadicallegari/user"
 	gomock "github.com/golang/mock/gomock"
@@ -35,6 +36,35 @@ func (m *Storage) EXPECT() *StorageMockRecorder {
 	return m.recorder
 }
 
+// AddEvent mocks base method.
+func (m *Storage) AddEvent(arg0 context.Context, arg1 string, arg2 *user.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddEvent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddEvent indicates an expected call of AddEvent.
+func (mr *StorageMockRecorder) AddEvent(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddEvent", reflect.TypeOf((*Storage)(nil).AddEvent), arg0, arg1, arg2)
+}
+
+// ChangeEmail mocks base method.
+func (m *Storage) ChangeEmail(arg0 context.Context, arg1, arg2 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeEmail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangeEmail indicates an expected call of ChangeEmail.
+func (mr *StorageMockRecorder) ChangeEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeEmail", reflect.TypeOf((*Storage)(nil).ChangeEmail), arg0, arg1, arg2)
+}
+
 // Delete mocks base method.
 func (m *Storage) Delete(arg0 context.Context, arg1 *user.User) error {
 	m.ctrl.T.Helper()
@@ -64,6 +94,21 @@ func (mr *StorageMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*Storage)(nil).Get), arg0, arg1)
 }
 
+// GrantRole mocks base method.
+func (m *Storage) GrantRole(arg0 context.Context, arg1, arg2 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantRole", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GrantRole indicates an expected call of GrantRole.
+func (mr *StorageMockRecorder) GrantRole(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantRole", reflect.TypeOf((*Storage)(nil).GrantRole), arg0, arg1, arg2)
+}
+
 // List mocks base method.
 func (m *Storage) List(arg0 context.Context, arg1 *user.ListOptions) (*user.List, error) {
 	m.ctrl.T.Helper()
@@ -79,6 +124,80 @@ func (mr *StorageMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*Storage)(nil).List), arg0, arg1)
 }
 
+// Purge mocks base method.
+func (m *Storage) Purge(arg0 context.Context, arg1 time.Time, arg2 int) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *StorageMockRecorder) Purge(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*Storage)(nil).Purge), arg0, arg1, arg2)
+}
+
+// ResetPassword mocks base method.
+func (m *Storage) ResetPassword(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *StorageMockRecorder) ResetPassword(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*Storage)(nil).ResetPassword), arg0, arg1, arg2, arg3)
+}
+
+// Restore mocks base method.
+func (m *Storage) Restore(arg0 context.Context, arg1 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Restore", arg0, arg1)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Restore indicates an expected call of Restore.
+func (mr *StorageMockRecorder) Restore(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Restore", reflect.TypeOf((*Storage)(nil).Restore), arg0, arg1)
+}
+
+// RevokeRole mocks base method.
+func (m *Storage) RevokeRole(arg0 context.Context, arg1, arg2 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRole", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeRole indicates an expected call of RevokeRole.
+func (mr *StorageMockRecorder) RevokeRole(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRole", reflect.TypeOf((*Storage)(nil).RevokeRole), arg0, arg1, arg2)
+}
+
+// Roles mocks base method.
+func (m *Storage) Roles(arg0 context.Context) ([]*user.Role, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Roles", arg0)
+	ret0, _ := ret[0].([]*user.Role)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Roles indicates an expected call of Roles.
+func (mr *StorageMockRecorder) Roles(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Roles", reflect.TypeOf((*Storage)(nil).Roles), arg0)
+}
+
 // Save mocks base method.
 func (m *Storage) Save(arg0 context.Context, arg1 *user.User) (*user.User, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +213,20 @@ func (mr *StorageMockRecorder) Save(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*Storage)(nil).Save), arg0, arg1)
 }
 
+// SetPassword mocks base method.
+func (m *Storage) SetPassword(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPassword", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPassword indicates an expected call of SetPassword.
+func (mr *StorageMockRecorder) SetPassword(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPassword", reflect.TypeOf((*Storage)(nil).SetPassword), arg0, arg1, arg2)
+}
+
 // Update mocks base method.
 func (m *Storage) Update(arg0 context.Context, arg1 *user.User) (*user.User, error) {
 	m.ctrl.T.Helper()
@@ -108,3 +241,18 @@ func (mr *StorageMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*Storage)(nil).Update), arg0, arg1)
 }
+
+// VerifyEmail mocks base method.
+func (m *Storage) VerifyEmail(arg0 context.Context, arg1, arg2 string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *StorageMockRecorder) VerifyEmail(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*Storage)(nil).VerifyEmail), arg0, arg1, arg2)
+}
@@ -0,0 +1,137 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/cadicallegari/user (interfaces: TokenStorage)
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	reflect "reflect"
+
+	user "github.com/cadicallegari/user"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// TokenStorage is a mock of TokenStorage interface.
+type TokenStorage struct {
+	ctrl     *gomock.Controller
+	recorder *TokenStorageMockRecorder
+}
+
+// TokenStorageMockRecorder is the mock recorder for TokenStorage.
+type TokenStorageMockRecorder struct {
+	mock *TokenStorage
+}
+
+// NewTokenStorage creates a new mock instance.
+func NewTokenStorage(ctrl *gomock.Controller) *TokenStorage {
+	mock := &TokenStorage{ctrl: ctrl}
+	mock.recorder = &TokenStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *TokenStorage) EXPECT() *TokenStorageMockRecorder {
+	return m.recorder
+}
+
+// GetRefreshToken mocks base method.
+func (m *TokenStorage) GetRefreshToken(arg0 context.Context, arg1 string) (*user.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(*user.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRefreshToken indicates an expected call of GetRefreshToken.
+func (mr *TokenStorageMockRecorder) GetRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefreshToken", reflect.TypeOf((*TokenStorage)(nil).GetRefreshToken), arg0, arg1)
+}
+
+// GetVerificationToken mocks base method.
+func (m *TokenStorage) GetVerificationToken(arg0 context.Context, arg1 string) (*user.VerificationToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVerificationToken", arg0, arg1)
+	ret0, _ := ret[0].(*user.VerificationToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVerificationToken indicates an expected call of GetVerificationToken.
+func (mr *TokenStorageMockRecorder) GetVerificationToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVerificationToken", reflect.TypeOf((*TokenStorage)(nil).GetVerificationToken), arg0, arg1)
+}
+
+// RevokeRefreshToken mocks base method.
+func (m *TokenStorage) RevokeRefreshToken(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshToken indicates an expected call of RevokeRefreshToken.
+func (mr *TokenStorageMockRecorder) RevokeRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshToken", reflect.TypeOf((*TokenStorage)(nil).RevokeRefreshToken), arg0, arg1)
+}
+
+// RevokeRefreshTokens mocks base method.
+func (m *TokenStorage) RevokeRefreshTokens(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokens", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokens indicates an expected call of RevokeRefreshTokens.
+func (mr *TokenStorageMockRecorder) RevokeRefreshTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokens", reflect.TypeOf((*TokenStorage)(nil).RevokeRefreshTokens), arg0, arg1)
+}
+
+// SaveRefreshToken mocks base method.
+func (m *TokenStorage) SaveRefreshToken(arg0 context.Context, arg1 *user.RefreshToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRefreshToken indicates an expected call of SaveRefreshToken.
+func (mr *TokenStorageMockRecorder) SaveRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRefreshToken", reflect.TypeOf((*TokenStorage)(nil).SaveRefreshToken), arg0, arg1)
+}
+
+// SaveVerificationToken mocks base method.
+func (m *TokenStorage) SaveVerificationToken(arg0 context.Context, arg1 *user.VerificationToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveVerificationToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveVerificationToken indicates an expected call of SaveVerificationToken.
+func (mr *TokenStorageMockRecorder) SaveVerificationToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveVerificationToken", reflect.TypeOf((*TokenStorage)(nil).SaveVerificationToken), arg0, arg1)
+}
+
+// UseVerificationToken mocks base method.
+func (m *TokenStorage) UseVerificationToken(arg0 context.Context, arg1, arg2 string) (*user.VerificationToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseVerificationToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*user.VerificationToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseVerificationToken indicates an expected call of UseVerificationToken.
+func (mr *TokenStorageMockRecorder) UseVerificationToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseVerificationToken", reflect.TypeOf((*TokenStorage)(nil).UseVerificationToken), arg0, arg1, arg2)
+}
@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type AttemptStorage struct {
+	db *sqlx.DB
+}
+
+func NewAttemptStorage(db *sqlx.DB) *AttemptStorage {
+	return &AttemptStorage{
+		db: db,
+	}
+}
+
+func (s *AttemptStorage) Get(ctx context.Context, key string) (*user.Attempts, error) {
+	q := sq.Select(
+		"a.attempt_key",
+		"a.failures",
+		"a.first_failure_at",
+		"a.last_failure_at",
+	).
+		From("login_attempts a").
+		Where(sq.Eq{"a.attempt_key": key})
+
+	query, args := q.MustSql()
+
+	var a user.Attempts
+
+	err := sqlx.GetContext(ctx, s.db, &a, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *AttemptStorage) Fail(ctx context.Context, key string, at time.Time, window time.Duration) (*user.Attempts, error) {
+	expired := at.Add(-window)
+
+	// the upsert is atomic, the concurrent failures are all counted.
+	// The assignments run in order, last_failure_at is replaced last
+	q := sq.Insert("login_attempts").
+		Columns(
+			"attempt_key",
+			"failures",
+			"first_failure_at",
+			"last_failure_at",
+		).
+		Values(key, 1, at, at).
+		Suffix(`ON DUPLICATE KEY UPDATE
+			failures = IF(last_failure_at < ?, 1, failures + 1),
+			first_failure_at = IF(last_failure_at < ?, VALUES(first_failure_at), first_failure_at),
+			last_failure_at = VALUES(last_failure_at)`, expired, expired)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to save login attempt")
+		return nil, err
+	}
+
+	return s.Get(ctx, key)
+}
+
+func (s *AttemptStorage) Reset(ctx context.Context, key string) error {
+	_, err := sq.Delete("login_attempts").
+		Where(sq.Eq{"attempt_key": key}).
+		RunWith(s.db).
+		ExecContext(ctx)
+
+	return err
+}
+
+func (s *AttemptStorage) Expire(ctx context.Context, prefix string, before time.Time) (int, error) {
+	res, err := sq.Delete("login_attempts").
+		Where(sq.Like{"attempt_key": prefix + "%"}).
+		Where(sq.Lt{"last_failure_at": before}).
+		RunWith(s.db).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+
+	return int(n), err
+}
@@ -0,0 +1,12 @@
+CREATE TABLE `outbox_events` (
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `type` VARCHAR(100) NOT NULL,
+    `user_id` VARCHAR(100) NOT NULL,
+    `payload` JSON NOT NULL,
+    `attempts` INT UNSIGNED NOT NULL DEFAULT 0,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    `next_attempt_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    PRIMARY KEY (`id`),
+    INDEX (`user_id`, `id`),
+    INDEX (`next_attempt_at`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
@@ -0,0 +1 @@
+ALTER TABLE `users` ADD FULLTEXT INDEX `users_search` (`first_name`, `last_name`, `nickname`, `email`);
@@ -0,0 +1,11 @@
+CREATE TABLE `refresh_tokens` (
+    `id` VARCHAR(100) NOT NULL,
+    `user_id` VARCHAR(100) NOT NULL,
+    `token_hash` CHAR(64) NOT NULL,
+    `expires_at` TIMESTAMP(6) NOT NULL,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    `revoked_at` TIMESTAMP(6) NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE (`token_hash`),
+    INDEX (`user_id`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
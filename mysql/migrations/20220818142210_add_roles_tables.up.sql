@@ -0,0 +1,27 @@
+CREATE TABLE `roles` (
+    `name` VARCHAR(100) NOT NULL,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    PRIMARY KEY (`name`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
+
+CREATE TABLE `role_permissions` (
+    `role` VARCHAR(100) NOT NULL,
+    `permission` VARCHAR(100) NOT NULL,
+    PRIMARY KEY (`role`, `permission`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
+
+CREATE TABLE `user_roles` (
+    `user_id` VARCHAR(100) NOT NULL,
+    `role` VARCHAR(100) NOT NULL,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    PRIMARY KEY (`user_id`, `role`),
+    INDEX (`role`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
+
+INSERT INTO `roles` (`name`) VALUES ('admin'), ('support');
+
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+    ('admin', 'users:admin'),
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('support', 'users:read');
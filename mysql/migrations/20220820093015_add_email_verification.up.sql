@@ -0,0 +1,15 @@
+ALTER TABLE `users` ADD COLUMN `email_verified_at` TIMESTAMP(6) NULL DEFAULT NULL;
+
+CREATE TABLE `verification_tokens` (
+    `id` VARCHAR(100) NOT NULL,
+    `user_id` VARCHAR(100) NOT NULL,
+    `purpose` VARCHAR(50) NOT NULL,
+    `email` VARCHAR(200) NOT NULL,
+    `token_hash` CHAR(64) NOT NULL,
+    `expires_at` TIMESTAMP(6) NOT NULL,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    `used_at` TIMESTAMP(6) NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE (`token_hash`),
+    INDEX (`user_id`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
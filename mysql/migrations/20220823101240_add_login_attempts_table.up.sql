@@ -0,0 +1,7 @@
+CREATE TABLE `login_attempts` (
+    `attempt_key` VARCHAR(255) NOT NULL,
+    `failures` INT NOT NULL,
+    `first_failure_at` TIMESTAMP(6) NOT NULL,
+    `last_failure_at` TIMESTAMP(6) NOT NULL,
+    PRIMARY KEY (`attempt_key`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
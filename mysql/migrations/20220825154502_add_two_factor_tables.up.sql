@@ -0,0 +1,15 @@
+CREATE TABLE `two_factors` (
+    `user_id` VARCHAR(100) NOT NULL,
+    `secret` VARCHAR(255) NOT NULL,
+    `last_step` BIGINT NOT NULL DEFAULT 0,
+    `created_at` TIMESTAMP(6) NOT NULL DEFAULT current_timestamp(6),
+    `confirmed_at` TIMESTAMP(6) NULL DEFAULT NULL,
+    PRIMARY KEY (`user_id`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
+
+CREATE TABLE `two_factor_recovery_codes` (
+    `user_id` VARCHAR(100) NOT NULL,
+    `code_hash` CHAR(64) NOT NULL,
+    `used_at` TIMESTAMP(6) NULL DEFAULT NULL,
+    PRIMARY KEY (`user_id`, `code_hash`)
+) ENGINE=InnoDB CHARSET=utf8 COLLATE utf8_general_ci;
@@ -0,0 +1,2 @@
+ALTER TABLE `users` DROP INDEX `users_deleted_at_idx`;
+ALTER TABLE `users` DROP COLUMN `deleted_at`;
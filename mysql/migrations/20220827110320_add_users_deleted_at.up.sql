@@ -0,0 +1,2 @@
+ALTER TABLE `users` ADD COLUMN `deleted_at` TIMESTAMP(6) NULL DEFAULT NULL;
+ALTER TABLE `users` ADD INDEX `users_deleted_at_idx` (`deleted_at`);
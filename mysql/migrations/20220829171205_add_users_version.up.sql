@@ -0,0 +1 @@
+ALTER TABLE `users` ADD COLUMN `version` BIGINT UNSIGNED NOT NULL DEFAULT 1;
@@ -0,0 +1 @@
+ALTER TABLE `login_attempts` DROP INDEX `login_attempts_last_failure_at`;
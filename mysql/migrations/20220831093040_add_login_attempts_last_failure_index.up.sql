@@ -0,0 +1 @@
+ALTER TABLE `login_attempts` ADD INDEX `login_attempts_last_failure_at` (`last_failure_at`);
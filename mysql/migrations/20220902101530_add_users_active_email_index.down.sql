@@ -0,0 +1,4 @@
+-- fails while a deleted user has the email of an active one
+ALTER TABLE `users` ADD UNIQUE INDEX `email` (`email`);
+ALTER TABLE `users` DROP INDEX `users_active_email`;
+ALTER TABLE `users` DROP COLUMN `active_email`;
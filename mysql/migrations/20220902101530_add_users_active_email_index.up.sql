@@ -0,0 +1,5 @@
+-- the deleted users keep their rows until purged, only the emails of the
+-- active users are unique, the generated column is NULL for the deleted ones
+ALTER TABLE `users` ADD COLUMN `active_email` VARCHAR(100) AS (IF(`deleted_at` IS NULL, `email`, NULL)) VIRTUAL;
+ALTER TABLE `users` ADD UNIQUE INDEX `users_active_email` (`active_email`);
+ALTER TABLE `users` DROP INDEX `email`;
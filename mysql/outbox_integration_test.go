@@ -0,0 +1,132 @@
+//go:build integration
+
+package mysql_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mysql"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xmysqltest"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type OutboxStorageSuite struct {
+	xmysqltest.MysqlTestSuite
+	storage *mysql.UserStorage
+	outbox  *mysql.OutboxStorage
+	ctx     context.Context
+}
+
+func TestOutboxStorage(t *testing.T) {
+	suite.Run(t, new(OutboxStorageSuite))
+}
+
+func (s *OutboxStorageSuite) SetupTest() {
+	mysqlURL := os.Getenv("USER_MYSQL_URL")
+	if mysqlURL == "" {
+		s.FailNow("envvar USER_MYSQL_URL is empty or missing")
+	}
+
+	s.MysqlTestSuite.SetupTest(mysqlURL, os.Getenv("USER_MYSQL_MIGRATIONS_DIR"))
+
+	s.storage = mysql.NewStorage(s.DB)
+	s.outbox = mysql.NewOutbox(s.DB)
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", "test"))
+}
+
+func (s *OutboxStorageSuite) Test_Fetch_Empty() {
+	events, err := s.outbox.Fetch(s.ctx, 10)
+	if s.NoError(err) {
+		s.Empty(events)
+	}
+}
+
+func (s *OutboxStorageSuite) Test_Changes_AreRecorded() {
+	u, err := s.storage.Save(s.ctx, &user.User{
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.Require().NoError(err)
+
+	u.FirstName = "updated"
+	u, err = s.storage.Update(s.ctx, u)
+	s.Require().NoError(err)
+
+	err = s.storage.Delete(s.ctx, u)
+	s.Require().NoError(err)
+
+	_, err = s.storage.Purge(s.ctx, time.Now().Add(time.Hour), 10)
+	s.Require().NoError(err)
+
+	wantTypes := []string{
+		user.EventUserCreated,
+		user.EventUserUpdated,
+		user.EventUserDeleted,
+		user.EventUserPurged,
+	}
+
+	for _, typ := range wantTypes {
+		events, err := s.outbox.Fetch(s.ctx, 10)
+		s.Require().NoError(err)
+
+		// only the oldest event of the user is ready
+		if s.Len(events, 1) {
+			s.Equal(typ, events[0].Type)
+			s.Equal(u.ID, events[0].UserID)
+			s.NoError(s.outbox.Ack(s.ctx, events[0]))
+		}
+	}
+
+	events, err := s.outbox.Fetch(s.ctx, 10)
+	if s.NoError(err) {
+		s.Empty(events)
+	}
+}
+
+func (s *OutboxStorageSuite) Test_Retry_BlocksUserQueue() {
+	u, err := s.storage.Save(s.ctx, &user.User{
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.Require().NoError(err)
+
+	_, err = s.storage.Update(s.ctx, u)
+	s.Require().NoError(err)
+
+	events, err := s.outbox.Fetch(s.ctx, 10)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+
+	err = s.outbox.Retry(s.ctx, events[0], time.Now().Add(time.Hour))
+	s.Require().NoError(err)
+
+	events, err = s.outbox.Fetch(s.ctx, 10)
+	if s.NoError(err) {
+		s.Empty(events)
+	}
+}
+
+func (s *OutboxStorageSuite) Test_AddEvent() {
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	err := s.storage.AddEvent(s.ctx, user.EventUserLoggedIn, u)
+	s.Require().NoError(err)
+
+	events, err := s.outbox.Fetch(s.ctx, 10)
+	if s.NoError(err) && s.Len(events, 1) {
+		s.Equal(user.EventUserLoggedIn, events[0].Type)
+		s.Equal(u.ID, events[0].UserID)
+	}
+}
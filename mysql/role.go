@@ -0,0 +1,188 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cadicallegari/user"
+)
+
+func (s *UserStorage) Roles(ctx context.Context) ([]*user.Role, error) {
+	q := sq.Select("r.name", "p.permission").
+		From("roles r").
+		LeftJoin("role_permissions p ON p.role = r.name").
+		OrderBy("r.name", "p.permission")
+
+	rows, err := q.RunWith(s.db).QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]*user.Role, 0)
+
+	for rows.Next() {
+		var (
+			name       string
+			permission sql.NullString
+		)
+		if err := rows.Scan(&name, &permission); err != nil {
+			return nil, err
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].Name != name {
+			roles = append(roles, &user.Role{Name: name, Permissions: []string{}})
+		}
+
+		if permission.Valid {
+			r := roles[len(roles)-1]
+			r.Permissions = append(r.Permissions, permission.String)
+		}
+	}
+
+	return roles, rows.Err()
+}
+
+func (s *UserStorage) GrantRole(ctx context.Context, userID, role string) (*user.User, error) {
+	var updated *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		var n int
+		err := sq.Select("COUNT(*)").From("roles").Where(sq.Eq{"name": role}).
+			RunWith(tx).QueryRowContext(ctx).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return user.ErrInvalid
+		}
+
+		res, err := sq.Insert("user_roles").
+			Options("IGNORE").
+			Columns("user_id", "role").
+			Values(userID, role).
+			RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		// granting a role twice does not change the user
+		if n, _ := res.RowsAffected(); n == 0 {
+			updated, err = get(ctx, tx, userID)
+			return err
+		}
+
+		if err := incrementVersion(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		updated, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserUpdated, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (s *UserStorage) RevokeRole(ctx context.Context, userID, role string) (*user.User, error) {
+	var updated *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		res, err := sq.Delete("user_roles").
+			Where(sq.Eq{"user_id": userID, "role": role}).
+			RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			updated, err = get(ctx, tx, userID)
+			return err
+		}
+
+		if err := incrementVersion(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		updated, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserUpdated, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// loadRoles sets the roles of the users, the users without roles get an empty list
+func loadRoles(ctx context.Context, db sqlx.QueryerContext, users ...*user.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*user.User, len(users))
+	ids := make([]string, 0, len(users))
+
+	for _, u := range users {
+		u.Roles = []string{}
+		byID[u.ID] = u
+		ids = append(ids, u.ID)
+	}
+
+	q := sq.Select("ur.user_id", "ur.role").
+		From("user_roles ur").
+		Where(sq.Eq{"ur.user_id": ids}).
+		OrderBy("ur.role")
+
+	query, args := q.MustSql()
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, role string
+		if err := rows.Scan(&id, &role); err != nil {
+			return err
+		}
+
+		if u, ok := byID[id]; ok {
+			u.Roles = append(u.Roles, role)
+		}
+	}
+
+	return rows.Err()
+}
+
+// incrementVersion changes the version of the user, as the roles are part of the user
+func incrementVersion(ctx context.Context, tx *sqlx.Tx, userID string) error {
+	_, err := sq.Update("users").
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"id": userID}).
+		RunWith(tx).ExecContext(ctx)
+
+	return err
+}
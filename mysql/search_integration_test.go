@@ -0,0 +1,130 @@
+//go:build integration
+
+package mysql_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mysql"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xmysqltest"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type SearchSuite struct {
+	xmysqltest.MysqlTestSuite
+	storage *mysql.UserStorage
+	ctx     context.Context
+
+	users []*user.User
+}
+
+func TestSearch(t *testing.T) {
+	suite.Run(t, new(SearchSuite))
+}
+
+func (s *SearchSuite) SetupTest() {
+	mysqlURL := os.Getenv("USER_MYSQL_URL")
+	if mysqlURL == "" {
+		s.FailNow("envvar USER_MYSQL_URL is empty or missing")
+	}
+
+	s.MysqlTestSuite.SetupTest(mysqlURL, os.Getenv("USER_MYSQL_MIGRATIONS_DIR"))
+
+	s.storage = mysql.NewStorage(s.DB)
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", "test"))
+
+	s.users = nil
+	for _, u := range []*user.User{
+		{FirstName: "Alice", LastName: "Chains", Nickname: "layne", Email: "alice@chains.com"},
+		{FirstName: "Alice", LastName: "Cooper", Nickname: "vincent", Email: "vincent@cooper.com"},
+		{FirstName: "Jerry", LastName: "Cantrell", Nickname: "alice", Email: "jerry@alice.com"},
+		{FirstName: "Chris", LastName: "Cornell", Nickname: "soundgarden", Email: "chris@cornell.com"},
+	} {
+		u.EncodedPassword = "encoded"
+		u.Country = "US"
+
+		saved, err := s.storage.Save(s.ctx, u)
+		s.Require().NoError(err)
+
+		s.users = append(s.users, saved)
+	}
+}
+
+func (s *SearchSuite) ids(users []*user.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.ID)
+	}
+
+	return ids
+}
+
+func (s *SearchSuite) Test_Natural() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "alice chains", SearchMode: user.SearchModeNatural})
+	s.Require().NoError(err)
+
+	s.Equal(3, int(lr.Total))
+	s.Require().Len(lr.Users, 3)
+
+	// the user matching both words is the most relevant
+	s.Equal(s.users[0].ID, lr.Users[0].ID)
+	s.ElementsMatch(s.ids(s.users[:3]), s.ids(lr.Users))
+
+	for i, u := range lr.Users {
+		s.Greater(u.Score, 0.0)
+		if i > 0 {
+			s.LessOrEqual(u.Score, lr.Users[i-1].Score)
+		}
+	}
+}
+
+func (s *SearchSuite) Test_Boolean() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "+alice -chains -cooper", SearchMode: user.SearchModeBoolean})
+	s.Require().NoError(err)
+
+	s.Equal([]string{s.users[2].ID}, s.ids(lr.Users))
+	s.Greater(lr.Users[0].Score, 0.0)
+}
+
+func (s *SearchSuite) Test_Boolean_Prefix() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "corn*", SearchMode: user.SearchModeBoolean})
+	s.Require().NoError(err)
+
+	s.Equal([]string{s.users[3].ID}, s.ids(lr.Users))
+}
+
+func (s *SearchSuite) Test_Cursor() {
+	opts := &user.ListOptions{Search: "alice", SearchMode: user.SearchModeNatural, PerPage: 1}
+
+	all, err := s.storage.List(s.ctx, &user.ListOptions{Search: opts.Search, SearchMode: opts.SearchMode})
+	s.Require().NoError(err)
+
+	got := make([]*user.User, 0)
+	for {
+		lr, err := s.storage.List(s.ctx, opts)
+		s.Require().NoError(err)
+
+		got = append(got, lr.Users...)
+		if lr.NextCursor == "" {
+			break
+		}
+		opts.Cursor = lr.NextCursor
+	}
+
+	s.Equal(s.ids(all.Users), s.ids(got))
+}
+
+func (s *SearchSuite) Test_Substring_WithoutMode() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "ornel"})
+	s.Require().NoError(err)
+
+	s.Equal([]string{s.users[3].ID}, s.ids(lr.Users))
+	s.Zero(lr.Users[0].Score)
+}
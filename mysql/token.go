@@ -0,0 +1,207 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type TokenStorage struct {
+	db *sqlx.DB
+}
+
+func NewTokenStorage(db *sqlx.DB) *TokenStorage {
+	return &TokenStorage{
+		db: db,
+	}
+}
+
+func (s *TokenStorage) SaveRefreshToken(ctx context.Context, rt *user.RefreshToken) error {
+	q := sq.Insert("refresh_tokens").
+		Columns(
+			"id",
+			"user_id",
+			"token_hash",
+			"expires_at",
+			"created_at",
+		).
+		Values(
+			rt.ID,
+			rt.UserID,
+			rt.Hash,
+			rt.ExpiresAt,
+			rt.CreatedAt,
+		)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to save refresh token")
+		return err
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) GetRefreshToken(ctx context.Context, hash string) (*user.RefreshToken, error) {
+	q := sq.Select(
+		"t.id",
+		"t.user_id",
+		"t.token_hash",
+		"t.expires_at",
+		"t.created_at",
+		"t.revoked_at",
+	).
+		From("refresh_tokens t").
+		Where(sq.Eq{"t.token_hash": hash})
+
+	query, args := q.MustSql()
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rt user.RefreshToken
+
+	for rows.Next() {
+		err := rows.StructScan(&rt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if rt.ID == "" {
+		return nil, user.ErrNotFound
+	}
+
+	return &rt, nil
+}
+
+func (s *TokenStorage) RevokeRefreshToken(ctx context.Context, hash string) error {
+	q := sq.Update("refresh_tokens").
+		Set("revoked_at", TimeNow()).
+		Where(sq.Eq{"token_hash": hash, "revoked_at": nil})
+
+	res, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokens revokes all the refresh tokens of the user
+func (s *TokenStorage) RevokeRefreshTokens(ctx context.Context, userID string) error {
+	q := sq.Update("refresh_tokens").
+		Set("revoked_at", TimeNow()).
+		Where(sq.Eq{"user_id": userID, "revoked_at": nil})
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to revoke refresh tokens")
+		return err
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) SaveVerificationToken(ctx context.Context, vt *user.VerificationToken) error {
+	q := sq.Insert("verification_tokens").
+		Columns(
+			"id",
+			"user_id",
+			"purpose",
+			"email",
+			"token_hash",
+			"expires_at",
+			"created_at",
+		).
+		Values(
+			vt.ID,
+			vt.UserID,
+			vt.Purpose,
+			vt.Email,
+			vt.Hash,
+			vt.ExpiresAt,
+			vt.CreatedAt,
+		)
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to save verification token")
+		return err
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) UseVerificationToken(ctx context.Context, hash, purpose string) (*user.VerificationToken, error) {
+	// the update is atomic, a concurrent use of the same token fails
+	res, err := sq.Update("verification_tokens").
+		Set("used_at", TimeNow()).
+		Where(sq.Eq{"token_hash": hash, "purpose": purpose, "used_at": nil}).
+		RunWith(s.db).
+		ExecContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, user.ErrNotFound
+	}
+
+	return s.GetVerificationToken(ctx, hash)
+}
+
+func (s *TokenStorage) GetVerificationToken(ctx context.Context, hash string) (*user.VerificationToken, error) {
+	q := sq.Select(
+		"t.id",
+		"t.user_id",
+		"t.purpose",
+		"t.email",
+		"t.token_hash",
+		"t.expires_at",
+		"t.created_at",
+		"t.used_at",
+	).
+		From("verification_tokens t").
+		Where(sq.Eq{"t.token_hash": hash})
+
+	query, args := q.MustSql()
+
+	var vt user.VerificationToken
+
+	err := sqlx.GetContext(ctx, s.db, &vt, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &vt, nil
+}
@@ -2,10 +2,12 @@ package mysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
@@ -31,6 +33,9 @@ var baseSelect = sq.Select(
 	"u.country",
 	"u.created_at",
 	"u.updated_at",
+	"u.email_verified_at",
+	"u.deleted_at",
+	"u.version",
 ).From("users u")
 
 func NewStorage(db *sqlx.DB) *UserStorage {
@@ -40,11 +45,24 @@ func NewStorage(db *sqlx.DB) *UserStorage {
 }
 
 func validateUser(u *user.User) error {
-	if u.ID == "" || u.Email == "" || u.EncodedPassword == "" || u.Country == "" || u.FirstName == "" {
-		return user.ErrInvalid
+	verr := new(user.ValidationError)
+	verr.Required("id", u.ID)
+	verr.Required("first_name", u.FirstName)
+	verr.Required("email", u.Email)
+	verr.Required("password", u.EncodedPassword)
+	verr.Required("country", u.Country)
+
+	return verr.Err()
+}
+
+// isDuplicateEntry reports if err is the Error 1062: Duplicate entry for key
+func isDuplicateEntry(err error) bool {
+	var merr *mysqldriver.MySQLError
+	if errors.As(err, &merr) {
+		return merr.Number == 1062
 	}
 
-	return nil
+	return false
 }
 
 func (s *UserStorage) affectedRows(ctx context.Context, opts *user.ListOptions) chan uint64 {
@@ -75,16 +93,119 @@ func (s *UserStorage) affectedRows(ctx context.Context, opts *user.ListOptions)
 	return totalCh
 }
 
+// sortColumn returns the column of the sort field, the text columns
+// are compared using the case insensitive collation of the table
+func sortColumn(f user.SortField) string {
+	if f.Name == user.SortScore {
+		return "score"
+	}
+
+	return "u." + f.Name
+}
+
+func orderBy(fields []user.SortField) []string {
+	order := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			order = append(order, sortColumn(f)+" DESC")
+		} else {
+			order = append(order, sortColumn(f)+" ASC")
+		}
+	}
+
+	return order
+}
+
+// keyset returns the condition selecting the users after the cursor values
+func keyset(fields []user.SortField, values []interface{}, opts *user.ListOptions) sq.Or {
+	// the score alias can not be used in the where clause
+	column := func(f user.SortField) (string, []interface{}) {
+		if f.Name == user.SortScore {
+			return matchExpr(opts)
+		}
+		return sortColumn(f), nil
+	}
+
+	cond := sq.Or{}
+
+	for i, f := range fields {
+		and := sq.And{}
+		for j := 0; j < i; j++ {
+			col, args := column(fields[j])
+			and = append(and, sq.Expr(col+" = ?", append(args, values[j])...))
+		}
+
+		op := " > ?"
+		if f.Desc {
+			op = " < ?"
+		}
+		col, args := column(f)
+		and = append(and, sq.Expr(col+op, append(args, values[i])...))
+
+		cond = append(cond, and)
+	}
+
+	return cond
+}
+
+// fullText reports if the search ranks the users by relevance
+func fullText(opts *user.ListOptions) bool {
+	return opts.Search != "" && opts.SearchMode != ""
+}
+
+// matchExpr returns the relevance of the users for the search, the
+// columns must be the same of the users_search FULLTEXT index
+func matchExpr(opts *user.ListOptions) (string, []interface{}) {
+	mode := "NATURAL LANGUAGE MODE"
+	if opts.SearchMode == user.SearchModeBoolean {
+		mode = "BOOLEAN MODE"
+	}
+
+	return "MATCH (u.first_name, u.last_name, u.nickname, u.email) AGAINST (? IN " + mode + ")", []interface{}{opts.Search}
+}
+
 func buildFilterSelect(qOrigin sq.SelectBuilder, opts *user.ListOptions) sq.SelectBuilder {
-	q := qOrigin.
-		OrderBy("u.email ASC")
+	q := qOrigin
 
-	if opts.Country != "" {
-		q = q.Where(sq.Eq{"u.country": opts.Country})
+	if !opts.IncludeDeleted {
+		q = q.Where(sq.Eq{"u.deleted_at": nil})
 	}
 
-	if opts.Search != "" {
-		q = q.Where(sq.Like{"u.email": fmt.Sprint("%", opts.Search, "%")})
+	if countries := opts.Countries(); len(countries) > 0 {
+		q = q.Where(sq.Eq{"u.country": countries})
+	}
+
+	if opts.Email != "" {
+		q = q.Where(sq.Eq{"u.email": opts.Email})
+	}
+
+	if opts.Nickname != "" {
+		q = q.Where(sq.Eq{"u.nickname": opts.Nickname})
+	}
+
+	if fullText(opts) {
+		match, args := matchExpr(opts)
+		q = q.Where(match, args...)
+	} else if opts.Search != "" {
+		term := fmt.Sprint("%", opts.Search, "%")
+		q = q.Where(sq.Or{
+			sq.Like{"u.first_name": term},
+			sq.Like{"u.last_name": term},
+			sq.Like{"u.nickname": term},
+			sq.Like{"u.email": term},
+		})
+	}
+
+	if !opts.CreatedAfter.IsZero() {
+		q = q.Where(sq.Gt{"u.created_at": opts.CreatedAfter})
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		q = q.Where(sq.Lt{"u.created_at": opts.CreatedBefore})
+	}
+
+	if !opts.UpdatedSince.IsZero() {
+		q = q.Where(sq.GtOrEq{"u.updated_at": opts.UpdatedSince})
 	}
 
 	return q
@@ -95,11 +216,46 @@ func (s *UserStorage) List(ctx context.Context, opts *user.ListOptions) (*user.L
 		opts.PerPage = user.DefaultPerPage
 	}
 
-	totalCh := s.affectedRows(ctx, opts)
+	if !user.ValidSearchMode(opts.SearchMode) {
+		return nil, user.ErrInvalid
+	}
+
+	fields, err := user.ParseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
 
-	q := baseSelect.
-		Limit(uint64(opts.PerPage) + 1).
-		Offset(uint64(opts.Page * opts.PerPage))
+	q := baseSelect
+
+	// the most relevant users come first, the sort fields break the ties
+	if fullText(opts) {
+		match, args := matchExpr(opts)
+		q = q.Column(sq.Alias(sq.Expr(match, args...), "score"))
+		fields = append([]user.SortField{{Name: user.SortScore, Desc: true}}, fields...)
+	}
+
+	var cursor []interface{}
+	if opts.Cursor != "" {
+		cursor, err = user.ParseCursor(opts.Cursor, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var totalCh chan uint64
+	if cursor == nil {
+		totalCh = s.affectedRows(ctx, opts)
+	}
+
+	q = q.
+		OrderBy(orderBy(fields)...).
+		Limit(uint64(opts.PerPage) + 1)
+
+	if cursor == nil {
+		q = q.Offset(uint64(opts.Page * opts.PerPage))
+	} else {
+		q = q.Where(keyset(fields, cursor, opts))
+	}
 
 	q = buildFilterSelect(q, opts)
 
@@ -132,17 +288,28 @@ func (s *UserStorage) List(ctx context.Context, opts *user.ListOptions) (*user.L
 		return nil, err
 	}
 
-	list.Total = <-totalCh
+	// the page numbers are kept for backwards compatibility
+	if cursor == nil {
+		list.Total = <-totalCh
 
-	if opts.Page > 0 {
-		prev := opts.Page - 1
-		list.PrevPage = &prev
+		if opts.Page > 0 {
+			prev := opts.Page - 1
+			list.PrevPage = &prev
+		}
+
+		if len(list.Users) > int(opts.PerPage) {
+			next := opts.Page + 1
+			list.NextPage = &next
+		}
 	}
 
 	if len(list.Users) > int(opts.PerPage) {
-		next := opts.Page + 1
-		list.NextPage = &next
 		list.Users = list.Users[:len(list.Users)-1]
+		list.NextCursor = user.NewCursor(fields, list.Users[len(list.Users)-1])
+	}
+
+	if err := loadRoles(ctx, s.db, list.Users...); err != nil {
+		return nil, err
 	}
 
 	return list, nil
@@ -158,35 +325,52 @@ func (s *UserStorage) Save(ctx context.Context, usr *user.User) (*user.User, err
 		return nil, err
 	}
 
-	q := sq.Insert("users").
-		Columns(
-			"id",
-			"first_name",
-			"last_name",
-			"nickname",
-			"email",
-			"encoded_password",
-			"country",
-		).
-		Values(
-			usr.ID,
-			usr.FirstName,
-			usr.LastName,
-			usr.Nickname,
-			usr.Email,
-			usr.EncodedPassword,
-			usr.Country,
-		)
-	_, err = q.RunWith(s.db).ExecContext(ctx)
+	var saved *user.User
+
+	err = withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Insert("users").
+			Columns(
+				"id",
+				"first_name",
+				"last_name",
+				"nickname",
+				"email",
+				"encoded_password",
+				"country",
+			).
+			Values(
+				usr.ID,
+				usr.FirstName,
+				usr.LastName,
+				usr.Nickname,
+				usr.Email,
+				usr.EncodedPassword,
+				usr.Country,
+			)
+		_, err := q.RunWith(tx).ExecContext(ctx)
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to save user")
+			return err
+		}
+
+		saved, err = get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserCreated, saved)
+	})
 	if err != nil {
-		xlogger.Logger(ctx).
-			WithField("query", sq.DebugSqlizer(q)).
-			WithError(err).
-			Error("unable to save user")
 		return nil, err
 	}
 
-	return s.Get(ctx, usr.ID)
+	return saved, nil
 }
 
 func (s *UserStorage) Update(ctx context.Context, usr *user.User) (*user.User, error) {
@@ -194,35 +378,222 @@ func (s *UserStorage) Update(ctx context.Context, usr *user.User) (*user.User, e
 		return nil, user.ErrInvalid
 	}
 
+	var updated *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("first_name", usr.FirstName).
+			Set("last_name", usr.LastName).
+			Set("nickname", usr.Nickname).
+			Set("country", usr.Country).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": usr.ID, "deleted_at": nil})
+
+		if usr.EncodedPassword != "" {
+			q = q.Set("encoded_password", usr.EncodedPassword)
+		}
+
+		if usr.Version != 0 {
+			q = q.Where(sq.Eq{"version": usr.Version})
+		}
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to save user")
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			// unknown user or changed since the version
+			if _, err := get(ctx, tx, usr.ID); err != nil {
+				return err
+			}
+			return user.ErrConflict
+		}
+
+		updated, err = get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserUpdated, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// SetPassword does not record an event, the users do not change when their
+// passwords are rehashed, but as any write it increments the version
+func (s *UserStorage) SetPassword(ctx context.Context, userID, encodedPassword string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		return setPassword(ctx, tx, userID, encodedPassword)
+	})
+}
+
+func (s *UserStorage) ResetPassword(ctx context.Context, userID, tokenHash, encodedPassword string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		// the update is atomic, a concurrent reset with the same token fails
+		res, err := sq.Update("verification_tokens").
+			Set("used_at", TimeNow()).
+			Where(sq.Eq{
+				"token_hash": tokenHash,
+				"user_id":    userID,
+				"purpose":    user.PurposePasswordReset,
+				"used_at":    nil,
+			}).
+			RunWith(tx).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+
+		err = setPassword(ctx, tx, userID, encodedPassword)
+		if err != nil {
+			return err
+		}
+
+		_, err = sq.Update("refresh_tokens").
+			Set("revoked_at", TimeNow()).
+			Where(sq.Eq{"user_id": userID, "revoked_at": nil}).
+			RunWith(tx).
+			ExecContext(ctx)
+
+		return err
+	})
+}
+
+func setPassword(ctx context.Context, tx *sqlx.Tx, userID, encodedPassword string) error {
 	q := sq.Update("users").
-		Set("first_name", usr.FirstName).
-		Set("last_name", usr.LastName).
-		Set("nickname", usr.Nickname).
-		Set("country", usr.Country).
-		Where(sq.Eq{"id": usr.ID})
+		Set("encoded_password", encodedPassword).
+		Set("version", sq.Expr("version + 1")).
+		// the password is not a change of the profile, the updated_at is kept
+		Set("updated_at", sq.Expr("updated_at")).
+		Where(sq.Eq{"id": userID})
+
+	_, err := q.RunWith(tx).ExecContext(ctx)
+
+	return err
+}
+
+func (s *UserStorage) VerifyEmail(ctx context.Context, userID, email string) (*user.User, error) {
+	var verified *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("email_verified_at", TimeNow()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": userID, "email": email, "email_verified_at": nil})
 
-	if usr.EncodedPassword != "" {
-		q = q.Set("encoded_password", usr.EncodedPassword)
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		verified, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// the email was changed after the token was sent
+		if verified.Email != email {
+			return user.ErrNotFound
+		}
+
+		// already verified
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		return addEvent(ctx, tx, user.EventUserEmailVerified, verified)
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := q.RunWith(s.db).ExecContext(ctx)
+	return verified, nil
+}
+
+func (s *UserStorage) ChangeEmail(ctx context.Context, userID, email string) (*user.User, error) {
+	var changed *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		current, err := get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// already changed
+		if current.Email == email {
+			changed = current
+			return nil
+		}
+
+		q := sq.Update("users").
+			Set("email", email).
+			// the email was confirmed by the token sent to it
+			Set("email_verified_at", TimeNow()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": userID})
+
+		_, err = q.RunWith(tx).ExecContext(ctx)
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to change email")
+			return err
+		}
+
+		changed, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		evt, err := user.NewEmailChangedEvent(changed, current.Email)
+		if err != nil {
+			return err
+		}
+
+		return saveEvent(ctx, tx, evt)
+	})
 	if err != nil {
-		xlogger.Logger(ctx).
-			WithField("query", sq.DebugSqlizer(q)).
-			WithError(err).
-			Error("unable to save user")
 		return nil, err
 	}
 
-	return s.Get(ctx, usr.ID)
+	return changed, nil
 }
 
 func (s *UserStorage) Get(ctx context.Context, id string) (*user.User, error) {
-	q := baseSelect.Where(sq.Eq{"u.id": id})
+	return get(ctx, s.db, id)
+}
+
+func get(ctx context.Context, db sqlx.QueryerContext, id string) (*user.User, error) {
+	q := baseSelect.Where(sq.Eq{"u.id": id, "u.deleted_at": nil})
 
 	query, args := q.MustSql()
 
-	rows, err := s.db.QueryxContext(ctx, query, args...)
+	rows, err := db.QueryxContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -245,20 +616,178 @@ func (s *UserStorage) Get(ctx context.Context, id string) (*user.User, error) {
 		return nil, user.ErrNotFound
 	}
 
+	if err := loadRoles(ctx, db, &u); err != nil {
+		return nil, err
+	}
+
 	return &u, nil
 }
 
 func (s *UserStorage) Delete(ctx context.Context, usr *user.User) error {
-	q := sq.Delete("users").Where(sq.Eq{"id": usr.ID})
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		deleted, err := get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		now := TimeNow()
+
+		q := sq.Update("users").
+			Set("deleted_at", now).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", now).
+			Where(sq.Eq{"id": usr.ID, "deleted_at": nil})
+
+		if usr.Version != 0 {
+			q = q.Where(sq.Eq{"version": usr.Version})
+		}
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrConflict
+		}
+
+		deleted.DeletedAt = &now
+		deleted.UpdatedAt = now
+		deleted.Version++
+
+		return addEvent(ctx, tx, user.EventUserDeleted, deleted)
+	})
+}
+
+func (s *UserStorage) Restore(ctx context.Context, userID string) (*user.User, error) {
+	var restored *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("deleted_at", nil).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", TimeNow()).
+			Where(sq.Eq{"id": userID}).
+			Where(sq.NotEq{"deleted_at": nil})
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		// another active user took the email meanwhile
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+
+		restored, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserRestored, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	res, err := q.RunWith(s.db).ExecContext(ctx)
+	return restored, nil
+}
+
+// userTables have the rows keyed by the user ID, removed by the purge
+var userTables = []string{
+	"user_roles",
+	"refresh_tokens",
+	"verification_tokens",
+	"two_factors",
+	"two_factor_recovery_codes",
+}
+
+// Purge removes each user in its own transaction, the users restored or
+// purged by another instance meanwhile are skipped
+func (s *UserStorage) Purge(ctx context.Context, deletedBefore time.Time, limit int) (int, error) {
+	q := baseSelect.
+		Where(sq.Lt{"u.deleted_at": deletedBefore}).
+		OrderBy("u.deleted_at").
+		Limit(uint64(limit))
+
+	query, args := q.MustSql()
+
+	users := make([]*user.User, 0)
+
+	err := sqlx.SelectContext(ctx, s.db, &users, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := loadRoles(ctx, s.db, users...); err != nil {
+		return 0, err
+	}
+
+	var purged int
+
+	for _, u := range users {
+		err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+			q := sq.Delete("users").
+				Where(sq.Eq{"id": u.ID}).
+				Where(sq.Lt{"deleted_at": deletedBefore})
+
+			res, err := q.RunWith(tx).ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			if n, _ := res.RowsAffected(); n == 0 {
+				return user.ErrNotFound
+			}
+
+			// the tables have no foreign keys, the rows of the user are removed along
+			for _, table := range userTables {
+				_, err = sq.Delete(table).Where(sq.Eq{"user_id": u.ID}).RunWith(tx).ExecContext(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			return addEvent(ctx, tx, user.EventUserPurged, u)
+		})
+		if errors.Is(err, user.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *UserStorage) AddEvent(ctx context.Context, typ string, usr *user.User) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		return addEvent(ctx, tx, typ, usr)
+	})
+}
+
+// withTx runs fn inside a transaction of db, committing it if fn succeeds,
+// it is shared by the storages of the package
+func withTx(ctx context.Context, db *sqlx.DB, fn func(*sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	if n, _ := res.RowsAffected(); n == 0 {
-		err = user.ErrNotFound
+	err = fn(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			xlogger.Logger(ctx).WithError(rbErr).Error("unable to rollback transaction")
+		}
+		return err
 	}
 
-	return err
+	return tx.Commit()
 }
@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The rules a password breaks, see PasswordError
+const (
+	PasswordTooShort         = "too_short"
+	PasswordTooLong          = "too_long"
+	PasswordMissingLowercase = "missing_lowercase"
+	PasswordMissingUppercase = "missing_uppercase"
+	PasswordMissingDigit     = "missing_digit"
+	PasswordMissingSymbol    = "missing_symbol"
+	PasswordMatchesEmail     = "matches_email"
+	PasswordMatchesNickname  = "matches_nickname"
+	PasswordBreached         = "breached"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt uses, the rest is ignored
+const bcryptMaxLength = 72
+
+type PasswordConfig struct {
+	// MinLength is the minimum number of characters
+	MinLength int `envconfig:"MIN_LENGTH" default:"8"`
+	// MaxLength is the maximum number of bytes, the passwords longer
+	// than 72 bytes would be truncated by bcrypt
+	MaxLength        int  `envconfig:"MAX_LENGTH" default:"72"`
+	RequireLowercase bool `envconfig:"REQUIRE_LOWERCASE"`
+	RequireUppercase bool `envconfig:"REQUIRE_UPPERCASE"`
+	RequireDigit     bool `envconfig:"REQUIRE_DIGIT"`
+	RequireSymbol    bool `envconfig:"REQUIRE_SYMBOL"`
+	// BreachedFile is the Pwned Passwords SHA-1 list ordered by hash,
+	// see pkg/xpwned. The breached passwords are not checked when empty.
+	BreachedFile string `envconfig:"BREACHED_FILE"`
+}
+
+func (cfg *PasswordConfig) setDefault() {
+	if cfg.MinLength == 0 {
+		cfg.MinLength = 8
+	}
+	if cfg.MaxLength == 0 {
+		cfg.MaxLength = bcryptMaxLength
+	}
+}
+
+// PasswordError lists the rules the password breaks, it is an ErrInvalid
+type PasswordError struct {
+	Violations []string
+}
+
+func (e *PasswordError) Error() string {
+	return "invalid password: " + strings.Join(e.Violations, ", ")
+}
+
+func (e *PasswordError) Unwrap() error {
+	return ErrInvalid
+}
+
+// BreachedPasswords reports if a password is known to be leaked
+type BreachedPasswords interface {
+	Breached(_ context.Context, password string) (bool, error)
+}
+
+type PasswordPolicy struct {
+	breached BreachedPasswords
+
+	cfg *PasswordConfig
+}
+
+// NewPasswordPolicy creates the policy of the new passwords,
+// breached can be nil to skip the breached passwords check
+func NewPasswordPolicy(cfg *PasswordConfig, breached BreachedPasswords) *PasswordPolicy {
+	if cfg == nil {
+		cfg = new(PasswordConfig)
+	}
+	cfg.setDefault()
+
+	return &PasswordPolicy{
+		breached: breached,
+		cfg:      cfg,
+	}
+}
+
+// Validate returns a *PasswordError when the password of usr breaks the policy,
+// the password is compared to the email and nickname of usr
+func (p *PasswordPolicy) Validate(ctx context.Context, usr *User) error {
+	password := usr.Password
+	violations := make([]string, 0)
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		violations = append(violations, PasswordTooShort)
+	}
+
+	if len(password) > p.cfg.MaxLength {
+		violations = append(violations, PasswordTooLong)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if p.cfg.RequireLowercase && !lower {
+		violations = append(violations, PasswordMissingLowercase)
+	}
+	if p.cfg.RequireUppercase && !upper {
+		violations = append(violations, PasswordMissingUppercase)
+	}
+	if p.cfg.RequireDigit && !digit {
+		violations = append(violations, PasswordMissingDigit)
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		violations = append(violations, PasswordMissingSymbol)
+	}
+
+	if usr.Email != "" {
+		local, _, _ := strings.Cut(usr.Email, "@")
+		if strings.EqualFold(password, usr.Email) || strings.EqualFold(password, local) {
+			violations = append(violations, PasswordMatchesEmail)
+		}
+	}
+
+	if usr.Nickname != "" && strings.EqualFold(password, usr.Nickname) {
+		violations = append(violations, PasswordMatchesNickname)
+	}
+
+	if p.breached != nil {
+		breached, err := p.breached.Breached(ctx, password)
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			violations = append(violations, PasswordBreached)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordError{Violations: violations}
+	}
+
+	return nil
+}
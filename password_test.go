@@ -0,0 +1,124 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+type breachedPasswords map[string]bool
+
+func (b breachedPasswords) Breached(_ context.Context, password string) (bool, error) {
+	return b[password], nil
+}
+
+func Test_PasswordPolicy(t *testing.T) {
+	policy := user.NewPasswordPolicy(&user.PasswordConfig{
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+	}, breachedPasswords{"P@ssw0rd1": true})
+
+	testCases := []struct {
+		Name       string
+		User       *user.User
+		Violations []string
+	}{
+		{
+			Name: "valid",
+			User: &user.User{Password: "Corr3ct horse"},
+		},
+		{
+			Name:       "short",
+			User:       &user.User{Password: "a"},
+			Violations: []string{user.PasswordTooShort, user.PasswordMissingUppercase, user.PasswordMissingDigit, user.PasswordMissingSymbol},
+		},
+		{
+			Name:       "too long for bcrypt",
+			User:       &user.User{Password: "Aa1!" + strings.Repeat("a", 69)},
+			Violations: []string{user.PasswordTooLong},
+		},
+		{
+			Name:       "only symbols",
+			User:       &user.User{Password: "!@#$%^&*()"},
+			Violations: []string{user.PasswordMissingLowercase, user.PasswordMissingUppercase, user.PasswordMissingDigit},
+		},
+		{
+			Name:       "email",
+			User:       &user.User{Password: "Alice.1980@Mail.com", Email: "alice.1980@mail.com"},
+			Violations: []string{user.PasswordMatchesEmail},
+		},
+		{
+			Name:       "email local part",
+			User:       &user.User{Password: "Alice.1980", Email: "alice.1980@mail.com"},
+			Violations: []string{user.PasswordMatchesEmail},
+		},
+		{
+			Name:       "nickname",
+			User:       &user.User{Password: "N1ckname!", Nickname: "n1ckname!"},
+			Violations: []string{user.PasswordMatchesNickname},
+		},
+		{
+			Name:       "breached",
+			User:       &user.User{Password: "P@ssw0rd1"},
+			Violations: []string{user.PasswordBreached},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			err := policy.Validate(context.TODO(), tc.User)
+			if tc.Violations == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			var perr *user.PasswordError
+			require.True(t, errors.As(err, &perr))
+			require.ErrorIs(t, err, user.ErrInvalid)
+			require.Equal(t, tc.Violations, perr.Violations)
+		})
+	}
+}
+
+func Test_PasswordPolicy_Default(t *testing.T) {
+	policy := user.NewPasswordPolicy(nil, nil)
+
+	require.NoError(t, policy.Validate(context.TODO(), &user.User{Password: "correct horse"}))
+	require.ErrorIs(t, policy.Validate(context.TODO(), &user.User{Password: "a"}), user.ErrInvalid)
+}
+
+func Test_Create_InvalidPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{
+		FirstName: "first",
+		Password:  "P@ssw0rd1",
+		Email:     "email@mail.com",
+		Country:   "DE",
+	}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{}, nil)
+
+	policy := user.NewPasswordPolicy(nil, breachedPasswords{"P@ssw0rd1": true})
+	svc := user.NewService(mockStorage, 5, user.WithPasswordPolicy(policy))
+
+	gotUser, err := svc.Save(context.TODO(), usr)
+
+	var perr *user.PasswordError
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, []string{user.PasswordBreached}, perr.Violations)
+	require.Nil(t, gotUser)
+}
@@ -0,0 +1,166 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// patchRetries is how many times a Patch is applied again
+// when the user changes between reading and updating it
+const patchRetries = 3
+
+// Patch is a partial update of the user, the nil fields are kept as they are
+type Patch struct {
+	FirstName *string
+	LastName  *string
+	Nickname  *string
+	Country   *string
+	Password  *string
+
+	// Version as in the User, a non zero Version fails the Patch with
+	// ErrConflict when the user was changed since
+	Version uint64
+}
+
+// ParseMergePatch reads the RFC 7396 JSON merge patch of a user, a null removes the
+// field. The fields not changed by the updates, as the email, are ignored.
+func ParseMergePatch(b []byte) (*Patch, error) {
+	var doc map[string]json.RawMessage
+	err := json.Unmarshal(b, &doc)
+	if err != nil || doc == nil {
+		return nil, ErrInvalid
+	}
+
+	p := new(Patch)
+
+	fields := map[string]**string{
+		"first_name": &p.FirstName,
+		"last_name":  &p.LastName,
+		"nickname":   &p.Nickname,
+		"country":    &p.Country,
+		"password":   &p.Password,
+	}
+
+	for name, field := range fields {
+		raw, ok := doc[name]
+		if !ok {
+			continue
+		}
+
+		var value string
+		if !bytes.Equal(raw, []byte("null")) {
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, ErrInvalid
+			}
+		}
+
+		*field = &value
+	}
+
+	return p, nil
+}
+
+// apply returns a copy of the user with the patch applied, only
+// the patched fields are normalized, the others are kept as stored
+func (p *Patch) apply(usr *User) *User {
+	patched := &User{
+		ID:        usr.ID,
+		FirstName: usr.FirstName,
+		LastName:  usr.LastName,
+		Nickname:  usr.Nickname,
+		Email:     usr.Email,
+		Country:   usr.Country,
+		Version:   usr.Version,
+	}
+
+	for _, f := range []struct {
+		value     *string
+		field     *string
+		normalize func(string) string
+	}{
+		{p.FirstName, &patched.FirstName, normalizeText},
+		{p.LastName, &patched.LastName, normalizeText},
+		{p.Nickname, &patched.Nickname, normalizeText},
+		{p.Country, &patched.Country, normalizeCountry},
+	} {
+		if f.value != nil {
+			*f.field = f.normalize(*f.value)
+		}
+	}
+
+	return patched
+}
+
+// validate checks only the fields in the patch, so the users stored
+// before a rule was added, e.g. with a country name instead of the
+// code, can still be patched without fixing the other fields
+func (p *Patch) validate(usr *User) error {
+	err := validateUser(usr, false)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+
+	patched := map[string]bool{
+		"first_name": p.FirstName != nil,
+		"last_name":  p.LastName != nil,
+		"nickname":   p.Nickname != nil,
+		"country":    p.Country != nil,
+	}
+
+	kept := new(ValidationError)
+	for _, f := range verr.Fields {
+		if patched[f.Field] {
+			kept.Fields = append(kept.Fields, f)
+		}
+	}
+
+	return kept.Err()
+}
+
+func (s *service) Patch(ctx context.Context, id string, p *Patch) (*User, error) {
+	var err error
+
+	for i := 0; i < patchRetries; i++ {
+		var current *User
+		current, err = s.storage.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Version != 0 && p.Version != current.Version {
+			return nil, ErrConflict
+		}
+
+		usr := p.apply(current)
+		err = p.validate(usr)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.Password != nil {
+			usr.EncodedPassword, err = s.EncodePassword(ctx, usr, *p.Password)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// the update is conditioned to the version read, so the fields
+		// not in the patch are not reverted by a concurrent change
+		var patched *User
+		patched, err = s.storage.Update(ctx, usr)
+		if errors.Is(err, ErrConflict) && p.Version == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return patched, nil
+	}
+
+	return nil, err
+}
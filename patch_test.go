@@ -0,0 +1,224 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func Test_ParseMergePatch(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *user.Patch
+	}{
+		{
+			name: "empty",
+			body: `{}`,
+			want: &user.Patch{},
+		},
+		{
+			name: "fields",
+			body: `{"first_name": "first", "country": "BR", "password": "secret"}`,
+			want: &user.Patch{FirstName: str("first"), Country: str("BR"), Password: str("secret")},
+		},
+		{
+			name: "null removes",
+			body: `{"nickname": null, "last_name": ""}`,
+			want: &user.Patch{Nickname: str(""), LastName: str("")},
+		},
+		{
+			name: "read only fields are ignored",
+			body: `{"id": "other", "email": "other@mail.com", "nickname": "nick"}`,
+			want: &user.Patch{Nickname: str("nick")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := user.ParseMergePatch([]byte(tt.body))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_ParseMergePatch_Invalid(t *testing.T) {
+	for _, body := range []string{``, `null`, `[]`, `"first"`, `{"first_name": 1}`, `{"country": ["BR"]}`} {
+		_, err := user.ParseMergePatch([]byte(body))
+		require.ErrorIs(t, err, user.ErrInvalid, body)
+	}
+}
+
+func Test_Patch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	current := &user.User{
+		ID:        "id",
+		FirstName: "first",
+		LastName:  "last",
+		Nickname:  "nick",
+		Email:     "email@mail.com",
+		Country:   "DE",
+		Version:   2,
+	}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), current.ID).
+		Return(current, nil)
+
+	want := &user.User{
+		ID:        "id",
+		FirstName: "first",
+		LastName:  "last",
+		Nickname:  "",
+		Email:     "email@mail.com",
+		Country:   "BR",
+		Version:   2,
+	}
+	mockStorage.EXPECT().
+		Update(gomock.Any(), want).
+		Return(want, nil)
+
+	svc := user.NewService(mockStorage, 4)
+
+	got, err := svc.Patch(context.TODO(), current.ID, &user.Patch{Nickname: str(""), Country: str("BR")})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func Test_Patch_Password(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	current := &user.User{ID: "id", FirstName: "first", Email: "email@mail.com", Country: "DE", Version: 1}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), current.ID).
+		Return(current, nil).
+		Times(2)
+
+	var encoded string
+	mockStorage.EXPECT().
+		Update(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, usr *user.User) (*user.User, error) {
+			encoded = usr.EncodedPassword
+			return usr, nil
+		})
+
+	svc := user.NewService(mockStorage, 4)
+
+	_, err := svc.Patch(context.TODO(), current.ID, &user.Patch{Password: str("a new strong password")})
+	require.NoError(t, err)
+	require.NotEmpty(t, encoded)
+	require.NotEqual(t, "a new strong password", encoded)
+
+	// the passwords are checked against the policy
+	_, err = svc.Patch(context.TODO(), current.ID, &user.Patch{Password: str("")})
+	require.ErrorIs(t, err, user.ErrInvalid)
+}
+
+func Test_Patch_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	current := &user.User{ID: "id", FirstName: "first", Email: "email@mail.com", Country: "DE"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), current.ID).
+		Return(current, nil).
+		Times(2)
+
+	svc := user.NewService(mockStorage, 4)
+
+	_, err := svc.Patch(context.TODO(), current.ID, &user.Patch{FirstName: str("")})
+	require.ErrorIs(t, err, user.ErrInvalid)
+
+	_, err = svc.Patch(context.TODO(), current.ID, &user.Patch{Country: str("")})
+	require.ErrorIs(t, err, user.ErrInvalid)
+}
+
+func Test_Patch_Legacy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// stored before the country codes and email addresses were validated
+	current := &user.User{ID: "id", FirstName: "first", Email: "Alice <Alice@Mail.com>", Country: "Brazil", Version: 1}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), current.ID).
+		Return(current, nil).
+		Times(3)
+
+	want := &user.User{ID: "id", FirstName: "patched", Email: "Alice <Alice@Mail.com>", Country: "Brazil", Version: 1}
+	mockStorage.EXPECT().
+		Update(gomock.Any(), want).
+		Return(want, nil)
+
+	svc := user.NewService(mockStorage, 4)
+
+	// the fields not in the patch are kept as stored
+	got, err := svc.Patch(context.TODO(), current.ID, &user.Patch{FirstName: str(" patched ")})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// the patched fields are checked
+	_, err = svc.Patch(context.TODO(), current.ID, &user.Patch{Country: str("Brazil")})
+	var verr *user.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, []user.FieldError{
+		{Field: "country", Code: user.FieldFormat, Detail: "two letters country code, e.g. BR"},
+	}, verr.Fields)
+
+	want = &user.User{ID: "id", FirstName: "first", Email: "Alice <Alice@Mail.com>", Country: "BR", Version: 1}
+	mockStorage.EXPECT().
+		Update(gomock.Any(), want).
+		Return(want, nil)
+
+	got, err = svc.Patch(context.TODO(), current.ID, &user.Patch{Country: str(" br")})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func Test_Patch_Conflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stale := &user.User{ID: "id", FirstName: "first", Nickname: "nick", Email: "email@mail.com", Country: "DE", Version: 1}
+	current := &user.User{ID: "id", FirstName: "first", Nickname: "changed", Email: "email@mail.com", Country: "DE", Version: 2}
+	want := &user.User{ID: "id", FirstName: "patched", Nickname: "changed", Email: "email@mail.com", Country: "DE", Version: 2}
+
+	mockStorage := mock.NewStorage(ctrl)
+	gomock.InOrder(
+		mockStorage.EXPECT().Get(gomock.Any(), "id").Return(stale, nil),
+		mockStorage.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil, user.ErrConflict),
+		// applied again to the user changed meanwhile
+		mockStorage.EXPECT().Get(gomock.Any(), "id").Return(current, nil),
+		mockStorage.EXPECT().Update(gomock.Any(), want).Return(want, nil),
+		mockStorage.EXPECT().Get(gomock.Any(), "id").Return(current, nil),
+	)
+
+	svc := user.NewService(mockStorage, 4)
+
+	got, err := svc.Patch(context.TODO(), "id", &user.Patch{FirstName: str("patched")})
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// the conditional patches are not applied again
+	_, err = svc.Patch(context.TODO(), "id", &user.Patch{FirstName: str("patched"), Version: 1})
+	require.ErrorIs(t, err, user.ErrConflict)
+}
@@ -0,0 +1,58 @@
+package xcrypto_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user/pkg/xcrypto"
+)
+
+func newKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), xcrypto.KeySize)))
+}
+
+func TestCipher(t *testing.T) {
+	c, err := xcrypto.NewCipher(newKey('a'))
+	require.NoError(t, err)
+
+	encrypted, err := c.Encrypt("secret")
+	require.NoError(t, err)
+	require.NotContains(t, encrypted, "secret")
+
+	// the nonces are random
+	again, err := c.Encrypt("secret")
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again)
+
+	got, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "secret", got)
+
+	other, err := xcrypto.NewCipher(newKey('b'))
+	require.NoError(t, err)
+
+	_, err = other.Decrypt(encrypted)
+	require.ErrorIs(t, err, xcrypto.ErrInvalidCiphertext)
+
+	_, err = c.Decrypt("invalid")
+	require.ErrorIs(t, err, xcrypto.ErrInvalidCiphertext)
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, err := xcrypto.GenerateKey()
+	require.NoError(t, err)
+
+	_, err = xcrypto.NewCipher(key)
+	require.NoError(t, err)
+}
+
+func TestNewCipher_InvalidKey(t *testing.T) {
+	_, err := xcrypto.NewCipher("")
+	require.Error(t, err)
+
+	_, err = xcrypto.NewCipher(base64.StdEncoding.EncodeToString([]byte("short")))
+	require.Error(t, err)
+}
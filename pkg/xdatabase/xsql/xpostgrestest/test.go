@@ -0,0 +1,71 @@
+package xpostgrestest
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xpostgres"
+)
+
+var debug = flag.Bool("debug-postgres", false, "do not remove the db used for the test")
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+type PostgresTestSuite struct {
+	suite.Suite
+	DB     *xsql.DB
+	DBName string
+
+	maintenanceURL string
+}
+
+func (s *PostgresTestSuite) SetupTest(postgresURL, migrationDir string) {
+	pgURL, err := url.Parse(postgresURL)
+	if err != nil {
+		s.FailNow("unable to parse postgres url")
+	}
+	s.DBName = fmt.Sprintf("%s_%d", pgURL.Path[1:], rand.Int())
+	pgURL.Path = "/" + s.DBName
+
+	if *debug {
+		s.T().Logf("Using database %s", s.DBName)
+	}
+
+	cfg := &xpostgres.Config{}
+	cfg.URL = pgURL.String()
+	cfg.MigrationsDir = migrationDir
+	cfg.RunMigration = true
+
+	s.DB, err = xpostgres.Connect(cfg)
+	if !s.NoError(err) {
+		s.FailNow("unable to connect to postgres")
+	}
+
+	// the database can not be dropped while connected to it
+	pgURL.Path = "/postgres"
+	s.maintenanceURL = pgURL.String()
+}
+
+func (s *PostgresTestSuite) TearDownTest() {
+	s.DB.Close()
+	if *debug {
+		return
+	}
+
+	db, err := xsql.Open(xpostgres.DriverName, &xsql.Config{URL: s.maintenanceURL})
+	if err != nil {
+		return
+	}
+	defer db.Close()
+
+	db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(s.DBName)))
+}
@@ -0,0 +1,64 @@
+package xsqlite
+
+import (
+	"github.com/golang-migrate/migrate/v4/database"
+	migrationsqlite "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql"
+)
+
+var DriverName = "sqlite3"
+
+// Config URL is the database file, e.g. file:/var/lib/user/user.db?_busy_timeout=5000
+type Config struct {
+	xsql.Config
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.Config.MigrationDriverFn == nil {
+		cfg.Config.MigrationDriverFn = func(db *xsql.DB) (database.Driver, error) {
+			return migrationsqlite.WithInstance(db.DB, &migrationsqlite.Config{
+				MigrationsTable: cfg.MigrationsTable,
+			})
+		}
+	}
+
+	// sqlite allows a single writer, sharing one connection avoids busy errors
+	cfg.MaxOpenConns = 1
+	cfg.MaxIdleConns = 1
+}
+
+func Connect(cfg *Config) (*xsql.DB, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	cfg.setDefaults()
+
+	// the database file is created on the first connection
+	db, err := xsql.Open(DriverName, &cfg.Config)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	version, dirty, err := xsql.Migration(DriverName, db, &cfg.Config)
+	if err != nil && err != xsql.ErrMigrationDisabled {
+		return nil, err
+	}
+	if version > 0 && cfg.Logger != nil {
+		if dirty {
+			cfg.Logger.Warnf("sqlite database is dirty, version: %d", version)
+		} else {
+			cfg.Logger.Infof("sqlite database is ok, version: %d", version)
+		}
+	}
+
+	if cfg.Logger != nil {
+		cfg.Logger.Info("connected to sqlite")
+	}
+
+	return db, nil
+}
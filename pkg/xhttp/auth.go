@@ -0,0 +1,216 @@
+package xhttp
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+const (
+	AuthMethodBearer = "bearer"
+	AuthMethodAPIKey = "api_key"
+	AuthMethodMTLS   = "mtls"
+
+	APIKeyHeader = "X-API-Key"
+)
+
+// ErrNoCredentials is returned by the authenticators when the
+// request does not have their kind of credentials
+var ErrNoCredentials = errors.New("xhttp: no credentials")
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Subject identifies the caller, e.g. the subject of the token,
+	// the name of the API key or the common name of the certificate
+	Subject string
+	// Method is how the caller was authenticated, e.g. AuthMethodBearer
+	Method      string
+	Roles       []string
+	Permissions []string
+}
+
+// HasRole reports if the principal has the role, it is false for anonymous requests
+func (p *Principal) HasRole(role string) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasPermission reports if the principal has the permission, it is false for anonymous requests
+func (p *Principal) HasPermission(permission string) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, perm := range p.Permissions {
+		if perm == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+var principalKey = &contextKey{"principal"}
+
+type contextKey struct {
+	key string
+}
+
+func (ctx contextKey) String() string {
+	return "xhttp: " + ctx.key
+}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal set by Authenticate, nil for anonymous requests
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+
+	return p
+}
+
+// Authenticator returns the principal of the request, ErrNoCredentials
+// when there are no credentials it handles, or the error of invalid ones
+type Authenticator func(r *http.Request) (*Principal, error)
+
+// BearerAuthenticator authenticates the Authorization: Bearer header using verify
+func BearerAuthenticator(verify func(_ context.Context, token string) (*Principal, error)) Authenticator {
+	return func(r *http.Request) (*Principal, error) {
+		scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return nil, ErrNoCredentials
+		}
+
+		p, err := verify(r.Context(), strings.TrimSpace(token))
+		if err != nil {
+			return nil, err
+		}
+		p.Method = AuthMethodBearer
+
+		return p, nil
+	}
+}
+
+// APIKeyAuthenticator authenticates the X-API-Key header, keys maps each key to its principal
+func APIKeyAuthenticator(keys map[string]*Principal) Authenticator {
+	// the keys are compared by hash, in constant time
+	hashes := make(map[[sha256.Size]byte]*Principal, len(keys))
+	for key, p := range keys {
+		hashes[sha256.Sum256([]byte(key))] = p
+	}
+
+	return func(r *http.Request) (*Principal, error) {
+		key := r.Header.Get(APIKeyHeader)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+
+		sum := sha256.Sum256([]byte(key))
+
+		var found *Principal
+		for hash, p := range hashes {
+			if subtle.ConstantTimeCompare(hash[:], sum[:]) == 1 {
+				found = p
+			}
+		}
+
+		if found == nil {
+			return nil, errors.New("xhttp: unknown api key")
+		}
+
+		p := *found
+		p.Method = AuthMethodAPIKey
+
+		return &p, nil
+	}
+}
+
+// MTLSAuthenticator authenticates the client certificate verified by the server,
+// identities maps the allowed certificate common names to their principals
+func MTLSAuthenticator(identities map[string]*Principal) Authenticator {
+	return func(r *http.Request) (*Principal, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return nil, ErrNoCredentials
+		}
+
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+
+		found, ok := identities[cn]
+		if !ok {
+			return nil, errors.New("xhttp: unknown client certificate " + cn)
+		}
+
+		p := *found
+		p.Method = AuthMethodMTLS
+
+		return &p, nil
+	}
+}
+
+// Authenticate sets the Principal of the request in the context, using the first
+// authenticator finding credentials. The requests with invalid credentials are
+// rejected, and the requests without credentials continue anonymous.
+func Authenticate(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			for _, authenticate := range authenticators {
+				p, err := authenticate(r)
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+				if err != nil {
+					xlogger.Logger(ctx).WithError(err).Info("invalid credentials")
+					Unauthorized(ctx, w)
+					return
+				}
+
+				ctx = WithPrincipal(ctx, p)
+				break
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// RequirePrincipal rejects the anonymous requests
+func RequirePrincipal(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if PrincipalFromContext(ctx) == nil {
+			Unauthorized(ctx, w)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Unauthorized answers 401 Unauthorized as a problem, asking for a bearer token
+func Unauthorized(ctx context.Context, w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	ResponseWithProblem(ctx, w, http.StatusUnauthorized, nil)
+}
@@ -2,10 +2,16 @@ package xhttp
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"reflect"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -19,12 +25,39 @@ import (
 var schemaDecoder = schema.NewDecoder()
 var DecodeQueryIgnoringUnknownKeys = true
 
+// QueryTimeLayouts are the accepted layouts of the time query params
+var QueryTimeLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
 func init() {
 	schemaDecoder.IgnoreUnknownKeys(DecodeQueryIgnoringUnknownKeys)
+	schemaDecoder.RegisterConverter(time.Time{}, convertTime)
+}
+
+// convertTime parses the query time, an invalid value is reported
+// by the decoder as a conversion error
+func convertTime(value string) reflect.Value {
+	for _, layout := range QueryTimeLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return reflect.ValueOf(t)
+		}
+	}
+
+	return reflect.Value{}
 }
 
 type ServerConfig struct {
 	Addr string `envconfig:"ADDR" default:"0.0.0.0:80"`
+
+	// TLSCertFile and TLSKeyFile enable https
+	TLSCertFile string `envconfig:"TLS_CERT_FILE"`
+	TLSKeyFile  string `envconfig:"TLS_KEY_FILE"`
+	// ClientCAFile verifies the client certificates, used by the MTLSAuthenticator.
+	// The clients without certificates are still accepted.
+	ClientCAFile string `envconfig:"CLIENT_CA_FILE"`
+	// TrustedProxies are the IPs or CIDRs of the proxies whose X-Forwarded-For
+	// header sets the client address, see RealIP
+	TrustedProxies []string `envconfig:"TRUSTED_PROXIES"`
 }
 
 func (cfg *ServerConfig) setDefault() {
@@ -35,6 +68,8 @@ func (cfg *ServerConfig) setDefault() {
 
 type Server struct {
 	http.Server
+
+	cfg *ServerConfig
 }
 
 type serverOption func(*Server)
@@ -49,6 +84,7 @@ func NewServer(cfg *ServerConfig, opts ...serverOption) *Server {
 		Server: http.Server{
 			Addr: cfg.Addr,
 		},
+		cfg: cfg,
 	}
 
 	for _, optFn := range opts {
@@ -70,12 +106,42 @@ func WithRouter(r *Router) func(*Server) {
 	}
 }
 
+// ErrClientCAWithoutTLS is returned by ListenAndServe when the ClientCAFile is set
+// without the TLSCertFile and TLSKeyFile, the client certificates need https
+var ErrClientCAWithoutTLS = errors.New("xhttp: the client CA file needs the TLS cert and key files")
+
 func (srv *Server) ListenAndServe() error {
+	if srv.cfg.ClientCAFile != "" {
+		if srv.cfg.TLSCertFile == "" || srv.cfg.TLSKeyFile == "" {
+			return ErrClientCAWithoutTLS
+		}
+
+		pem, err := os.ReadFile(srv.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", srv.cfg.ClientCAFile)
+		}
+
+		srv.TLSConfig = &tls.Config{
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+	}
+
 	ch := make(chan error)
 	go func() {
 		defer close(ch)
 
-		err := srv.Server.ListenAndServe()
+		var err error
+		if srv.cfg.TLSCertFile != "" {
+			err = srv.Server.ListenAndServeTLS(srv.cfg.TLSCertFile, srv.cfg.TLSKeyFile)
+		} else {
+			err = srv.Server.ListenAndServe()
+		}
 		ch <- err
 	}()
 
@@ -0,0 +1,20 @@
+package xhttp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ListenAndServe_ClientCAWithoutTLS(t *testing.T) {
+	for _, cfg := range []*ServerConfig{
+		{Addr: "127.0.0.1:0", ClientCAFile: "ca.pem"},
+		{Addr: "127.0.0.1:0", ClientCAFile: "ca.pem", TLSCertFile: "cert.pem"},
+	} {
+		srv := NewServer(cfg)
+
+		// rejected before reading the files or listening
+		err := srv.ListenAndServe()
+		require.ErrorIs(t, err, ErrClientCAWithoutTLS)
+	}
+}
@@ -0,0 +1,37 @@
+package xhttp
+
+import (
+	"context"
+	"net/http"
+)
+
+var problemContentType = "application/problem+json; charset=UTF-8"
+
+// Problem is a RFC 7807 problem details response
+type Problem struct {
+	// Type is an URI identifying the problem, about:blank when empty
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Errors is an extension member listing the invalid fields of the request
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// ResponseWithProblem writes the problem as application/problem+json, the title is
+// the status text unless given. A nil problem has only the title and status.
+func ResponseWithProblem(ctx context.Context, w http.ResponseWriter, statusCode int, p *Problem) {
+	if p == nil {
+		p = new(Problem)
+	}
+
+	p.Status = statusCode
+	if p.Title == "" {
+		p.Title = http.StatusText(statusCode)
+	}
+
+	w.Header().Set(contentTypeHeader, problemContentType)
+	ResponseWithStatus(ctx, w, statusCode, p)
+}
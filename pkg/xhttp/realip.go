@@ -0,0 +1,89 @@
+package xhttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP sets the RemoteAddr of the requests coming from the trusted proxies, IPs or
+// CIDRs, to the client address in X-Forwarded-For. The header is read from right to left,
+// skipping the trusted proxies, and it is ignored in the requests from other addresses,
+// so the clients can not spoof their IPs.
+func RealIP(trustedProxies []string) (func(http.Handler) http.Handler, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+
+		trusted = append(trusted, ipNet)
+	}
+
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(strings.TrimSpace(addr))
+		if ip == nil {
+			return false
+		}
+
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			if isTrusted(host) {
+				if ip := forwardedFor(r, isTrusted); ip != "" {
+					r.RemoteAddr = ip
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}, nil
+}
+
+// forwardedFor returns the last address of X-Forwarded-For not trusted,
+// or the first one when all of them are trusted
+func forwardedFor(r *http.Request, isTrusted func(string) bool) string {
+	var addrs []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		addrs = append(addrs, strings.Split(h, ",")...)
+	}
+
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(addrs[i])
+		if net.ParseIP(addr) == nil {
+			return ""
+		}
+
+		if !isTrusted(addr) || i == 0 {
+			return addr
+		}
+	}
+
+	return ""
+}
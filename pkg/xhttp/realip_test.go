@@ -0,0 +1,50 @@
+package xhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RealIP(t *testing.T) {
+	realIP, err := RealIP([]string{"10.0.0.0/8", "192.168.0.1"})
+	require.NoError(t, err)
+
+	var got string
+	h := realIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.1:1234", "", "203.0.113.1:1234"},
+		{"spoofed by a client", "203.0.113.1:1234", "198.51.100.1", "203.0.113.1:1234"},
+		{"proxy", "10.0.0.1:1234", "203.0.113.1", "203.0.113.1"},
+		{"chain of proxies", "192.168.0.1:1234", "198.51.100.1, 203.0.113.1, 10.0.0.2", "203.0.113.1"},
+		{"only proxies", "10.0.0.1:1234", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"proxy without header", "10.0.0.1:1234", "", "10.0.0.1:1234"},
+		{"invalid header", "10.0.0.1:1234", "203.0.113.1, unknown", "10.0.0.1:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = RealIP([]string{"proxy"})
+	require.Error(t, err)
+}
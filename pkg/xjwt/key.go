@@ -0,0 +1,173 @@
+package xjwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var ErrUnsupportedKey = errors.New("xjwt: unsupported key")
+
+var TimeNow = func() time.Time {
+	return time.Now().UTC()
+}
+
+// Key is a private signing key, its ID is the RFC 7638 thumbprint
+// of the public key, so the same key has the same ID in every instance
+type Key struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+
+	signer crypto.Signer
+}
+
+// GenerateKey creates a new key for the algorithm, RS256 or EdDSA
+func GenerateKey(alg string) (*Key, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch alg {
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: algorithm %q", ErrUnsupportedKey, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKey(signer, TimeNow())
+}
+
+// ParseKey parses a PEM encoded PKCS #8 private key, RSA keys
+// are used with RS256 and Ed25519 keys with EdDSA
+func ParseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data", ErrUnsupportedKey)
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	return newKey(signer, TimeNow())
+}
+
+func newKey(signer crypto.Signer, createdAt time.Time) (*Key, error) {
+	k := &Key{
+		CreatedAt: createdAt,
+		signer:    signer,
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey:
+		k.Algorithm = AlgorithmRS256
+	case ed25519.PrivateKey:
+		k.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	k.ID = k.JWK().thumbprint()
+
+	return k, nil
+}
+
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == AlgorithmEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+
+	return jwt.SigningMethodRS256
+}
+
+// Public returns the public key used to verify the signatures
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// JWK returns the public key in the JSON Web Key format
+func (k *Key) JWK() JWK {
+	jwk := JWK{
+		KeyID:     k.ID,
+		Algorithm: k.Algorithm,
+		Use:       "sig",
+	}
+
+	switch pub := k.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// JWK is a public key as defined by RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// thumbprint is the RFC 7638 thumbprint, the hash of the required
+// members of the key in lexicographic order
+func (jwk JWK) thumbprint() string {
+	var canonical string
+	if jwk.KeyType == "RSA" {
+		canonical = fmt.Sprintf(`{"e":%q,"kty":%q,"n":%q}`, jwk.E, jwk.KeyType, jwk.N)
+	} else {
+		canonical = fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q}`, jwk.Curve, jwk.KeyType, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS is the set of public keys served to the verifiers
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
@@ -0,0 +1,172 @@
+package xjwt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrUnknownKey = errors.New("xjwt: unknown key")
+
+// KeySet signs the tokens with its newest key and verifies them with any of its keys.
+//
+// A rotating key set generates a new key when the signing key gets older than
+// the rotation, the previous keys are kept for the retention after they
+// stop signing, so the tokens they signed are still valid until they expire.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*Key // the newest first
+
+	algorithm string
+	rotation  time.Duration
+	retention time.Duration
+}
+
+// NewKeySet creates a static key set, the first key signs the tokens and
+// the others are only used to verify them, e.g. while a key is replaced
+func NewKeySet(keys ...*Key) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("xjwt: empty key set")
+	}
+
+	return &KeySet{keys: keys}, nil
+}
+
+// NewRotatingKeySet creates a key set generating its own keys,
+// the keys are kept in memory and lost when the process stops
+func NewRotatingKeySet(alg string, rotation, retention time.Duration) (*KeySet, error) {
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySet{
+		keys:      []*Key{key},
+		algorithm: alg,
+		rotation:  rotation,
+		retention: retention,
+	}, nil
+}
+
+// signingKey returns the newest key, rotating it when it is due
+func (ks *KeySet) signingKey() (*Key, error) {
+	ks.mu.RLock()
+	key := ks.keys[0]
+	ks.mu.RUnlock()
+
+	if ks.rotation <= 0 || TimeNow().Sub(key.CreatedAt) < ks.rotation {
+		return key, nil
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := TimeNow()
+
+	// rotated by a concurrent call
+	if now.Sub(ks.keys[0].CreatedAt) < ks.rotation {
+		return ks.keys[0], nil
+	}
+
+	key, err := GenerateKey(ks.algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*Key{key}
+	for i, k := range ks.keys {
+		// ks.keys[i] stopped signing when the key before it was created
+		if i == 0 || now.Sub(ks.keys[i-1].CreatedAt) < ks.retention {
+			keys = append(keys, k)
+		}
+	}
+	ks.keys = keys
+
+	return key, nil
+}
+
+func (ks *KeySet) lookup(id string) *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for _, k := range ks.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+
+	return nil
+}
+
+// Sign returns the signed token of the claims, its kid header is the signing key ID
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key, err := ks.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signer)
+}
+
+// Parse verifies the token signature and decodes it into claims,
+// the claims are validated using the given parser options
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	opts = append(opts, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}))
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+
+		key := ks.lookup(id)
+		if key == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+		}
+
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("%w: algorithm %q", ErrUnknownKey, token.Method.Alg())
+		}
+
+		return key.Public(), nil
+	}, opts...)
+
+	return err
+}
+
+// JWKS returns the public keys of the set
+func (ks *KeySet) JWKS() *JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := &JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, k := range ks.keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+
+	return set
+}
+
+// LoadKeySet creates a static key set from PEM files, see NewKeySet and ParseKey
+func LoadKeySet(paths ...string) (*KeySet, error) {
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse key %s: %w", path, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewKeySet(keys...)
+}
@@ -0,0 +1,108 @@
+package xjwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user/pkg/xjwt"
+)
+
+func claims() *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{Subject: "subject"}
+}
+
+func Test_KeySet_SignAndParse(t *testing.T) {
+	for _, alg := range []string{xjwt.AlgorithmRS256, xjwt.AlgorithmEdDSA} {
+		ks, err := xjwt.NewRotatingKeySet(alg, time.Hour, time.Hour)
+		require.NoError(t, err)
+
+		token, err := ks.Sign(claims())
+		require.NoError(t, err)
+
+		var got jwt.RegisteredClaims
+		require.NoError(t, ks.Parse(token, &got), alg)
+		require.Equal(t, "subject", got.Subject)
+
+		jwks := ks.JWKS()
+		require.Len(t, jwks.Keys, 1)
+		require.Equal(t, alg, jwks.Keys[0].Algorithm)
+		require.NotEmpty(t, jwks.Keys[0].KeyID)
+	}
+}
+
+func Test_KeySet_Rotation(t *testing.T) {
+	now := time.Now().UTC()
+	defer func(timeNow func() time.Time) { xjwt.TimeNow = timeNow }(xjwt.TimeNow)
+	xjwt.TimeNow = func() time.Time { return now }
+
+	ks, err := xjwt.NewRotatingKeySet(xjwt.AlgorithmEdDSA, time.Hour, 15*time.Minute)
+	require.NoError(t, err)
+
+	first, err := ks.Sign(claims())
+	require.NoError(t, err)
+
+	// the first key stops signing but still verifies
+	now = now.Add(time.Hour)
+
+	second, err := ks.Sign(claims())
+	require.NoError(t, err)
+	require.Len(t, ks.JWKS().Keys, 2)
+	require.NoError(t, ks.Parse(first, claims()))
+	require.NoError(t, ks.Parse(second, claims()))
+
+	// the first key is dropped after the retention
+	now = now.Add(time.Hour)
+
+	_, err = ks.Sign(claims())
+	require.NoError(t, err)
+	require.Len(t, ks.JWKS().Keys, 2)
+	require.ErrorIs(t, ks.Parse(first, claims()), xjwt.ErrUnknownKey)
+	require.NoError(t, ks.Parse(second, claims()))
+}
+
+func Test_LoadKeySet(t *testing.T) {
+	paths := make([]string, 0)
+	for _, name := range []string{"new.pem", "old.pem"} {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), name)
+		err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+		require.NoError(t, err)
+
+		paths = append(paths, path)
+	}
+
+	ks, err := xjwt.LoadKeySet(paths...)
+	require.NoError(t, err)
+
+	old, err := xjwt.LoadKeySet(paths[1])
+	require.NoError(t, err)
+
+	token, err := old.Sign(claims())
+	require.NoError(t, err)
+
+	// the tokens of the old key are still valid
+	require.NoError(t, ks.Parse(token, claims()))
+
+	jwks := ks.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	require.Equal(t, old.JWKS().Keys[0], jwks.Keys[1])
+
+	// the key ID does not depend on the instance
+	again, err := xjwt.LoadKeySet(paths[0])
+	require.NoError(t, err)
+	require.Equal(t, jwks.Keys[0].KeyID, again.JWKS().Keys[0].KeyID)
+}
@@ -0,0 +1,174 @@
+// Package xmail sends plain text emails by SMTP, or writes them
+// to a file or to the logger for local development
+package xmail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+const (
+	DriverSMTP = "smtp"
+	DriverFile = "file"
+	DriverLog  = "log"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(context.Context, *Message) error
+}
+
+type Config struct {
+	// Driver is smtp, file or log, there is no default, the log and file drivers
+	// write the links of the messages, e.g. password resets, in the clear
+	Driver string `envconfig:"DRIVER"`
+	From   string `envconfig:"FROM" default:"no-reply@localhost"`
+
+	// File is the file the messages are appended to by the file driver
+	File string `envconfig:"FILE" default:"mail.log"`
+
+	SMTPHost     string `envconfig:"SMTP_HOST" default:"localhost"`
+	SMTPPort     int    `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string `envconfig:"SMTP_PASSWORD"`
+}
+
+func (cfg *Config) setDefault() {
+	if cfg.From == "" {
+		cfg.From = "no-reply@localhost"
+	}
+	if cfg.File == "" {
+		cfg.File = "mail.log"
+	}
+	if cfg.SMTPHost == "" {
+		cfg.SMTPHost = "localhost"
+	}
+	if cfg.SMTPPort == 0 {
+		cfg.SMTPPort = 587
+	}
+}
+
+// New returns the mailer of the configured driver
+func New(cfg *Config) (Mailer, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+	cfg.setDefault()
+
+	switch cfg.Driver {
+	case DriverSMTP:
+		return &SMTP{cfg: cfg}, nil
+	case DriverFile:
+		return &File{path: cfg.File, from: cfg.From}, nil
+	case DriverLog:
+		return &Log{from: cfg.From}, nil
+	case "":
+		return nil, fmt.Errorf("xmail: driver is required, one of %s, %s or %s", DriverSMTP, DriverFile, DriverLog)
+	}
+
+	return nil, fmt.Errorf("xmail: unknown driver %q", cfg.Driver)
+}
+
+// format returns the message in the RFC 5322 format
+func format(from string, msg *Message) []byte {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
+
+// validate rejects the header injections
+func validate(msg *Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("xmail: invalid header")
+	}
+
+	return nil
+}
+
+// SMTP sends the messages to the configured server, using
+// STARTTLS when the server supports it
+type SMTP struct {
+	cfg *Config
+}
+
+func (m *SMTP) Send(_ context.Context, msg *Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(m.cfg.SMTPHost, strconv.Itoa(m.cfg.SMTPPort))
+
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{msg.To}, format(m.cfg.From, msg))
+}
+
+// File appends the messages to a file, for local development
+type File struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func (m *File) Send(_ context.Context, msg *Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(format(m.from, msg), "\r\n\r\n"...))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// Log writes the messages to the logger of the context, for local development
+type Log struct {
+	from string
+}
+
+func (m *Log) Send(ctx context.Context, msg *Message) error {
+	xlogger.Logger(ctx).
+		WithField("from", m.from).
+		WithField("to", msg.To).
+		WithField("subject", msg.Subject).
+		Info(msg.Body)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package xmail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_New(t *testing.T) {
+	m, err := New(&Config{Driver: DriverLog})
+	require.NoError(t, err)
+	require.IsType(t, &Log{}, m)
+
+	// the driver is not defaulted to one writing the links in the clear
+	_, err = New(nil)
+	require.Error(t, err)
+
+	_, err = New(&Config{Driver: "pigeon"})
+	require.Error(t, err)
+}
+
+func Test_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+
+	m, err := New(&Config{Driver: DriverFile, File: path, From: "from@mail.com"})
+	require.NoError(t, err)
+
+	for _, to := range []string{"a@mail.com", "b@mail.com"} {
+		err = m.Send(context.TODO(), &Message{To: to, Subject: "Hi", Body: "line 1\nline 2"})
+		require.NoError(t, err)
+	}
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	got := string(b)
+	require.Contains(t, got, "From: from@mail.com\r\n")
+	require.Contains(t, got, "To: a@mail.com\r\n")
+	require.Contains(t, got, "To: b@mail.com\r\n")
+	require.Contains(t, got, "Subject: Hi\r\n")
+	require.Equal(t, 2, strings.Count(got, "line 1\r\nline 2"))
+}
+
+func Test_File_HeaderInjection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+
+	m, err := New(&Config{Driver: DriverFile, File: path})
+	require.NoError(t, err)
+
+	err = m.Send(context.TODO(), &Message{To: "a@mail.com\r\nBcc: b@mail.com", Subject: "Hi"})
+	require.Error(t, err)
+
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,147 @@
+// Package xpwned checks passwords against an offline copy of a breached
+// passwords list, as the Pwned Passwords SHA-1 list ordered by hash
+package xpwned
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// PrefixLength is the length of the hash prefixes of the range queries
+const PrefixLength = 5
+
+// List is a file with one upper case SHA-1 hex hash per line, optionally
+// followed by :count, ordered by hash. The file is not loaded in memory,
+// the lookups use a binary search over it.
+type List struct {
+	f    *os.File
+	size int64
+}
+
+func Open(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &List{f: f, size: info.Size()}, nil
+}
+
+func (l *List) Close() error {
+	return l.f.Close()
+}
+
+// Hash returns the upper case SHA-1 hex hash of the password
+func Hash(password string) string {
+	sum := sha1.Sum([]byte(password))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// lineAt returns the first line starting at or after off and its offset
+func (l *List) lineAt(off int64) (string, int64, error) {
+	start := off
+	r := bufio.NewReader(io.NewSectionReader(l.f, off, l.size-off))
+
+	// off may be in the middle of a line, unless the previous byte ends a line
+	if off > 0 {
+		var prev [1]byte
+		if _, err := l.f.ReadAt(prev[:], off-1); err != nil {
+			return "", 0, err
+		}
+
+		if prev[0] != '\n' {
+			skipped, err := r.ReadString('\n')
+			if err != nil {
+				return "", l.size, io.EOF
+			}
+			start += int64(len(skipped))
+		}
+	}
+
+	line, err := r.ReadString('\n')
+	if line == "" && err != nil {
+		return "", l.size, io.EOF
+	}
+
+	return strings.TrimRight(line, "\r\n"), start, nil
+}
+
+// Range returns the suffixes of the hashes starting with prefix, as the range
+// queries of the Pwned Passwords API, so only the prefix is needed to look up
+func (l *List) Range(_ context.Context, prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+
+	var searchErr error
+
+	// the first offset whose line is not before the prefix
+	off := sort.Search(int(l.size), func(i int) bool {
+		line, _, err := l.lineAt(int64(i))
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return strings.ToUpper(line) >= prefix
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+
+	_, start, err := l.lineAt(int64(off))
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+
+	scanner := bufio.NewScanner(io.NewSectionReader(l.f, start, l.size-start))
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		hash = strings.ToUpper(hash)
+
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// Breached reports if the password is in the list
+func (l *List) Breached(ctx context.Context, password string) (bool, error) {
+	hash := Hash(password)
+
+	suffixes, err := l.Range(ctx, hash[:PrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range suffixes {
+		if s == hash[PrefixLength:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
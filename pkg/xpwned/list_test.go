@@ -0,0 +1,75 @@
+package xpwned_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user/pkg/xpwned"
+)
+
+func writeList(t *testing.T, passwords ...string) string {
+	lines := make([]string, 0, len(passwords))
+	for i, p := range passwords {
+		lines = append(lines, xpwned.Hash(p)+":"+strings.Repeat("1", i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+
+	return path
+}
+
+func Test_Breached(t *testing.T) {
+	passwords := []string{"password", "123456", "qwerty", "letmein", "dragon", "monkey", "sunshine"}
+
+	l, err := xpwned.Open(writeList(t, passwords...))
+	require.NoError(t, err)
+	defer l.Close()
+
+	for _, p := range passwords {
+		breached, err := l.Breached(context.TODO(), p)
+		require.NoError(t, err)
+		require.True(t, breached, p)
+	}
+
+	for _, p := range []string{"correct horse battery staple", "", "Password"} {
+		breached, err := l.Breached(context.TODO(), p)
+		require.NoError(t, err)
+		require.False(t, breached, p)
+	}
+}
+
+func Test_Range(t *testing.T) {
+	l, err := xpwned.Open(writeList(t, "password"))
+	require.NoError(t, err)
+	defer l.Close()
+
+	hash := xpwned.Hash("password")
+
+	suffixes, err := l.Range(context.TODO(), strings.ToLower(hash[:xpwned.PrefixLength]))
+	require.NoError(t, err)
+	require.Equal(t, []string{hash[xpwned.PrefixLength:]}, suffixes)
+
+	for _, prefix := range []string{"00000", "FFFFF"} {
+		suffixes, err = l.Range(context.TODO(), prefix)
+		require.NoError(t, err)
+		require.Empty(t, suffixes)
+	}
+}
+
+func Test_Empty(t *testing.T) {
+	l, err := xpwned.Open(writeList(t))
+	require.NoError(t, err)
+	defer l.Close()
+
+	breached, err := l.Breached(context.TODO(), "password")
+	require.NoError(t, err)
+	require.False(t, breached)
+}
@@ -0,0 +1,59 @@
+package xtotp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user/pkg/xtotp"
+)
+
+// the SHA1 test vectors of RFC 6238, truncated to 6 digits
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	for unix, code := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, err := xtotp.Code(secret, xtotp.Step(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, code, got, unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := xtotp.GenerateSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	code, err := xtotp.Code(secret, xtotp.Step(now.Add(-xtotp.Period)))
+	require.NoError(t, err)
+
+	// the previous step is accepted
+	step, ok := xtotp.Validate(secret, code, now)
+	require.True(t, ok)
+	require.Equal(t, xtotp.Step(now)-1, step)
+
+	_, ok = xtotp.Validate(secret, code, now.Add(2*xtotp.Period))
+	require.False(t, ok)
+
+	_, ok = xtotp.Validate(secret, "12345", now)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	uri := xtotp.URI("user", "email@mail.com", "SECRET")
+
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/user:email@mail.com?"), uri)
+	require.Contains(t, uri, "secret=SECRET")
+	require.Contains(t, uri, "issuer=user")
+}
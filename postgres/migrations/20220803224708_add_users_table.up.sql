@@ -0,0 +1,15 @@
+CREATE TABLE users (
+    id VARCHAR(100) NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    nickname VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    encoded_password VARCHAR(200) NOT NULL,
+    country VARCHAR(8) NOT NULL,
+    created_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    updated_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    PRIMARY KEY (id)
+);
+
+-- emails are case insensitive, as in the mysql collation
+CREATE UNIQUE INDEX users_email_key ON users (LOWER(email));
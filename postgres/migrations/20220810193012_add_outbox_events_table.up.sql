@@ -0,0 +1,13 @@
+CREATE TABLE outbox_events (
+    id BIGSERIAL NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    next_attempt_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX outbox_events_user_id_idx ON outbox_events (user_id, id);
+CREATE INDEX outbox_events_next_attempt_at_idx ON outbox_events (next_attempt_at);
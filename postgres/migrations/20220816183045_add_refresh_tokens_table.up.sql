@@ -0,0 +1,12 @@
+CREATE TABLE refresh_tokens (
+    id VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ(6) NOT NULL,
+    created_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    revoked_at TIMESTAMPTZ(6) NULL,
+    PRIMARY KEY (id),
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
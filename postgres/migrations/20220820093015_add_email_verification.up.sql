@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ(6) NULL;
+
+CREATE TABLE verification_tokens (
+    id VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    email VARCHAR(200) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    expires_at TIMESTAMPTZ(6) NOT NULL,
+    created_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    used_at TIMESTAMPTZ(6) NULL,
+    PRIMARY KEY (id),
+    UNIQUE (token_hash)
+);
+
+CREATE INDEX verification_tokens_user_id_idx ON verification_tokens (user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE two_factors (
+    user_id VARCHAR(100) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ(6) NOT NULL DEFAULT current_timestamp(6),
+    confirmed_at TIMESTAMPTZ(6) NULL,
+    PRIMARY KEY (user_id)
+);
+
+CREATE TABLE two_factor_recovery_codes (
+    user_id VARCHAR(100) NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ(6) NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,5 @@
+-- the deleted users keep their rows until purged, only the emails of the
+-- active users are unique
+DROP INDEX IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX users_email_key ON users (LOWER(email)) WHERE deleted_at IS NULL;
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type OutboxStorage struct {
+	db *sqlx.DB
+}
+
+func NewOutbox(db *sqlx.DB) *OutboxStorage {
+	return &OutboxStorage{
+		db: db,
+	}
+}
+
+// addEvent records the event in the outbox using the same transaction of the change
+func addEvent(ctx context.Context, tx *sqlx.Tx, typ string, usr *user.User) error {
+	evt, err := user.NewEvent(typ, usr)
+	if err != nil {
+		return err
+	}
+
+	return saveEvent(ctx, tx, evt)
+}
+
+// saveEvent records the event built by the caller, e.g. with other payload
+func saveEvent(ctx context.Context, tx *sqlx.Tx, evt *user.Event) error {
+	now := TimeNow()
+
+	q := psql.Insert("outbox_events").
+		Columns(
+			"type",
+			"user_id",
+			"payload",
+			"created_at",
+			"next_attempt_at",
+		).
+		Values(
+			evt.Type,
+			evt.UserID,
+			string(evt.Payload),
+			now,
+			now,
+		)
+
+	_, err := q.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to save outbox event")
+		return err
+	}
+
+	return nil
+}
+
+func (s *OutboxStorage) Fetch(ctx context.Context, limit int) ([]*user.Event, error) {
+	q := psql.Select(
+		"e.id",
+		"e.type",
+		"e.user_id",
+		"e.payload",
+		"e.attempts",
+		"e.created_at",
+		"e.next_attempt_at",
+	).
+		From("outbox_events e").
+		Where(sq.LtOrEq{"e.next_attempt_at": TimeNow()}).
+		// only the head of each user queue, to keep the events ordered
+		Where("NOT EXISTS (SELECT 1 FROM outbox_events p WHERE p.user_id = e.user_id AND p.id < e.id)").
+		OrderBy("e.id ASC").
+		Limit(uint64(limit))
+
+	query, args := q.MustSql()
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to fetch outbox events")
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*user.Event, 0)
+
+	for rows.Next() {
+		var evt user.Event
+		err := rows.StructScan(&evt)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &evt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *OutboxStorage) Ack(ctx context.Context, evt *user.Event) error {
+	q := psql.Delete("outbox_events").Where(sq.Eq{"id": evt.ID})
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+
+	return err
+}
+
+func (s *OutboxStorage) Retry(ctx context.Context, evt *user.Event, next time.Time) error {
+	q := psql.Update("outbox_events").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("next_attempt_at", next).
+		Where(sq.Eq{"id": evt.ID})
+
+	_, err := q.RunWith(s.db).ExecContext(ctx)
+
+	return err
+}
@@ -0,0 +1,212 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xcrypto"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// TwoFactorStorage keeps the TOTP secrets encrypted by cipher,
+// the recovery codes are hashed by the service. Without a cipher
+// only the enrollments can be counted, the secrets are not readable
+type TwoFactorStorage struct {
+	db     *sqlx.DB
+	cipher *xcrypto.Cipher
+}
+
+func NewTwoFactorStorage(db *sqlx.DB, cipher *xcrypto.Cipher) *TwoFactorStorage {
+	return &TwoFactorStorage{
+		db:     db,
+		cipher: cipher,
+	}
+}
+
+func (s *TwoFactorStorage) SaveTwoFactor(ctx context.Context, tf *user.TwoFactor) error {
+	secret, err := s.cipher.Encrypt(tf.Secret)
+	if err != nil {
+		return err
+	}
+
+	// a new enrollment replaces the previous one of the user
+	q := psql.Insert("two_factors").
+		Columns(
+			"user_id",
+			"secret",
+			"last_step",
+			"created_at",
+			"confirmed_at",
+		).
+		Values(
+			tf.UserID,
+			secret,
+			tf.LastStep,
+			tf.CreatedAt,
+			tf.ConfirmedAt,
+		).
+		Suffix(`ON CONFLICT (user_id) DO UPDATE SET
+			secret = EXCLUDED.secret,
+			last_step = EXCLUDED.last_step,
+			created_at = EXCLUDED.created_at,
+			confirmed_at = EXCLUDED.confirmed_at`)
+
+	_, err = q.RunWith(s.db).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("user_id", tf.UserID).
+			WithError(err).
+			Error("unable to save two factor")
+		return err
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) GetTwoFactor(ctx context.Context, userID string) (*user.TwoFactor, error) {
+	q := psql.Select(
+		"t.user_id",
+		"t.secret",
+		"t.last_step",
+		"t.created_at",
+		"t.confirmed_at",
+	).
+		From("two_factors t").
+		Where(sq.Eq{"t.user_id": userID})
+
+	query, args := q.MustSql()
+
+	var tf user.TwoFactor
+
+	err := sqlx.GetContext(ctx, s.db, &tf, query, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, user.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tf.Secret, err = s.cipher.Decrypt(tf.Secret)
+	if err != nil {
+		xlogger.Logger(ctx).WithField("user_id", userID).WithError(err).Error("unable to decrypt two factor secret")
+		return nil, err
+	}
+
+	return &tf, nil
+}
+
+func (s *TwoFactorStorage) ConfirmTwoFactor(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		res, err := psql.Update("two_factors").
+			Set("confirmed_at", TimeNow()).
+			Set("last_step", step).
+			Where(sq.Eq{"user_id": userID, "confirmed_at": nil}).
+			RunWith(tx).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userID, recoveryHashes)
+	})
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID string, hashes []string) error {
+	_, err := psql.Delete("two_factor_recovery_codes").
+		Where(sq.Eq{"user_id": userID}).
+		RunWith(tx).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	q := psql.Insert("two_factor_recovery_codes").Columns("user_id", "code_hash")
+	for _, hash := range hashes {
+		q = q.Values(userID, hash)
+	}
+
+	_, err = q.RunWith(tx).ExecContext(ctx)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("user_id", userID).
+			WithError(err).
+			Error("unable to save recovery codes")
+		return err
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseTwoFactorStep(ctx context.Context, userID string, step int64) error {
+	// the update is atomic, a concurrent use of the same code fails
+	res, err := psql.Update("two_factors").
+		Set("last_step", step).
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Lt{"last_step": step}).
+		RunWith(s.db).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	res, err := psql.Update("two_factor_recovery_codes").
+		Set("used_at", TimeNow()).
+		Where(sq.Eq{"user_id": userID, "code_hash": hash, "used_at": nil}).
+		RunWith(s.db).
+		ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return user.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) DeleteTwoFactor(ctx context.Context, userID string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		_, err := psql.Delete("two_factors").
+			Where(sq.Eq{"user_id": userID}).
+			RunWith(tx).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userID, nil)
+	})
+}
+
+func (s *TwoFactorStorage) CountTwoFactors(ctx context.Context) (int, error) {
+	var n int
+	err := psql.Select("COUNT(*)").From("two_factors").Where(sq.NotEq{"confirmed_at": nil}).
+		RunWith(s.db).QueryRowContext(ctx).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,96 @@
+//go:build integration
+
+package postgres_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xcrypto"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xpostgrestest"
+	"github.com/cadicallegari/user/postgres"
+	"github.com/cadicallegari/user/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	postgresURL := os.Getenv("USER_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("envvar USER_POSTGRES_URL is empty or missing")
+	}
+
+	storagetest.Run(t, func(t *testing.T) user.Storage {
+		var db xpostgrestest.PostgresTestSuite
+		db.SetT(t)
+		db.SetupTest(postgresURL, os.Getenv("USER_POSTGRES_MIGRATIONS_DIR"))
+		t.Cleanup(db.TearDownTest)
+
+		return postgres.NewStorage(db.DB)
+	})
+}
+
+func TestTokenStorage(t *testing.T) {
+	postgresURL := os.Getenv("USER_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("envvar USER_POSTGRES_URL is empty or missing")
+	}
+
+	storagetest.RunTokens(t, func(t *testing.T) user.TokenStorage {
+		var db xpostgrestest.PostgresTestSuite
+		db.SetT(t)
+		db.SetupTest(postgresURL, os.Getenv("USER_POSTGRES_MIGRATIONS_DIR"))
+		t.Cleanup(db.TearDownTest)
+
+		return postgres.NewTokenStorage(db.DB)
+	})
+}
+
+func TestTwoFactorStorage(t *testing.T) {
+	postgresURL := os.Getenv("USER_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("envvar USER_POSTGRES_URL is empty or missing")
+	}
+
+	storagetest.RunTwoFactors(t, func(t *testing.T) user.TwoFactorStorage {
+		var db xpostgrestest.PostgresTestSuite
+		db.SetT(t)
+		db.SetupTest(postgresURL, os.Getenv("USER_POSTGRES_MIGRATIONS_DIR"))
+		t.Cleanup(db.TearDownTest)
+
+		key, err := xcrypto.GenerateKey()
+		require.NoError(t, err)
+
+		cipher, err := xcrypto.NewCipher(key)
+		require.NoError(t, err)
+
+		return postgres.NewTwoFactorStorage(db.DB, cipher)
+	})
+}
+
+func TestStorages(t *testing.T) {
+	postgresURL := os.Getenv("USER_POSTGRES_URL")
+	if postgresURL == "" {
+		t.Skip("envvar USER_POSTGRES_URL is empty or missing")
+	}
+
+	storagetest.RunStorages(t, func(t *testing.T) *storagetest.Storages {
+		var db xpostgrestest.PostgresTestSuite
+		db.SetT(t)
+		db.SetupTest(postgresURL, os.Getenv("USER_POSTGRES_MIGRATIONS_DIR"))
+		t.Cleanup(db.TearDownTest)
+
+		key, err := xcrypto.GenerateKey()
+		require.NoError(t, err)
+
+		cipher, err := xcrypto.NewCipher(key)
+		require.NoError(t, err)
+
+		return &storagetest.Storages{
+			Users:      postgres.NewStorage(db.DB),
+			Tokens:     postgres.NewTokenStorage(db.DB),
+			TwoFactors: postgres.NewTwoFactorStorage(db.DB, cipher),
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type PurgeConfig struct {
+	// Retention is how long the deleted users are kept before being purged
+	Retention time.Duration `envconfig:"RETENTION" default:"720h"`
+	Interval  time.Duration `envconfig:"INTERVAL" default:"1h"`
+	BatchSize int           `envconfig:"BATCH_SIZE" default:"100"`
+}
+
+func (cfg *PurgeConfig) setDefault() {
+	if cfg.Retention == 0 {
+		cfg.Retention = 30 * 24 * time.Hour
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+}
+
+// Purger removes for good the users deleted for longer than the retention
+// period, the storage records an EventUserPurged for each of them
+type Purger struct {
+	storage Storage
+
+	cfg *PurgeConfig
+}
+
+func NewPurger(storage Storage, cfg *PurgeConfig) *Purger {
+	if cfg == nil {
+		cfg = new(PurgeConfig)
+	}
+	cfg.setDefault()
+
+	return &Purger{
+		storage: storage,
+		cfg:     cfg,
+	}
+}
+
+// Run purges the expired users every interval until the context is done
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.Purge(ctx)
+		if err != nil {
+			xlogger.Logger(ctx).WithError(err).Error("unable to purge deleted users")
+		}
+		if n > 0 {
+			xlogger.Logger(ctx).WithField("purged", n).Info("deleted users purged")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the users deleted before the retention period,
+// returning the number of users purged
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	before := TimeNow().Add(-p.cfg.Retention)
+
+	var purged int
+
+	for ctx.Err() == nil {
+		n, err := p.storage.Purge(ctx, before, p.cfg.BatchSize)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+
+		if n < p.cfg.BatchSize {
+			break
+		}
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,55 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+func Test_Purger_Purge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Date(2022, 8, 27, 10, 0, 0, 0, time.UTC)
+	defer func(fn func() time.Time) { user.TimeNow = fn }(user.TimeNow)
+	user.TimeNow = func() time.Time { return now }
+
+	before := now.Add(-24 * time.Hour)
+
+	storage := mock.NewStorage(ctrl)
+	gomock.InOrder(
+		storage.EXPECT().Purge(gomock.Any(), before, 2).Return(2, nil),
+		storage.EXPECT().Purge(gomock.Any(), before, 2).Return(2, nil),
+		storage.EXPECT().Purge(gomock.Any(), before, 2).Return(1, nil),
+	)
+
+	purger := user.NewPurger(storage, &user.PurgeConfig{Retention: 24 * time.Hour, BatchSize: 2})
+
+	n, err := purger.Purge(context.TODO())
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+}
+
+func Test_Purger_Purge_Error(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mock.NewStorage(ctrl)
+	gomock.InOrder(
+		storage.EXPECT().Purge(gomock.Any(), gomock.Any(), 100).Return(100, nil),
+		storage.EXPECT().Purge(gomock.Any(), gomock.Any(), 100).Return(3, errors.New("some error")),
+	)
+
+	purger := user.NewPurger(storage, nil)
+
+	n, err := purger.Purge(context.TODO())
+	require.Error(t, err)
+	require.Equal(t, 103, n)
+}
@@ -0,0 +1,176 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type RelayConfig struct {
+	PollInterval    time.Duration `envconfig:"POLL_INTERVAL" default:"1s"`
+	BatchSize       int           `envconfig:"BATCH_SIZE" default:"100"`
+	RetryBackoff    time.Duration `envconfig:"RETRY_BACKOFF" default:"1s"`
+	MaxRetryBackoff time.Duration `envconfig:"MAX_RETRY_BACKOFF" default:"5m"`
+}
+
+func (cfg *RelayConfig) setDefault() {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	if cfg.MaxRetryBackoff == 0 {
+		cfg.MaxRetryBackoff = 5 * time.Minute
+	}
+}
+
+// Relay drains the outbox into the EventService.
+// The delivery is at least once, a failed event is retried with exponential
+// backoff and the following events of the same user wait for it.
+type Relay struct {
+	outbox       Outbox
+	eventService EventService
+
+	cfg *RelayConfig
+}
+
+var TimeNow = func() time.Time {
+	return time.Now().UTC()
+}
+
+func NewRelay(outbox Outbox, eventService EventService, cfg *RelayConfig) *Relay {
+	if cfg == nil {
+		cfg = new(RelayConfig)
+	}
+	cfg.setDefault()
+
+	return &Relay{
+		outbox:       outbox,
+		eventService: eventService,
+		cfg:          cfg,
+	}
+}
+
+// Run drains the outbox every poll interval until the context is done
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := r.Drain(ctx)
+		if err != nil {
+			xlogger.Logger(ctx).WithError(err).Error("unable to drain outbox")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain publishes the pending events until there is none ready,
+// returning the number of events published
+func (r *Relay) Drain(ctx context.Context) (int, error) {
+	var published int
+
+	for ctx.Err() == nil {
+		events, err := r.outbox.Fetch(ctx, r.cfg.BatchSize)
+		if err != nil {
+			return published, err
+		}
+
+		if len(events) == 0 {
+			break
+		}
+
+		var acked int
+		for _, evt := range events {
+			err := r.publish(ctx, evt)
+			if err != nil {
+				xlogger.Logger(ctx).
+					WithError(err).
+					WithField("event_id", evt.ID).
+					WithField("event_type", evt.Type).
+					Warn("unable to publish event")
+
+				err = r.outbox.Retry(ctx, evt, TimeNow().Add(r.backoff(evt.Attempts)))
+				if err != nil {
+					return published, err
+				}
+
+				continue
+			}
+
+			err = r.outbox.Ack(ctx, evt)
+			if err != nil {
+				return published, err
+			}
+			acked++
+		}
+
+		published += acked
+
+		// everything fetched failed, wait the next poll to try again
+		if acked == 0 {
+			break
+		}
+	}
+
+	return published, nil
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := time.Duration(float64(r.cfg.RetryBackoff) * math.Pow(2, float64(attempts)))
+	if d <= 0 || d > r.cfg.MaxRetryBackoff {
+		return r.cfg.MaxRetryBackoff
+	}
+
+	return d
+}
+
+func (r *Relay) publish(ctx context.Context, evt *Event) error {
+	if evt.Type == EventUserEmailChanged {
+		change := EmailChange{User: new(User)}
+		err := json.Unmarshal(evt.Payload, &change)
+		if err != nil {
+			return fmt.Errorf("unable to decode event payload: %w", err)
+		}
+
+		return r.eventService.UserEmailChanged(ctx, &change)
+	}
+
+	var usr User
+	err := json.Unmarshal(evt.Payload, &usr)
+	if err != nil {
+		return fmt.Errorf("unable to decode event payload: %w", err)
+	}
+
+	switch evt.Type {
+	case EventUserCreated:
+		return r.eventService.UserCreated(ctx, &usr)
+	case EventUserUpdated:
+		return r.eventService.UserUpdated(ctx, &usr)
+	case EventUserDeleted:
+		return r.eventService.UserDeleted(ctx, &usr)
+	case EventUserRestored:
+		return r.eventService.UserRestored(ctx, &usr)
+	case EventUserPurged:
+		return r.eventService.UserPurged(ctx, &usr)
+	case EventUserLoggedIn:
+		return r.eventService.UserLoggedIn(ctx, &usr)
+	case EventUserEmailVerified:
+		return r.eventService.UserEmailVerified(ctx, &usr)
+	}
+
+	return fmt.Errorf("unknown event type: %s", evt.Type)
+}
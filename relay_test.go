@@ -0,0 +1,147 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+func newEvent(t *testing.T, typ string, usr *user.User) *user.Event {
+	evt, err := user.NewEvent(typ, usr)
+	require.NoError(t, err)
+
+	return evt
+}
+
+func Test_Relay_Drain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := xlogger.SetLogger(context.TODO(), xlogger.New(nil).WithFields(nil))
+
+	usr := &user.User{ID: "id", FirstName: "first", Email: "email", Country: "DE"}
+
+	created := newEvent(t, user.EventUserCreated, usr)
+	loggedIn := newEvent(t, user.EventUserLoggedIn, usr)
+	verified := newEvent(t, user.EventUserEmailVerified, usr)
+	deleted := newEvent(t, user.EventUserDeleted, usr)
+	restored := newEvent(t, user.EventUserRestored, usr)
+	purged := newEvent(t, user.EventUserPurged, usr)
+
+	outbox := mock.NewOutbox(ctrl)
+	eventSvc := mock.NewEventService(ctrl)
+
+	gomock.InOrder(
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{created}, nil),
+		eventSvc.EXPECT().UserCreated(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), created).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{loggedIn}, nil),
+		eventSvc.EXPECT().UserLoggedIn(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), loggedIn).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{verified}, nil),
+		eventSvc.EXPECT().UserEmailVerified(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), verified).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{deleted}, nil),
+		eventSvc.EXPECT().UserDeleted(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), deleted).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{restored}, nil),
+		eventSvc.EXPECT().UserRestored(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), restored).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{purged}, nil),
+		eventSvc.EXPECT().UserPurged(gomock.Any(), usr).Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), purged).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{}, nil),
+	)
+
+	relay := user.NewRelay(outbox, eventSvc, &user.RelayConfig{BatchSize: 10})
+
+	n, err := relay.Drain(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+}
+
+func Test_Relay_Drain_EmailChanged(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := xlogger.SetLogger(context.TODO(), xlogger.New(nil).WithFields(nil))
+
+	usr := &user.User{ID: "id", FirstName: "first", Email: "new@mail.com", Country: "DE"}
+
+	changed, err := user.NewEmailChangedEvent(usr, "old@mail.com")
+	require.NoError(t, err)
+
+	outbox := mock.NewOutbox(ctrl)
+	eventSvc := mock.NewEventService(ctrl)
+
+	gomock.InOrder(
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{changed}, nil),
+		eventSvc.EXPECT().
+			UserEmailChanged(gomock.Any(), &user.EmailChange{User: usr, OldEmail: "old@mail.com", NewEmail: usr.Email}).
+			Return(nil),
+		outbox.EXPECT().Ack(gomock.Any(), changed).Return(nil),
+		outbox.EXPECT().Fetch(gomock.Any(), 10).Return([]*user.Event{}, nil),
+	)
+
+	relay := user.NewRelay(outbox, eventSvc, &user.RelayConfig{BatchSize: 10})
+
+	n, err := relay.Drain(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func Test_Relay_Drain_PublishError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := xlogger.SetLogger(context.TODO(), xlogger.New(nil).WithFields(nil))
+
+	failing := newEvent(t, user.EventUserUpdated, &user.User{ID: "failing"})
+	failing.Attempts = 2
+	other := newEvent(t, user.EventUserUpdated, &user.User{ID: "other"})
+
+	outbox := mock.NewOutbox(ctrl)
+	eventSvc := mock.NewEventService(ctrl)
+
+	outbox.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return([]*user.Event{failing, other}, nil)
+	eventSvc.EXPECT().UserUpdated(gomock.Any(), &user.User{ID: "failing"}).Return(errors.New("some error"))
+	outbox.EXPECT().Retry(gomock.Any(), failing, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *user.Event, next time.Time) error {
+			// default backoff is one second doubled on each attempt
+			require.WithinDuration(t, user.TimeNow().Add(4*time.Second), next, time.Second)
+			return nil
+		})
+	eventSvc.EXPECT().UserUpdated(gomock.Any(), &user.User{ID: "other"}).Return(nil)
+	outbox.EXPECT().Ack(gomock.Any(), other).Return(nil)
+	outbox.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	relay := user.NewRelay(outbox, eventSvc, nil)
+
+	n, err := relay.Drain(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func Test_Relay_Drain_FetchError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := xlogger.SetLogger(context.TODO(), xlogger.New(nil).WithFields(nil))
+
+	outbox := mock.NewOutbox(ctrl)
+	outbox.EXPECT().Fetch(gomock.Any(), gomock.Any()).Return(nil, errors.New("some error"))
+
+	relay := user.NewRelay(outbox, mock.NewEventService(ctrl), nil)
+
+	n, err := relay.Drain(ctx)
+	require.Error(t, err)
+	require.Zero(t, n)
+}
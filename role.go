@@ -0,0 +1,52 @@
+package user
+
+const (
+	// RoleAdmin has all the permissions
+	RoleAdmin = "admin"
+	// RoleSupport can read every user
+	RoleSupport = "support"
+
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+	// PermissionUsersAdmin allows to grant and revoke roles
+	PermissionUsersAdmin = "users:admin"
+)
+
+// Role is a named set of permissions, the users have many roles
+// and the roles are granted to many users
+type Role struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// DefaultRoles are created by the storage migrations
+var DefaultRoles = []*Role{
+	{Name: RoleAdmin, Permissions: []string{PermissionUsersAdmin, PermissionUsersRead, PermissionUsersWrite}},
+	{Name: RoleSupport, Permissions: []string{PermissionUsersRead}},
+}
+
+// Permissions returns the permissions of the given roles, without repetitions
+func Permissions(roles []*Role, names []string) []string {
+	granted := make(map[string]bool)
+	for _, name := range names {
+		granted[name] = true
+	}
+
+	seen := make(map[string]bool)
+	permissions := make([]string, 0)
+
+	for _, r := range roles {
+		if !granted[r.Name] {
+			continue
+		}
+
+		for _, p := range r.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+
+	return permissions
+}
@@ -0,0 +1,29 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+)
+
+func Test_Permissions(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Roles    []string
+		Expected []string
+	}{
+		{"none", nil, []string{}},
+		{"support", []string{user.RoleSupport}, []string{user.PermissionUsersRead}},
+		{"admin", []string{user.RoleAdmin}, []string{user.PermissionUsersAdmin, user.PermissionUsersRead, user.PermissionUsersWrite}},
+		{"repeated", []string{user.RoleAdmin, user.RoleSupport}, []string{user.PermissionUsersAdmin, user.PermissionUsersRead, user.PermissionUsersWrite}},
+		{"unknown", []string{"unknown"}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, user.Permissions(user.DefaultRoles, tc.Roles))
+		})
+	}
+}
@@ -2,29 +2,90 @@ package user
 
 import (
 	"context"
+	"errors"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/cadicallegari/user/pkg/xlogger"
 )
 
 type service struct {
-	storage      Storage
-	eventService EventService
+	storage Storage
+	policy  *PasswordPolicy
+	hasher  PasswordHasher
+	lockout *Lockout
+	// twoFactor verifies the second factor of the users with it enabled
+	twoFactor TwoFactorService
 
-	passwordCost int
+	// dummyPassword is compared when the email is unknown, so the
+	// response time does not reveal which emails are registered
+	dummyPassword string
 }
 
-func NewService(storage Storage, eventService EventService, passwordCost int) *service {
-	return &service{
-		storage:      storage,
-		eventService: eventService,
-		passwordCost: passwordCost,
+type serviceOption func(*service)
+
+// NewService creates the user service, the events of the state changes are
+// recorded by the storage in the outbox and published by the Relay.
+// The passwords are hashed by bcrypt with passwordCost, unless WithPasswordHasher is used.
+func NewService(storage Storage, passwordCost int, opts ...serviceOption) *service {
+	s := &service{
+		storage: storage,
+		policy:  NewPasswordPolicy(nil, nil),
+		hasher:  &BcryptHasher{Cost: passwordCost},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.dummyPassword, _ = s.hasher.Hash("dummy password")
+
+	return s
+}
+
+// WithPasswordHasher replaces the bcrypt hasher of the passwords
+func WithPasswordHasher(h PasswordHasher) func(*service) {
+	return func(s *service) {
+		s.hasher = h
+	}
+}
+
+// WithLockout locks the accounts and throttles the IPs failing to authenticate
+func WithLockout(l *Lockout) func(*service) {
+	return func(s *service) {
+		s.lockout = l
 	}
 }
 
-func (s *service) encryptPassword(passwd string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(passwd), s.passwordCost)
+// WithTwoFactor requires the TOTP or recovery code, set by WithTwoFactorCode,
+// to authenticate the users with the two-factor enabled, a nil tf leaves it disabled
+func WithTwoFactor(tf TwoFactorService) func(*service) {
+	return func(s *service) {
+		s.twoFactor = tf
+	}
+}
+
+// WithPasswordPolicy replaces the default policy of the new passwords
+func WithPasswordPolicy(p *PasswordPolicy) func(*service) {
+	return func(s *service) {
+		s.policy = p
+	}
+}
+
+func (s *service) EncodePassword(ctx context.Context, usr *User, password string) (string, error) {
+	err := s.policy.Validate(ctx, &User{
+		Password: password,
+		Email:    usr.Email,
+		Nickname: usr.Nickname,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := s.hasher.Hash(password)
+	if err != nil {
+		return "", ErrInvalid
+	}
 
-	return string(bytes), err
+	return encoded, nil
 }
 
 func (s *service) List(ctx context.Context, opts *ListOptions) (*List, error) {
@@ -36,7 +97,13 @@ func (s *service) Get(ctx context.Context, id string) (*User, error) {
 }
 
 func (s *service) Save(ctx context.Context, usr *User) (*User, error) {
-	l, err := s.List(ctx, &ListOptions{Search: usr.Email})
+	normalizeUser(usr)
+	err := validateUser(usr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := s.List(ctx, &ListOptions{Email: usr.Email})
 	if err != nil {
 		return nil, err
 	}
@@ -46,66 +113,158 @@ func (s *service) Save(ctx context.Context, usr *User) (*User, error) {
 	}
 
 	if usr.Password != "" {
-		encoded, err := s.encryptPassword(usr.Password)
+		encoded, err := s.EncodePassword(ctx, usr, usr.Password)
 		if err != nil {
-			return nil, ErrInvalid
+			return nil, err
 		}
 		usr.EncodedPassword = encoded
 		usr.Password = ""
 	}
 
-	u, err := s.storage.Save(ctx, usr)
-	if err != nil {
-		return nil, err
-	}
-
-	// dual write problem, can be solved using listen yourself or outbox pattern for example
+	return s.storage.Save(ctx, usr)
+}
 
-	err = s.eventService.UserCreated(ctx, u)
+func (s *service) Update(ctx context.Context, usr *User) (*User, error) {
+	normalizeUser(usr)
+	err := validateUser(usr, false)
 	if err != nil {
 		return nil, err
 	}
 
-	return u, nil
-}
-
-func (s *service) Update(ctx context.Context, usr *User) (*User, error) {
 	if usr.Password != "" {
-		encoded, err := s.encryptPassword(usr.Password)
+		current, err := s.storage.Get(ctx, usr.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// the email is not changed by the update
+		encoded, err := s.EncodePassword(ctx, &User{Email: current.Email, Nickname: usr.Nickname}, usr.Password)
 		if err != nil {
-			return nil, ErrInvalid
+			return nil, err
 		}
 		usr.EncodedPassword = encoded
 		usr.Password = ""
 	}
 
-	u, err := s.storage.Update(ctx, usr)
+	return s.storage.Update(ctx, usr)
+}
+
+func (s *service) Delete(ctx context.Context, usr *User) error {
+	return s.storage.Delete(ctx, usr)
+}
+
+func (s *service) Restore(ctx context.Context, id string) (*User, error) {
+	return s.storage.Restore(ctx, id)
+}
+
+func (s *service) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	email = normalizeEmail(email)
+	if email == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if s.lockout != nil {
+		// the locked credentials are not checked at all
+		if err := s.lockout.Check(ctx, email, ClientIP(ctx)); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := s.List(ctx, &ListOptions{Email: email})
 	if err != nil {
 		return nil, err
 	}
 
-	// dual write problem, can be solved using listen yourself or outbox pattern for example
+	if len(l.Users) == 0 {
+		_, _ = s.hasher.Verify(s.dummyPassword, password)
+		return nil, s.failed(ctx, email)
+	}
 
-	err = s.eventService.UserUpdated(ctx, u)
+	usr := l.Users[0]
+
+	ok, err := s.hasher.Verify(usr.EncodedPassword, password)
+	if err != nil {
+		xlogger.Logger(ctx).WithError(err).WithField("user_id", usr.ID).Error("unable to verify password")
+		return nil, s.failed(ctx, email)
+	}
+	if !ok {
+		return nil, s.failed(ctx, email)
+	}
+
+	if s.twoFactor != nil {
+		// the wrong codes count as failed logins, so they can not be guessed
+		err := s.twoFactor.Verify(ctx, usr, TwoFactorCode(ctx))
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, s.failed(ctx, email)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.lockout != nil {
+		if err := s.lockout.Unlock(ctx, email); err != nil {
+			return nil, err
+		}
+	}
+
+	// the password is only known now, the outdated hashes are upgraded on login
+	if s.hasher.NeedsRehash(usr.EncodedPassword) {
+		s.rehash(ctx, usr, password)
+	}
+
+	err = s.storage.AddEvent(ctx, EventUserLoggedIn, usr)
 	if err != nil {
 		return nil, err
 	}
 
-	return u, nil
+	return usr, nil
 }
 
-func (s *service) Delete(ctx context.Context, usr *User) error {
-	err := s.storage.Delete(ctx, usr)
-	if err != nil {
+func (s *service) Roles(ctx context.Context) ([]*Role, error) {
+	return s.storage.Roles(ctx)
+}
+
+func (s *service) GrantRole(ctx context.Context, usr *User, role string) (*User, error) {
+	return s.storage.GrantRole(ctx, usr.ID, role)
+}
+
+func (s *service) RevokeRole(ctx context.Context, usr *User, role string) (*User, error) {
+	return s.storage.RevokeRole(ctx, usr.ID, role)
+}
+
+// failed records the failed login, returning ErrInvalidCredentials
+func (s *service) failed(ctx context.Context, email string) error {
+	if s.lockout == nil {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.lockout.Fail(ctx, email, ClientIP(ctx)); err != nil {
 		return err
 	}
 
-	// dual write problem, can be solved using listen yourself or outbox pattern for example
+	return ErrInvalidCredentials
+}
+
+func (s *service) Unlock(ctx context.Context, usr *User) error {
+	if s.lockout == nil {
+		return nil
+	}
+
+	return s.lockout.Unlock(ctx, usr.Email)
+}
 
-	err = s.eventService.UserDeleted(ctx, usr)
+// rehash replaces the encoded password of the user, the login
+// does not fail when it is not replaced
+func (s *service) rehash(ctx context.Context, usr *User, password string) {
+	encoded, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.storage.SetPassword(ctx, usr.ID, encoded)
+	}
 	if err != nil {
-		return err
+		xlogger.Logger(ctx).WithError(err).WithField("user_id", usr.ID).Warn("unable to rehash password")
+		return
 	}
 
-	return nil
+	usr.EncodedPassword = encoded
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/cadicallegari/user"
 	"github.com/cadicallegari/user/mock"
@@ -19,26 +20,21 @@ func Test_Create(t *testing.T) {
 		FirstName: "first",
 		LastName:  "last",
 		Nickname:  "nick",
-		Password:  "passwd",
-		Email:     "email",
+		Password:  "correct horse",
+		Email:     "email@mail.com",
 		Country:   "DE",
 	}
 
 	mockStorage := mock.NewStorage(ctrl)
 	mockStorage.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: usr.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
 		Return(&user.List{}, nil)
 
 	mockStorage.EXPECT().
 		Save(gomock.Any(), usr).
 		Return(usr, nil)
 
-	eventSvc := mock.NewEventService(ctrl)
-	eventSvc.EXPECT().
-		UserCreated(gomock.Any(), usr).
-		Return(nil)
-
-	svc := user.NewService(mockStorage, eventSvc, 5)
+	svc := user.NewService(mockStorage, 5)
 
 	gotUser, err := svc.Save(context.TODO(), usr)
 	require.NoError(t, err)
@@ -54,21 +50,19 @@ func Test_Create_AlreadyExists(t *testing.T) {
 		LastName:  "last",
 		Nickname:  "nick",
 		Password:  "passwd",
-		Email:     "email",
+		Email:     "email@mail.com",
 		Country:   "DE",
 	}
 
 	mockStorage := mock.NewStorage(ctrl)
 	mockStorage.EXPECT().
-		List(gomock.Any(), &user.ListOptions{Search: usr.Email}).
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
 		Return(&user.List{
 			Total: uint64(1),
 			Users: []*user.User{usr},
 		}, nil)
 
-	eventSvc := mock.NewEventService(ctrl)
-
-	svc := user.NewService(mockStorage, eventSvc, 5)
+	svc := user.NewService(mockStorage, 5)
 
 	gotUser, err := svc.Save(context.TODO(), usr)
 	require.ErrorIs(t, err, user.ErrAlreadyExists)
@@ -80,25 +74,24 @@ func Test_Update(t *testing.T) {
 	defer ctrl.Finish()
 
 	usr := &user.User{
+		ID:        "id",
 		FirstName: "first",
 		LastName:  "last",
 		Nickname:  "nick",
-		Password:  "passwd",
-		Email:     "email",
+		Password:  "correct horse",
+		Email:     "email@mail.com",
 		Country:   "DE",
 	}
 
 	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Get(gomock.Any(), usr.ID).
+		Return(&user.User{ID: usr.ID, Email: usr.Email}, nil)
 	mockStorage.EXPECT().
 		Update(gomock.Any(), usr).
 		Return(usr, nil)
 
-	eventSvc := mock.NewEventService(ctrl)
-	eventSvc.EXPECT().
-		UserUpdated(gomock.Any(), usr).
-		Return(nil)
-
-	svc := user.NewService(mockStorage, eventSvc, 5)
+	svc := user.NewService(mockStorage, 5)
 
 	gotUser, err := svc.Update(context.TODO(), usr)
 	require.NoError(t, err)
@@ -122,17 +115,56 @@ func Test_Delete(t *testing.T) {
 		Delete(gomock.Any(), usr).
 		Return(nil)
 
-	eventSvc := mock.NewEventService(ctrl)
-	eventSvc.EXPECT().
-		UserDeleted(gomock.Any(), usr).
-		Return(nil)
-
-	svc := user.NewService(mockStorage, eventSvc, 5)
+	svc := user.NewService(mockStorage, 5)
 
 	err := svc.Delete(context.TODO(), usr)
 	require.NoError(t, err)
 }
 
+func Test_Restore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", FirstName: "first", Email: "email", Country: "DE"}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Restore(gomock.Any(), usr.ID).
+		Return(usr, nil)
+
+	svc := user.NewService(mockStorage, 5)
+
+	got, err := svc.Restore(context.TODO(), usr.ID)
+	require.NoError(t, err)
+	require.Equal(t, usr, got)
+}
+
+func Test_GrantRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id"}
+	granted := &user.User{ID: "id", Roles: []string{user.RoleAdmin}}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		GrantRole(gomock.Any(), usr.ID, user.RoleAdmin).
+		Return(granted, nil)
+	mockStorage.EXPECT().
+		RevokeRole(gomock.Any(), usr.ID, user.RoleAdmin).
+		Return(usr, nil)
+
+	svc := user.NewService(mockStorage, 5)
+
+	got, err := svc.GrantRole(context.TODO(), usr, user.RoleAdmin)
+	require.NoError(t, err)
+	require.Equal(t, granted, got)
+
+	got, err = svc.RevokeRole(context.TODO(), usr, user.RoleAdmin)
+	require.NoError(t, err)
+	require.Equal(t, usr, got)
+}
+
 func Test_List(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -158,9 +190,62 @@ func Test_List(t *testing.T) {
 		List(gomock.Any(), opts).
 		Return(l, nil)
 
-	svc := user.NewService(mockStorage, mock.NewEventService(ctrl), 5)
+	svc := user.NewService(mockStorage, 5)
 
 	gotList, err := svc.List(context.TODO(), opts)
 	require.NoError(t, err)
 	require.Equal(t, uint64(1), gotList.Total)
 }
+
+func Test_Authenticate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	usr := &user.User{ID: "id", Email: "email", EncodedPassword: string(encoded)}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{usr}}, nil)
+
+	mockStorage.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, usr).
+		Return(nil)
+
+	svc := user.NewService(mockStorage, 4)
+
+	// the email is normalized as on creation
+	gotUser, err := svc.Authenticate(context.TODO(), " EMAIL", "passwd")
+	require.NoError(t, err)
+	require.Equal(t, usr, gotUser)
+}
+
+func Test_Authenticate_InvalidCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	usr := &user.User{ID: "id", Email: "email", EncodedPassword: string(encoded)}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{usr}}, nil)
+
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "unknown"}).
+		Return(&user.List{Users: []*user.User{}}, nil)
+
+	svc := user.NewService(mockStorage, 4)
+
+	for _, tc := range [][2]string{{usr.Email, "wrong"}, {"unknown", "passwd"}, {usr.Email, ""}} {
+		gotUser, err := svc.Authenticate(context.TODO(), tc[0], tc[1])
+		require.ErrorIs(t, err, user.ErrInvalidCredentials, tc)
+		require.Nil(t, gotUser)
+	}
+}
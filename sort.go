@@ -0,0 +1,145 @@
+package user
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	SortEmail     = "email"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortLastName  = "last_name"
+	SortCountry   = "country"
+	SortNickname  = "nickname"
+
+	// SortID is the last tie breaker, it can not be chosen by the clients
+	SortID = "id"
+	// SortScore is the relevance of a full text search, the storage
+	// puts it before the other fields when a SearchMode is used
+	SortScore = "score"
+)
+
+var sortable = map[string]bool{
+	SortEmail:     true,
+	SortCreatedAt: true,
+	SortUpdatedAt: true,
+	SortLastName:  true,
+	SortCountry:   true,
+	SortNickname:  true,
+}
+
+// SortField is a field used to order the users, descending when Desc is set.
+// The text fields are compared case insensitively.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// IsTime reports if the field holds a time.Time value
+func (f SortField) IsTime() bool {
+	return f.Name == SortCreatedAt || f.Name == SortUpdatedAt
+}
+
+// Value returns the value of the field in the given user, a time.Time
+// for time fields, a float64 for the score and a string for the others
+func (f SortField) Value(usr *User) interface{} {
+	switch f.Name {
+	case SortScore:
+		return usr.Score
+	case SortEmail:
+		return usr.Email
+	case SortCreatedAt:
+		return usr.CreatedAt
+	case SortUpdatedAt:
+		return usr.UpdatedAt
+	case SortLastName:
+		return usr.LastName
+	case SortCountry:
+		return usr.Country
+	case SortNickname:
+		return usr.Nickname
+	}
+
+	return usr.ID
+}
+
+// Compare returns -1, 0 or +1 depending on whether a is
+// before, equal or after b in the field order
+func (f SortField) Compare(a, b *User) int {
+	var c int
+
+	switch av, bv := f.Value(a), f.Value(b); av := av.(type) {
+	case time.Time:
+		bt := bv.(time.Time)
+		if av.Before(bt) {
+			c = -1
+		} else if av.After(bt) {
+			c = 1
+		}
+	case float64:
+		bf := bv.(float64)
+		if av < bf {
+			c = -1
+		} else if av > bf {
+			c = 1
+		}
+	case string:
+		if f.Name == SortID {
+			c = strings.Compare(av, bv.(string))
+		} else {
+			c = strings.Compare(strings.ToLower(av), strings.ToLower(bv.(string)))
+		}
+	}
+
+	if f.Desc {
+		return -c
+	}
+
+	return c
+}
+
+// ParseSort parses a comma separated list of fields, prefixed with - for
+// descending order, e.g. "-created_at,last_name". The email and the id are
+// appended as tie breakers, so the order is always deterministic.
+// It returns ErrInvalid for unknown or repeated fields.
+func ParseSort(s string) ([]SortField, error) {
+	fields := make([]SortField, 0)
+	seen := make(map[string]bool)
+
+	if s != "" {
+		for _, name := range strings.Split(s, ",") {
+			name = strings.TrimSpace(name)
+
+			f := SortField{Name: strings.TrimPrefix(name, "-")}
+			f.Desc = f.Name != name
+
+			if !sortable[f.Name] || seen[f.Name] {
+				return nil, ErrInvalid
+			}
+
+			seen[f.Name] = true
+			fields = append(fields, f)
+		}
+	}
+
+	if !seen[SortEmail] {
+		fields = append(fields, SortField{Name: SortEmail})
+	}
+
+	return append(fields, SortField{Name: SortID}), nil
+}
+
+// FormatSort is the inverse of ParseSort
+func FormatSort(fields []SortField) string {
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			names = append(names, "-"+f.Name)
+		} else {
+			names = append(names, f.Name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
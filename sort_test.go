@@ -0,0 +1,61 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+)
+
+func Test_ParseSort(t *testing.T) {
+	testCases := []struct {
+		Sort       string
+		WantFields []user.SortField
+		WantErr    error
+	}{
+		{
+			Sort: "",
+			WantFields: []user.SortField{
+				{Name: user.SortEmail},
+				{Name: user.SortID},
+			},
+		},
+		{
+			Sort: "-created_at,last_name",
+			WantFields: []user.SortField{
+				{Name: user.SortCreatedAt, Desc: true},
+				{Name: user.SortLastName},
+				{Name: user.SortEmail},
+				{Name: user.SortID},
+			},
+		},
+		{
+			Sort: "-email, country",
+			WantFields: []user.SortField{
+				{Name: user.SortEmail, Desc: true},
+				{Name: user.SortCountry},
+				{Name: user.SortID},
+			},
+		},
+		{Sort: "password", WantErr: user.ErrInvalid},
+		{Sort: "id", WantErr: user.ErrInvalid},
+		{Sort: "country,-country", WantErr: user.ErrInvalid},
+		{Sort: "country,", WantErr: user.ErrInvalid},
+	}
+
+	for _, tc := range testCases {
+		fields, err := user.ParseSort(tc.Sort)
+		require.ErrorIs(t, err, tc.WantErr, tc.Sort)
+		require.Equal(t, tc.WantFields, fields, tc.Sort)
+	}
+}
+
+func Test_SortField_Compare(t *testing.T) {
+	a := &user.User{LastName: "alice"}
+	b := &user.User{LastName: "Bob"}
+
+	require.Equal(t, -1, user.SortField{Name: user.SortLastName}.Compare(a, b))
+	require.Equal(t, 1, user.SortField{Name: user.SortLastName, Desc: true}.Compare(a, b))
+	require.Equal(t, 0, user.SortField{Name: user.SortLastName}.Compare(b, &user.User{LastName: "BOB"}))
+}
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id VARCHAR(100) NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    nickname VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL COLLATE NOCASE,
+    encoded_password VARCHAR(200) NOT NULL,
+    country VARCHAR(8) NOT NULL COLLATE NOCASE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (email)
+);
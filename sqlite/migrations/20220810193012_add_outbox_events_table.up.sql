@@ -0,0 +1,12 @@
+CREATE TABLE outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type VARCHAR(100) NOT NULL,
+    user_id VARCHAR(100) NOT NULL,
+    payload BLOB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    next_attempt_at DATETIME NOT NULL
+);
+
+CREATE INDEX outbox_events_user_id_idx ON outbox_events (user_id, id);
+CREATE INDEX outbox_events_next_attempt_at_idx ON outbox_events (next_attempt_at);
@@ -0,0 +1,10 @@
+CREATE TABLE refresh_tokens (
+    id VARCHAR(100) NOT NULL PRIMARY KEY,
+    user_id VARCHAR(100) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    revoked_at DATETIME NULL
+);
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
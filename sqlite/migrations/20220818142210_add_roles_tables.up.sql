@@ -0,0 +1,27 @@
+CREATE TABLE roles (
+    name VARCHAR(100) NOT NULL PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE role_permissions (
+    role VARCHAR(100) NOT NULL,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE user_roles (
+    user_id VARCHAR(100) NOT NULL,
+    role VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX user_roles_role_idx ON user_roles (role);
+
+INSERT INTO roles (name) VALUES ('admin'), ('support');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:admin'),
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('support', 'users:read');
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME NULL;
+
+CREATE TABLE verification_tokens (
+    id VARCHAR(100) NOT NULL PRIMARY KEY,
+    user_id VARCHAR(100) NOT NULL,
+    purpose VARCHAR(50) NOT NULL,
+    email VARCHAR(200) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    used_at DATETIME NULL
+);
+
+CREATE INDEX verification_tokens_user_id_idx ON verification_tokens (user_id);
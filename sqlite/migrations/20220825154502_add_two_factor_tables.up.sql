@@ -0,0 +1,14 @@
+CREATE TABLE two_factors (
+    user_id VARCHAR(100) NOT NULL PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    confirmed_at DATETIME NULL
+);
+
+CREATE TABLE two_factor_recovery_codes (
+    user_id VARCHAR(100) NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
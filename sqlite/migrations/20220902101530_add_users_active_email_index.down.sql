@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_email_key;
+
+-- fails while a deleted user has the email of an active one
+CREATE UNIQUE INDEX users_email_key ON users (email);
@@ -0,0 +1,35 @@
+-- the deleted users keep their rows until purged, only the emails of the
+-- active users are unique. The UNIQUE constraint of the table can not be
+-- dropped, so the table is rebuilt without it
+CREATE TABLE users_new (
+    id VARCHAR(100) NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    nickname VARCHAR(100) NOT NULL,
+    email VARCHAR(100) NOT NULL COLLATE NOCASE,
+    encoded_password VARCHAR(200) NOT NULL,
+    country VARCHAR(8) NOT NULL COLLATE NOCASE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    email_verified_at DATETIME NULL,
+    deleted_at DATETIME NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (id)
+);
+
+INSERT INTO users_new (
+    id, first_name, last_name, nickname, email, encoded_password, country,
+    created_at, updated_at, email_verified_at, deleted_at, version
+)
+SELECT
+    id, first_name, last_name, nickname, email, encoded_password, country,
+    created_at, updated_at, email_verified_at, deleted_at, version
+FROM users;
+
+DROP TABLE users;
+
+ALTER TABLE users_new RENAME TO users;
+
+CREATE INDEX users_deleted_at_idx ON users (deleted_at);
+
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE deleted_at IS NULL;
@@ -0,0 +1,109 @@
+package sqlite_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql"
+	"github.com/cadicallegari/user/pkg/xdatabase/xsql/xsqlite"
+	"github.com/cadicallegari/user/sqlite"
+)
+
+func connect(t *testing.T) *xsql.DB {
+	cfg := &xsqlite.Config{}
+	cfg.URL = "file:" + filepath.Join(t.TempDir(), "user.db")
+	cfg.MigrationsDir = "migrations"
+	cfg.RunMigration = true
+
+	db, err := xsqlite.Connect(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func Test_Outbox(t *testing.T) {
+	db := connect(t)
+	storage := sqlite.NewStorage(db)
+	outbox := sqlite.NewOutbox(db)
+
+	u, err := storage.Save(context.TODO(), &user.User{
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	require.NoError(t, err)
+
+	_, err = storage.Update(context.TODO(), u)
+	require.NoError(t, err)
+
+	events, err := outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, user.EventUserCreated, events[0].Type)
+
+	// the next event of the user waits for the retried one
+	err = outbox.Retry(context.TODO(), events[0], time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	events, err = outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func Test_Outbox_AddEvent(t *testing.T) {
+	db := connect(t)
+	storage := sqlite.NewStorage(db)
+	outbox := sqlite.NewOutbox(db)
+
+	u := &user.User{ID: "id", Email: "email@mail.com"}
+
+	err := storage.AddEvent(context.TODO(), user.EventUserLoggedIn, u)
+	require.NoError(t, err)
+
+	events, err := outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, user.EventUserLoggedIn, events[0].Type)
+	require.Equal(t, u.ID, events[0].UserID)
+}
+
+func Test_Outbox_EmailChanged(t *testing.T) {
+	db := connect(t)
+	storage := sqlite.NewStorage(db)
+	outbox := sqlite.NewOutbox(db)
+
+	u, err := storage.Save(context.TODO(), &user.User{
+		FirstName:       "first",
+		Email:           "old@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	require.NoError(t, err)
+
+	events, err := outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Ack(context.TODO(), events[0]))
+
+	_, err = storage.ChangeEmail(context.TODO(), u.ID, "new@mail.com")
+	require.NoError(t, err)
+
+	events, err = outbox.Fetch(context.TODO(), 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, user.EventUserEmailChanged, events[0].Type)
+	require.Equal(t, u.ID, events[0].UserID)
+
+	var change user.EmailChange
+	require.NoError(t, json.Unmarshal(events[0].Payload, &change))
+	require.Equal(t, "old@mail.com", change.OldEmail)
+	require.Equal(t, "new@mail.com", change.NewEmail)
+	require.Equal(t, u.ID, change.ID)
+}
@@ -0,0 +1,764 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+type UserStorage struct {
+	db *sqlx.DB
+}
+
+var TimeNow = func() time.Time {
+	return time.Now().UTC()
+}
+
+var baseSelect = sq.Select(
+	"u.id",
+	"u.first_name",
+	"u.last_name",
+	"u.nickname",
+	"u.email",
+	"u.encoded_password",
+	"u.country",
+	"u.created_at",
+	"u.updated_at",
+	"u.email_verified_at",
+	"u.deleted_at",
+	"u.version",
+).From("users u")
+
+func NewStorage(db *sqlx.DB) *UserStorage {
+	return &UserStorage{
+		db: db,
+	}
+}
+
+func validateUser(u *user.User) error {
+	verr := new(user.ValidationError)
+	verr.Required("id", u.ID)
+	verr.Required("first_name", u.FirstName)
+	verr.Required("email", u.Email)
+	verr.Required("password", u.EncodedPassword)
+	verr.Required("country", u.Country)
+
+	return verr.Err()
+}
+
+// isDuplicateEntry reports if err is a unique or primary key constraint violation
+func isDuplicateEntry(err error) bool {
+	var serr sqlite3.Error
+	if errors.As(err, &serr) {
+		return serr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			serr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	return false
+}
+
+// affectedRows runs before the page query, the single connection
+// can not be shared by concurrent queries
+func (s *UserStorage) affectedRows(ctx context.Context, opts *user.ListOptions) (uint64, error) {
+	var total uint64
+
+	q := buildFilterSelect(
+		sq.Select("COUNT(*)").From("users u"),
+		opts,
+	)
+
+	row := q.RunWith(s.db).QueryRowContext(ctx)
+	err := row.Scan(&total)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithError(err).
+			WithField("query", sq.DebugSqlizer(q)).
+			Error("unable to get total of affected rows")
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// sortColumn returns the column of the sort field,
+// the text columns are compared case insensitively
+func sortColumn(f user.SortField) string {
+	if f.IsTime() || f.Name == user.SortID {
+		return "u." + f.Name
+	}
+
+	return "u." + f.Name + " COLLATE NOCASE"
+}
+
+func orderBy(fields []user.SortField) []string {
+	order := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.Desc {
+			order = append(order, sortColumn(f)+" DESC")
+		} else {
+			order = append(order, sortColumn(f)+" ASC")
+		}
+	}
+
+	return order
+}
+
+// keyset returns the condition selecting the users after the cursor values
+func keyset(fields []user.SortField, values []interface{}) sq.Or {
+	cond := sq.Or{}
+
+	for i, f := range fields {
+		and := sq.And{}
+		for j := 0; j < i; j++ {
+			and = append(and, sq.Expr(sortColumn(fields[j])+" = ?", values[j]))
+		}
+
+		op := " > ?"
+		if f.Desc {
+			op = " < ?"
+		}
+		and = append(and, sq.Expr(sortColumn(f)+op, values[i]))
+
+		cond = append(cond, and)
+	}
+
+	return cond
+}
+
+func buildFilterSelect(qOrigin sq.SelectBuilder, opts *user.ListOptions) sq.SelectBuilder {
+	q := qOrigin
+
+	if !opts.IncludeDeleted {
+		q = q.Where(sq.Eq{"u.deleted_at": nil})
+	}
+
+	// country and email columns are case insensitive, as in the mysql collation
+	if countries := opts.Countries(); len(countries) > 0 {
+		q = q.Where(sq.Eq{"u.country": countries})
+	}
+
+	if opts.Email != "" {
+		q = q.Where(sq.Eq{"u.email": opts.Email})
+	}
+
+	if opts.Nickname != "" {
+		q = q.Where(sq.Eq{"u.nickname COLLATE NOCASE": opts.Nickname})
+	}
+
+	if opts.Search != "" {
+		term := fmt.Sprint("%", opts.Search, "%")
+		q = q.Where(sq.Or{
+			sq.Like{"u.first_name": term},
+			sq.Like{"u.last_name": term},
+			sq.Like{"u.nickname": term},
+			sq.Like{"u.email": term},
+		})
+	}
+
+	// the times are compared as text, they must be in the same location
+	if !opts.CreatedAfter.IsZero() {
+		q = q.Where(sq.Gt{"u.created_at": opts.CreatedAfter.UTC()})
+	}
+
+	if !opts.CreatedBefore.IsZero() {
+		q = q.Where(sq.Lt{"u.created_at": opts.CreatedBefore.UTC()})
+	}
+
+	if !opts.UpdatedSince.IsZero() {
+		q = q.Where(sq.GtOrEq{"u.updated_at": opts.UpdatedSince.UTC()})
+	}
+
+	return q
+}
+
+func (s *UserStorage) List(ctx context.Context, opts *user.ListOptions) (*user.List, error) {
+	if opts.PerPage == 0 {
+		opts.PerPage = user.DefaultPerPage
+	}
+
+	// there is no full text index, the search modes use the substring search
+	if !user.ValidSearchMode(opts.SearchMode) {
+		return nil, user.ErrInvalid
+	}
+
+	fields, err := user.ParseSort(opts.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	var cursor []interface{}
+	if opts.Cursor != "" {
+		cursor, err = user.ParseCursor(opts.Cursor, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var total uint64
+	if cursor == nil {
+		total, err = s.affectedRows(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q := baseSelect.
+		OrderBy(orderBy(fields)...).
+		Limit(uint64(opts.PerPage) + 1)
+
+	if cursor == nil {
+		q = q.Offset(uint64(opts.Page * opts.PerPage))
+	} else {
+		q = q.Where(keyset(fields, cursor))
+	}
+
+	q = buildFilterSelect(q, opts)
+
+	query, args := q.MustSql()
+
+	rows, err := s.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		xlogger.Logger(ctx).
+			WithField("query", sq.DebugSqlizer(q)).
+			WithError(err).
+			Error("unable to get users")
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := new(user.List)
+	list.Users = make([]*user.User, 0)
+
+	for rows.Next() {
+		var u user.User
+		err := rows.StructScan(&u)
+		if err != nil {
+			return nil, err
+		}
+
+		list.Users = append(list.Users, &u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the page numbers are kept for backwards compatibility
+	if cursor == nil {
+		list.Total = total
+
+		if opts.Page > 0 {
+			prev := opts.Page - 1
+			list.PrevPage = &prev
+		}
+
+		if len(list.Users) > int(opts.PerPage) {
+			next := opts.Page + 1
+			list.NextPage = &next
+		}
+	}
+
+	if len(list.Users) > int(opts.PerPage) {
+		list.Users = list.Users[:len(list.Users)-1]
+		list.NextCursor = user.NewCursor(fields, list.Users[len(list.Users)-1])
+	}
+
+	if err := loadRoles(ctx, s.db, list.Users...); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (s *UserStorage) Save(ctx context.Context, usr *user.User) (*user.User, error) {
+	if usr.ID == "" {
+		usr.ID = uuid.NewString()
+	}
+
+	err := validateUser(usr)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved *user.User
+
+	now := TimeNow()
+
+	err = withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Insert("users").
+			Columns(
+				"id",
+				"first_name",
+				"last_name",
+				"nickname",
+				"email",
+				"encoded_password",
+				"country",
+				"created_at",
+				"updated_at",
+			).
+			Values(
+				usr.ID,
+				usr.FirstName,
+				usr.LastName,
+				usr.Nickname,
+				usr.Email,
+				usr.EncodedPassword,
+				usr.Country,
+				now,
+				now,
+			)
+		_, err := q.RunWith(tx).ExecContext(ctx)
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to save user")
+			return err
+		}
+
+		saved, err = get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserCreated, saved)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+func (s *UserStorage) Update(ctx context.Context, usr *user.User) (*user.User, error) {
+	if usr.ID == "" {
+		return nil, user.ErrInvalid
+	}
+
+	var updated *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("first_name", usr.FirstName).
+			Set("last_name", usr.LastName).
+			Set("nickname", usr.Nickname).
+			Set("country", usr.Country).
+			Set("updated_at", TimeNow()).
+			Set("version", sq.Expr("version + 1")).
+			Where(sq.Eq{"id": usr.ID, "deleted_at": nil})
+
+		if usr.EncodedPassword != "" {
+			q = q.Set("encoded_password", usr.EncodedPassword)
+		}
+
+		if usr.Version != 0 {
+			q = q.Where(sq.Eq{"version": usr.Version})
+		}
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to save user")
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			// unknown user or changed since the version
+			if _, err := get(ctx, tx, usr.ID); err != nil {
+				return err
+			}
+			return user.ErrConflict
+		}
+
+		updated, err = get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserUpdated, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// SetPassword does not record an event, the users do not change when their
+// passwords are rehashed, but as any write it increments the version
+func (s *UserStorage) SetPassword(ctx context.Context, userID, encodedPassword string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		return setPassword(ctx, tx, userID, encodedPassword)
+	})
+}
+
+func (s *UserStorage) ResetPassword(ctx context.Context, userID, tokenHash, encodedPassword string) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		if _, err := get(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		// the update is atomic, a concurrent reset with the same token fails
+		res, err := sq.Update("verification_tokens").
+			Set("used_at", TimeNow()).
+			Where(sq.Eq{
+				"token_hash": tokenHash,
+				"user_id":    userID,
+				"purpose":    user.PurposePasswordReset,
+				"used_at":    nil,
+			}).
+			RunWith(tx).
+			ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+
+		err = setPassword(ctx, tx, userID, encodedPassword)
+		if err != nil {
+			return err
+		}
+
+		_, err = sq.Update("refresh_tokens").
+			Set("revoked_at", TimeNow()).
+			Where(sq.Eq{"user_id": userID, "revoked_at": nil}).
+			RunWith(tx).
+			ExecContext(ctx)
+
+		return err
+	})
+}
+
+func setPassword(ctx context.Context, tx *sqlx.Tx, userID, encodedPassword string) error {
+	q := sq.Update("users").
+		Set("encoded_password", encodedPassword).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"id": userID})
+
+	_, err := q.RunWith(tx).ExecContext(ctx)
+
+	return err
+}
+
+func (s *UserStorage) VerifyEmail(ctx context.Context, userID, email string) (*user.User, error) {
+	var verified *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("email_verified_at", TimeNow()).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", TimeNow()).
+			Where(sq.Eq{"id": userID, "email": email, "email_verified_at": nil})
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		verified, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// the email was changed after the token was sent
+		if verified.Email != email {
+			return user.ErrNotFound
+		}
+
+		// already verified
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil
+		}
+
+		return addEvent(ctx, tx, user.EventUserEmailVerified, verified)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return verified, nil
+}
+
+func (s *UserStorage) ChangeEmail(ctx context.Context, userID, email string) (*user.User, error) {
+	var changed *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		current, err := get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// already changed
+		if current.Email == email {
+			changed = current
+			return nil
+		}
+
+		q := sq.Update("users").
+			Set("email", email).
+			// the email was confirmed by the token sent to it
+			Set("email_verified_at", TimeNow()).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", TimeNow()).
+			Where(sq.Eq{"id": userID})
+
+		_, err = q.RunWith(tx).ExecContext(ctx)
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			xlogger.Logger(ctx).
+				WithField("query", sq.DebugSqlizer(q)).
+				WithError(err).
+				Error("unable to change email")
+			return err
+		}
+
+		changed, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		evt, err := user.NewEmailChangedEvent(changed, current.Email)
+		if err != nil {
+			return err
+		}
+
+		return saveEvent(ctx, tx, evt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
+
+func (s *UserStorage) Get(ctx context.Context, id string) (*user.User, error) {
+	return get(ctx, s.db, id)
+}
+
+func get(ctx context.Context, db sqlx.QueryerContext, id string) (*user.User, error) {
+	q := baseSelect.Where(sq.Eq{"u.id": id, "u.deleted_at": nil})
+
+	query, args := q.MustSql()
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var u user.User
+
+	for rows.Next() {
+		err := rows.StructScan(&u)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if u.ID == "" {
+		return nil, user.ErrNotFound
+	}
+
+	if err := loadRoles(ctx, db, &u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *UserStorage) Delete(ctx context.Context, usr *user.User) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		deleted, err := get(ctx, tx, usr.ID)
+		if err != nil {
+			return err
+		}
+
+		now := TimeNow()
+
+		q := sq.Update("users").
+			Set("deleted_at", now).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", now).
+			Where(sq.Eq{"id": usr.ID, "deleted_at": nil})
+
+		if usr.Version != 0 {
+			q = q.Where(sq.Eq{"version": usr.Version})
+		}
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrConflict
+		}
+
+		deleted.DeletedAt = &now
+		deleted.UpdatedAt = now
+		deleted.Version++
+
+		return addEvent(ctx, tx, user.EventUserDeleted, deleted)
+	})
+}
+
+func (s *UserStorage) Restore(ctx context.Context, userID string) (*user.User, error) {
+	var restored *user.User
+
+	err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		q := sq.Update("users").
+			Set("deleted_at", nil).
+			Set("version", sq.Expr("version + 1")).
+			Set("updated_at", TimeNow()).
+			Where(sq.Eq{"id": userID}).
+			Where(sq.NotEq{"deleted_at": nil})
+
+		res, err := q.RunWith(tx).ExecContext(ctx)
+		// another active user took the email meanwhile
+		if isDuplicateEntry(err) {
+			return user.ErrAlreadyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			return user.ErrNotFound
+		}
+
+		restored, err = get(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, user.EventUserRestored, restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return restored, nil
+}
+
+// userTables have the rows keyed by the user ID, removed by the purge
+var userTables = []string{
+	"user_roles",
+	"refresh_tokens",
+	"verification_tokens",
+	"two_factors",
+	"two_factor_recovery_codes",
+}
+
+// Purge removes each user in its own transaction, the users restored or
+// purged by another instance meanwhile are skipped
+func (s *UserStorage) Purge(ctx context.Context, deletedBefore time.Time, limit int) (int, error) {
+	q := baseSelect.
+		Where(sq.Lt{"u.deleted_at": deletedBefore.UTC()}).
+		OrderBy("u.deleted_at").
+		Limit(uint64(limit))
+
+	query, args := q.MustSql()
+
+	users := make([]*user.User, 0)
+
+	err := sqlx.SelectContext(ctx, s.db, &users, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := loadRoles(ctx, s.db, users...); err != nil {
+		return 0, err
+	}
+
+	var purged int
+
+	for _, u := range users {
+		err := withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+			q := sq.Delete("users").
+				Where(sq.Eq{"id": u.ID}).
+				Where(sq.Lt{"deleted_at": deletedBefore.UTC()})
+
+			res, err := q.RunWith(tx).ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+
+			if n, _ := res.RowsAffected(); n == 0 {
+				return user.ErrNotFound
+			}
+
+			// the tables have no foreign keys, the rows of the user are removed along
+			for _, table := range userTables {
+				_, err = sq.Delete(table).Where(sq.Eq{"user_id": u.ID}).RunWith(tx).ExecContext(ctx)
+				if err != nil {
+					return err
+				}
+			}
+
+			return addEvent(ctx, tx, user.EventUserPurged, u)
+		})
+		if errors.Is(err, user.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *UserStorage) AddEvent(ctx context.Context, typ string, usr *user.User) error {
+	return withTx(ctx, s.db, func(tx *sqlx.Tx) error {
+		return addEvent(ctx, tx, typ, usr)
+	})
+}
+
+// withTx runs fn inside a transaction of db, committing it if fn succeeds,
+// it is shared by the storages of the package
+func withTx(ctx context.Context, db *sqlx.DB, fn func(*sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			xlogger.Logger(ctx).WithError(rbErr).Error("unable to rollback transaction")
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,54 @@
+package sqlite_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xcrypto"
+	"github.com/cadicallegari/user/sqlite"
+	"github.com/cadicallegari/user/storagetest"
+)
+
+func TestUserStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) user.Storage {
+		return sqlite.NewStorage(connect(t))
+	})
+}
+
+func TestTokenStorage(t *testing.T) {
+	storagetest.RunTokens(t, func(t *testing.T) user.TokenStorage {
+		return sqlite.NewTokenStorage(connect(t))
+	})
+}
+
+func TestTwoFactorStorage(t *testing.T) {
+	storagetest.RunTwoFactors(t, func(t *testing.T) user.TwoFactorStorage {
+		key, err := xcrypto.GenerateKey()
+		require.NoError(t, err)
+
+		cipher, err := xcrypto.NewCipher(key)
+		require.NoError(t, err)
+
+		return sqlite.NewTwoFactorStorage(connect(t), cipher)
+	})
+}
+
+func TestStorages(t *testing.T) {
+	storagetest.RunStorages(t, func(t *testing.T) *storagetest.Storages {
+		db := connect(t)
+
+		key, err := xcrypto.GenerateKey()
+		require.NoError(t, err)
+
+		cipher, err := xcrypto.NewCipher(key)
+		require.NoError(t, err)
+
+		return &storagetest.Storages{
+			Users:      sqlite.NewStorage(db),
+			Tokens:     sqlite.NewTokenStorage(db),
+			TwoFactors: sqlite.NewTwoFactorStorage(db, cipher),
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// AttemptFactory returns an empty attempt storage for each test,
+// resources should be released using t.Cleanup
+type AttemptFactory func(t *testing.T) user.AttemptStorage
+
+// RunAttempts certifies the storage created by factory against the user.AttemptStorage contract
+func RunAttempts(t *testing.T, factory AttemptFactory) {
+	suite.Run(t, &AttemptStorageSuite{factory: factory})
+}
+
+type AttemptStorageSuite struct {
+	suite.Suite
+	factory AttemptFactory
+
+	storage user.AttemptStorage
+	ctx     context.Context
+}
+
+func (s *AttemptStorageSuite) SetupTest() {
+	s.storage = s.factory(s.T())
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", s.T().Name()))
+}
+
+func (s *AttemptStorageSuite) Test_Get_None() {
+	a, err := s.storage.Get(s.ctx, "unknown")
+	s.NoError(err)
+	s.Nil(a)
+}
+
+func (s *AttemptStorageSuite) Test_Fail() {
+	first := time.Now().UTC().Truncate(time.Microsecond)
+
+	for i := 1; i <= 3; i++ {
+		at := first.Add(time.Duration(i-1) * time.Second)
+
+		a, err := s.storage.Fail(s.ctx, "key", at, time.Minute)
+		s.Require().NoError(err)
+		s.Equal("key", a.Key)
+		s.Equal(i, a.Failures)
+		s.True(first.Equal(a.FirstFailureAt), a.FirstFailureAt)
+		s.True(at.Equal(a.LastFailureAt), a.LastFailureAt)
+	}
+
+	_, err := s.storage.Fail(s.ctx, "other", first, time.Minute)
+	s.Require().NoError(err)
+
+	got, err := s.storage.Get(s.ctx, "key")
+	s.Require().NoError(err)
+	s.Equal(3, got.Failures)
+	s.True(first.Equal(got.FirstFailureAt), got.FirstFailureAt)
+}
+
+func (s *AttemptStorageSuite) Test_Fail_AfterWindow() {
+	first := time.Now().UTC().Truncate(time.Microsecond)
+
+	_, err := s.storage.Fail(s.ctx, "key", first, time.Minute)
+	s.Require().NoError(err)
+	_, err = s.storage.Fail(s.ctx, "key", first.Add(time.Second), time.Minute)
+	s.Require().NoError(err)
+
+	// the failures older than the window are forgotten
+	later := first.Add(time.Second + 2*time.Minute)
+
+	a, err := s.storage.Fail(s.ctx, "key", later, time.Minute)
+	s.Require().NoError(err)
+	s.Equal(1, a.Failures)
+	s.True(later.Equal(a.FirstFailureAt), a.FirstFailureAt)
+	s.True(later.Equal(a.LastFailureAt), a.LastFailureAt)
+}
+
+func (s *AttemptStorageSuite) Test_Reset() {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	_, err := s.storage.Fail(s.ctx, "key", now, time.Minute)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.storage.Reset(s.ctx, "key"))
+
+	a, err := s.storage.Get(s.ctx, "key")
+	s.NoError(err)
+	s.Nil(a)
+
+	// unknown keys are ignored
+	s.NoError(s.storage.Reset(s.ctx, "unknown"))
+}
+
+func (s *AttemptStorageSuite) Test_Expire() {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	for key, at := range map[string]time.Time{
+		"account:old": now.Add(-2 * time.Hour),
+		"account:new": now,
+		"ip:old":      now.Add(-2 * time.Hour),
+	} {
+		_, err := s.storage.Fail(s.ctx, key, at, time.Hour)
+		s.Require().NoError(err)
+	}
+
+	n, err := s.storage.Expire(s.ctx, "account:", now.Add(-time.Hour))
+	s.Require().NoError(err)
+	s.Equal(1, n)
+
+	a, err := s.storage.Get(s.ctx, "account:old")
+	s.NoError(err)
+	s.Nil(a)
+
+	// the keys failing after the given time and of other prefixes are kept
+	for _, key := range []string{"account:new", "ip:old"} {
+		a, err := s.storage.Get(s.ctx, key)
+		s.NoError(err)
+		s.NotNil(a, key)
+	}
+}
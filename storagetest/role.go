@@ -0,0 +1,120 @@
+package storagetest
+
+import (
+	"time"
+
+	"github.com/cadicallegari/user"
+)
+
+func (s *StorageSuite) Test_Roles() {
+	roles, err := s.storage.Roles(s.ctx)
+	if s.NoError(err) {
+		s.Equal(user.DefaultRoles, roles)
+	}
+}
+
+func (s *StorageSuite) Test_Create_WithoutRoles() {
+	u := s.createUsers([]string{"DE"})[0]
+	s.Equal([]string{}, u.Roles)
+}
+
+func (s *StorageSuite) Test_GrantRole() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	got, err := s.storage.GrantRole(s.ctx, u.ID, user.RoleSupport)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleSupport}, got.Roles)
+	}
+
+	got, err = s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleAdmin, user.RoleSupport}, got.Roles)
+	}
+
+	// granting twice keeps a single role
+	got, err = s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleAdmin, user.RoleSupport}, got.Roles)
+	}
+
+	got, err = s.storage.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleAdmin, user.RoleSupport}, got.Roles)
+	}
+
+	list, err := s.storage.List(s.ctx, &user.ListOptions{})
+	if s.NoError(err) && s.Len(list.Users, 1) {
+		s.Equal([]string{user.RoleAdmin, user.RoleSupport}, list.Users[0].Roles)
+	}
+}
+
+func (s *StorageSuite) Test_GrantRole_Unknown() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	got, err := s.storage.GrantRole(s.ctx, u.ID, "unknown")
+	s.ErrorIs(err, user.ErrInvalid)
+	s.Nil(got)
+
+	got, err = s.storage.GrantRole(s.ctx, "inexistent", user.RoleAdmin)
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_RevokeRole() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	_, err := s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+	_, err = s.storage.GrantRole(s.ctx, u.ID, user.RoleSupport)
+	s.Require().NoError(err)
+
+	got, err := s.storage.RevokeRole(s.ctx, u.ID, user.RoleAdmin)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleSupport}, got.Roles)
+	}
+
+	// revoking a role the user does not have changes nothing
+	got, err = s.storage.RevokeRole(s.ctx, u.ID, user.RoleAdmin)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleSupport}, got.Roles)
+	}
+
+	got, err = s.storage.RevokeRole(s.ctx, "inexistent", user.RoleAdmin)
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Restore_KeepsRoles() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	granted, err := s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.storage.Delete(s.ctx, granted))
+
+	_, err = s.storage.GrantRole(s.ctx, u.ID, user.RoleSupport)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	got, err := s.storage.Restore(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleAdmin}, got.Roles)
+	}
+}
+
+func (s *StorageSuite) Test_Purge_RemovesRoles() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	granted, err := s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.storage.Delete(s.ctx, granted))
+
+	_, err = s.storage.Purge(s.ctx, time.Now().Add(time.Hour), 10)
+	s.Require().NoError(err)
+
+	// a new user with the same ID does not get the roles of the purged one
+	got, err := s.storage.Save(s.ctx, u)
+	if s.NoError(err) {
+		s.Equal([]string{}, got.Roles)
+	}
+}
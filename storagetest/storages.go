@@ -0,0 +1,160 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// Storages are the storages of the users sharing the same database
+type Storages struct {
+	Users      user.Storage
+	Tokens     user.TokenStorage
+	TwoFactors user.TwoFactorStorage
+}
+
+// StoragesFactory returns empty storages for each test,
+// resources should be released using t.Cleanup
+type StoragesFactory func(t *testing.T) *Storages
+
+// RunStorages certifies the writes of the user storage created by factory
+// spanning the other storages, as the purge and the password reset
+func RunStorages(t *testing.T, factory StoragesFactory) {
+	suite.Run(t, &StoragesSuite{factory: factory})
+}
+
+type StoragesSuite struct {
+	suite.Suite
+	factory StoragesFactory
+
+	storages *Storages
+	ctx      context.Context
+}
+
+func (s *StoragesSuite) SetupTest() {
+	s.storages = s.factory(s.T())
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", s.T().Name()))
+}
+
+// createUser saves the user with a role, tokens and a confirmed two-factor
+func (s *StoragesSuite) createUser(email string) *user.User {
+	u, err := s.storages.Users.Save(s.ctx, &user.User{
+		FirstName:       "first",
+		Email:           email,
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.Require().NoError(err)
+
+	u, err = s.storages.Users.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+
+	rt := newRefreshToken(u.ID)
+	rt.UserID = u.ID
+	s.Require().NoError(s.storages.Tokens.SaveRefreshToken(s.ctx, rt))
+
+	vt := newVerificationToken(u.ID, user.PurposePasswordReset)
+	vt.UserID = u.ID
+	s.Require().NoError(s.storages.Tokens.SaveVerificationToken(s.ctx, vt))
+
+	s.Require().NoError(s.storages.TwoFactors.SaveTwoFactor(s.ctx, newTwoFactor(u.ID, "SECRET")))
+	s.Require().NoError(s.storages.TwoFactors.ConfirmTwoFactor(s.ctx, u.ID, 1, []string{"recovery-" + u.ID}))
+
+	return u
+}
+
+func (s *StoragesSuite) Test_Purge_RemovesUserData() {
+	purged := s.createUser("purged@mail.com")
+	kept := s.createUser("kept@mail.com")
+
+	s.Require().NoError(s.storages.Users.Delete(s.ctx, purged))
+
+	n, err := s.storages.Users.Purge(s.ctx, time.Now().Add(time.Hour), 10)
+	s.Require().NoError(err)
+	s.Equal(1, n)
+
+	_, err = s.storages.Users.Get(s.ctx, purged.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	_, err = s.storages.Tokens.GetRefreshToken(s.ctx, "hash-"+purged.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	_, err = s.storages.Tokens.GetVerificationToken(s.ctx, "hash-"+purged.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	_, err = s.storages.TwoFactors.GetTwoFactor(s.ctx, purged.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	err = s.storages.TwoFactors.UseRecoveryCode(s.ctx, purged.ID, "recovery-"+purged.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	// the data of the other users is kept
+	got, err := s.storages.Users.Get(s.ctx, kept.ID)
+	if s.NoError(err) {
+		s.Equal([]string{user.RoleAdmin}, got.Roles)
+	}
+
+	_, err = s.storages.Tokens.GetRefreshToken(s.ctx, "hash-"+kept.ID)
+	s.NoError(err)
+
+	_, err = s.storages.Tokens.GetVerificationToken(s.ctx, "hash-"+kept.ID)
+	s.NoError(err)
+
+	_, err = s.storages.TwoFactors.GetTwoFactor(s.ctx, kept.ID)
+	s.NoError(err)
+
+	err = s.storages.TwoFactors.UseRecoveryCode(s.ctx, kept.ID, "recovery-"+kept.ID)
+	s.NoError(err)
+}
+
+func (s *StoragesSuite) Test_ResetPassword() {
+	u := s.createUser("reset@mail.com")
+	other := s.createUser("other@mail.com")
+
+	// the token of another user
+	err := s.storages.Users.ResetPassword(s.ctx, u.ID, "hash-"+other.ID, "reset")
+	s.ErrorIs(err, user.ErrNotFound)
+
+	err = s.storages.Users.ResetPassword(s.ctx, "inexistent", "hash-"+u.ID, "reset")
+	s.ErrorIs(err, user.ErrNotFound)
+
+	s.Require().NoError(s.storages.Users.ResetPassword(s.ctx, u.ID, "hash-"+u.ID, "reset"))
+
+	got, err := s.storages.Users.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal("reset", got.EncodedPassword)
+		s.Equal(u.Version+1, got.Version)
+	}
+
+	vt, err := s.storages.Tokens.GetVerificationToken(s.ctx, "hash-"+u.ID)
+	if s.NoError(err) {
+		s.NotNil(vt.UsedAt)
+	}
+
+	rt, err := s.storages.Tokens.GetRefreshToken(s.ctx, "hash-"+u.ID)
+	if s.NoError(err) {
+		s.NotNil(rt.RevokedAt)
+	}
+
+	// the sessions of the other users are kept
+	rt, err = s.storages.Tokens.GetRefreshToken(s.ctx, "hash-"+other.ID)
+	if s.NoError(err) {
+		s.Nil(rt.RevokedAt)
+	}
+
+	// the token resets the password once
+	err = s.storages.Users.ResetPassword(s.ctx, u.ID, "hash-"+u.ID, "again")
+	s.ErrorIs(err, user.ErrNotFound)
+
+	got, err = s.storages.Users.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal("reset", got.EncodedPassword)
+	}
+}
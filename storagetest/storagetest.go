@@ -0,0 +1,1045 @@
+// Package storagetest provides the contract tests every user.Storage
+// implementation must pass
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// Factory returns an empty storage for each test,
+// resources should be released using t.Cleanup
+type Factory func(t *testing.T) user.Storage
+
+// Run certifies the storage created by factory against the user.Storage contract
+func Run(t *testing.T, factory Factory) {
+	suite.Run(t, &StorageSuite{factory: factory})
+}
+
+type StorageSuite struct {
+	suite.Suite
+	factory Factory
+
+	storage user.Storage
+	ctx     context.Context
+}
+
+func (s *StorageSuite) SetupTest() {
+	s.storage = s.factory(s.T())
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", s.T().Name()))
+}
+
+func (s *StorageSuite) Test_Get_NotFound() {
+	got, err := s.storage.Get(s.ctx, "inexistent")
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Create() {
+	firstName := "firstName"
+	lastname := "lastName"
+	nickName := "nickName"
+	email := "email@mail.com"
+	encoded := "234kj;salkfj"
+	country := "DE"
+
+	u := user.User{
+		FirstName:       firstName,
+		LastName:        lastname,
+		Nickname:        nickName,
+		Email:           email,
+		EncodedPassword: encoded,
+		Country:         country,
+	}
+
+	gotUser, err := s.storage.Save(s.ctx, &u)
+	if !s.NoError(err) {
+		return
+	}
+
+	s.NotEmpty(gotUser.ID)
+	s.False(gotUser.CreatedAt.IsZero())
+	s.False(gotUser.UpdatedAt.IsZero())
+	s.Equal(firstName, gotUser.FirstName)
+	s.Equal(lastname, gotUser.LastName)
+	s.Equal(nickName, gotUser.Nickname)
+	s.Equal(email, gotUser.Email)
+	s.Equal(encoded, gotUser.EncodedPassword)
+	s.Equal(country, gotUser.Country)
+
+	got, err := s.storage.Get(s.ctx, gotUser.ID)
+	if s.NoError(err) {
+		s.Equal(gotUser, got)
+	}
+}
+
+func (s *StorageSuite) Test_Create_KeepsGivenID() {
+	u, err := s.storage.Save(s.ctx, &user.User{
+		ID:              "a0a6c9a6-0bd0-4b7f-a0c5-6d1fb8e5a4b1",
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	if s.NoError(err) {
+		s.Equal("a0a6c9a6-0bd0-4b7f-a0c5-6d1fb8e5a4b1", u.ID)
+	}
+}
+
+func (s *StorageSuite) Test_Save_RequiredFields() {
+	valid := user.User{
+		FirstName:       "first name",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	}
+
+	testCases := []struct {
+		Name   string
+		Modify func(*user.User)
+	}{
+		{Name: "missing_first_name", Modify: func(u *user.User) { u.FirstName = "" }},
+		{Name: "missing_email", Modify: func(u *user.User) { u.Email = "" }},
+		{Name: "missing_encoded_password", Modify: func(u *user.User) { u.EncodedPassword = "" }},
+		{Name: "missing_country", Modify: func(u *user.User) { u.Country = "" }},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		s.Run(tc.Name, func() {
+			u := valid
+			tc.Modify(&u)
+
+			got, err := s.storage.Save(s.ctx, &u)
+			s.ErrorIs(err, user.ErrInvalid)
+			s.Nil(got)
+		})
+	}
+
+	l, err := s.storage.List(s.ctx, &user.ListOptions{})
+	if s.NoError(err) {
+		s.Zero(l.Total)
+	}
+}
+
+func (s *StorageSuite) Test_Save_DuplicatedEmail() {
+	u := user.User{
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	}
+
+	_, err := s.storage.Save(s.ctx, &u)
+	s.Require().NoError(err)
+
+	duplicated := u
+	duplicated.ID = ""
+
+	got, err := s.storage.Save(s.ctx, &duplicated)
+	s.ErrorIs(err, user.ErrAlreadyExists)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Update() {
+	originalEmail := "email@mail.com"
+	originalUser := user.User{
+		FirstName:       "firstName",
+		LastName:        "lastName",
+		Nickname:        "nickName",
+		Email:           originalEmail,
+		EncodedPassword: "encoded",
+		Country:         "BR",
+	}
+
+	createdUser, err := s.storage.Save(s.ctx, &originalUser)
+	s.Require().NoError(err)
+
+	userToUpdate := user.User{
+		ID:              createdUser.ID,
+		FirstName:       "updated firstName",
+		LastName:        "updated lastName",
+		Nickname:        "updated nickname",
+		EncodedPassword: "updated encoded",
+		Email:           "email_is_not@updated.com",
+		Country:         "DE",
+	}
+
+	gotUser, err := s.storage.Update(s.ctx, &userToUpdate)
+	if s.NoError(err) {
+		s.Equal(userToUpdate.ID, gotUser.ID)
+		s.Equal(userToUpdate.FirstName, gotUser.FirstName)
+		s.Equal(userToUpdate.LastName, gotUser.LastName)
+		s.Equal(userToUpdate.Nickname, gotUser.Nickname)
+		s.Equal(originalEmail, gotUser.Email)
+		s.Equal(userToUpdate.EncodedPassword, gotUser.EncodedPassword)
+		s.Equal(userToUpdate.Country, gotUser.Country)
+		s.True(createdUser.CreatedAt.Equal(gotUser.CreatedAt))
+		s.False(gotUser.UpdatedAt.Before(createdUser.UpdatedAt))
+	}
+
+	got, err := s.storage.Get(s.ctx, createdUser.ID)
+	if s.NoError(err) {
+		s.Equal(gotUser, got)
+	}
+}
+
+func (s *StorageSuite) Test_Update_Version() {
+	u := s.createUsers([]string{"DE"})[0]
+	s.Equal(uint64(1), u.Version)
+
+	u.FirstName = "first"
+	updated, err := s.storage.Update(s.ctx, u)
+	if s.NoError(err) {
+		s.Equal(uint64(2), updated.Version)
+	}
+
+	// u has the version before the update
+	u.FirstName = "stale"
+	got, err := s.storage.Update(s.ctx, u)
+	s.ErrorIs(err, user.ErrConflict)
+	s.Nil(got)
+
+	got, err = s.storage.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal("first", got.FirstName)
+		s.Equal(uint64(2), got.Version)
+	}
+
+	// without a version the update is unconditional
+	u.Version = 0
+	got, err = s.storage.Update(s.ctx, u)
+	if s.NoError(err) {
+		s.Equal("stale", got.FirstName)
+		s.Equal(uint64(3), got.Version)
+	}
+
+	got, err = s.storage.Update(s.ctx, &user.User{ID: "inexistent", FirstName: "first", Version: 1})
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Delete_Version() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	updated, err := s.storage.Update(s.ctx, u)
+	s.Require().NoError(err)
+
+	s.ErrorIs(s.storage.Delete(s.ctx, u), user.ErrConflict)
+
+	_, err = s.storage.Get(s.ctx, u.ID)
+	s.NoError(err)
+
+	s.NoError(s.storage.Delete(s.ctx, updated))
+}
+
+func (s *StorageSuite) Test_Writes_IncrementVersion() {
+	u := s.createUsers([]string{"DE"})[0]
+	version := u.Version
+
+	// next checks the version of the stored user was incremented by the write
+	next := func(write string) {
+		got, err := s.storage.List(s.ctx, &user.ListOptions{Email: u.Email, IncludeDeleted: true})
+		s.Require().NoError(err)
+		s.Require().Len(got.Users, 1)
+		s.Equal(version+1, got.Users[0].Version, write)
+
+		version = got.Users[0].Version
+	}
+
+	got, err := s.storage.VerifyEmail(s.ctx, u.ID, u.Email)
+	s.Require().NoError(err)
+	s.Equal(version+1, got.Version)
+	next("verify email")
+
+	got, err = s.storage.GrantRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+	s.Equal(version+1, got.Version)
+	next("grant role")
+
+	got, err = s.storage.RevokeRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+	s.Equal(version+1, got.Version)
+	next("revoke role")
+
+	s.Require().NoError(s.storage.SetPassword(s.ctx, u.ID, "rehashed"))
+	next("set password")
+
+	// the writes not changing the user keep the version
+	_, err = s.storage.RevokeRole(s.ctx, u.ID, user.RoleAdmin)
+	s.Require().NoError(err)
+	_, err = s.storage.VerifyEmail(s.ctx, u.ID, u.Email)
+	s.Require().NoError(err)
+
+	got, err = s.storage.ChangeEmail(s.ctx, u.ID, "changed@mail.com")
+	s.Require().NoError(err)
+	s.Equal(version+1, got.Version)
+	u.Email = got.Email
+	next("change email")
+
+	// a client holding the version before the change can not overwrite it
+	stale := *got
+	stale.Version = version - 1
+	_, err = s.storage.Update(s.ctx, &stale)
+	s.ErrorIs(err, user.ErrConflict)
+
+	s.Require().NoError(s.storage.Delete(s.ctx, got))
+	next("delete")
+
+	got, err = s.storage.Restore(s.ctx, u.ID)
+	s.Require().NoError(err)
+	s.Equal(version+1, got.Version)
+	next("restore")
+}
+
+func (s *StorageSuite) Test_Update_KeepsPasswordWhenEmpty() {
+	createdUser, err := s.storage.Save(s.ctx, &user.User{
+		FirstName:       "firstName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "BR",
+	})
+	s.Require().NoError(err)
+
+	createdUser.EncodedPassword = ""
+
+	gotUser, err := s.storage.Update(s.ctx, createdUser)
+	if s.NoError(err) {
+		s.Equal("encoded", gotUser.EncodedPassword)
+	}
+}
+
+func (s *StorageSuite) Test_SetPassword() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	err := s.storage.SetPassword(s.ctx, u.ID, "rehashed")
+	s.Require().NoError(err)
+
+	got, err := s.storage.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal("rehashed", got.EncodedPassword)
+		s.Equal(u.UpdatedAt, got.UpdatedAt)
+	}
+
+	err = s.storage.SetPassword(s.ctx, "inexistent", "rehashed")
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *StorageSuite) Test_VerifyEmail() {
+	u := s.createUsers([]string{"DE"})[0]
+	s.Nil(u.EmailVerifiedAt)
+
+	got, err := s.storage.VerifyEmail(s.ctx, u.ID, u.Email)
+	s.Require().NoError(err)
+	s.Require().NotNil(got.EmailVerifiedAt)
+
+	stored, err := s.storage.Get(s.ctx, u.ID)
+	s.Require().NoError(err)
+	s.Require().NotNil(stored.EmailVerifiedAt)
+	s.True(got.EmailVerifiedAt.Equal(*stored.EmailVerifiedAt))
+
+	// verifying again keeps the first verification
+	again, err := s.storage.VerifyEmail(s.ctx, u.ID, u.Email)
+	s.Require().NoError(err)
+	s.True(got.EmailVerifiedAt.Equal(*again.EmailVerifiedAt))
+}
+
+func (s *StorageSuite) Test_VerifyEmail_NotFound() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	// the email changed after the token was sent
+	_, err := s.storage.VerifyEmail(s.ctx, u.ID, "other@mail.com")
+	s.ErrorIs(err, user.ErrNotFound)
+
+	got, err := s.storage.Get(s.ctx, u.ID)
+	s.Require().NoError(err)
+	s.Nil(got.EmailVerifiedAt)
+
+	_, err = s.storage.VerifyEmail(s.ctx, "inexistent", u.Email)
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *StorageSuite) Test_ChangeEmail() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	got, err := s.storage.ChangeEmail(s.ctx, u.ID, "changed@mail.com")
+	s.Require().NoError(err)
+	s.Equal("changed@mail.com", got.Email)
+	// confirmed by the token sent to it
+	s.NotNil(got.EmailVerifiedAt)
+
+	stored, err := s.storage.Get(s.ctx, u.ID)
+	s.Require().NoError(err)
+	s.Equal(got, stored)
+
+	// changing again to the same email keeps the user
+	again, err := s.storage.ChangeEmail(s.ctx, u.ID, "changed@mail.com")
+	s.Require().NoError(err)
+	s.Equal(got, again)
+
+	_, err = s.storage.ChangeEmail(s.ctx, "inexistent", "other@mail.com")
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *StorageSuite) Test_ChangeEmail_AlreadyExists() {
+	users := s.createUsers([]string{"DE", "BR"})
+
+	_, err := s.storage.ChangeEmail(s.ctx, users[0].ID, strings.ToUpper(users[1].Email))
+	s.ErrorIs(err, user.ErrAlreadyExists)
+
+	got, err := s.storage.Get(s.ctx, users[0].ID)
+	s.Require().NoError(err)
+	s.Equal(users[0].Email, got.Email)
+}
+
+func (s *StorageSuite) Test_Update_Invalid() {
+	got, err := s.storage.Update(s.ctx, &user.User{FirstName: "no id"})
+	s.ErrorIs(err, user.ErrInvalid)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Update_NotFound() {
+	got, err := s.storage.Update(s.ctx, &user.User{ID: "inexistent", FirstName: "firstName"})
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Delete() {
+	originalUser := user.User{
+		FirstName:       "firstName",
+		LastName:        "lastName",
+		Nickname:        "nickName",
+		Email:           "email@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "BR",
+	}
+	err := s.storage.Delete(s.ctx, &originalUser)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	createdUser, err := s.storage.Save(s.ctx, &originalUser)
+	s.Require().NoError(err)
+	s.NotEmpty(createdUser.ID)
+
+	got, err := s.storage.Get(s.ctx, createdUser.ID)
+	s.NoError(err)
+	s.Equal(got.ID, createdUser.ID)
+
+	err = s.storage.Delete(s.ctx, createdUser)
+	s.NoError(err)
+
+	got, err = s.storage.Get(s.ctx, createdUser.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+
+	err = s.storage.Delete(s.ctx, createdUser)
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *StorageSuite) Test_Delete_KeepsUntilPurged() {
+	users := s.createUsers([]string{"DE", "BR"})
+
+	s.Require().NoError(s.storage.Delete(s.ctx, users[0]))
+
+	_, err := s.storage.Update(s.ctx, users[0])
+	s.ErrorIs(err, user.ErrNotFound)
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{PerPage: 10})
+	if s.NoError(err) {
+		s.Equal(users[1:], lr.Users)
+		s.Equal(uint64(1), lr.Total)
+	}
+
+	lr, err = s.storage.List(s.ctx, &user.ListOptions{PerPage: 10, IncludeDeleted: true})
+	if s.NoError(err) && s.Len(lr.Users, 2) {
+		s.Equal(users[0].ID, lr.Users[0].ID)
+		s.NotNil(lr.Users[0].DeletedAt)
+		s.Nil(lr.Users[1].DeletedAt)
+		s.Equal(uint64(2), lr.Total)
+	}
+
+}
+
+func (s *StorageSuite) Test_Delete_ReleasesEmail() {
+	users := s.createUsers([]string{"DE", "BR"})
+
+	s.Require().NoError(s.storage.Delete(s.ctx, users[0]))
+
+	// the email of the deleted user is not taken
+	created, err := s.storage.Save(s.ctx, &user.User{
+		FirstName:       "first",
+		Email:           strings.ToUpper(users[0].Email),
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.Require().NoError(err)
+
+	// the new user holds it now
+	_, err = s.storage.Save(s.ctx, &user.User{
+		FirstName:       "first",
+		Email:           users[0].Email,
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.ErrorIs(err, user.ErrAlreadyExists)
+
+	// the deleted user can not be restored while its email is taken
+	got, err := s.storage.Restore(s.ctx, users[0].ID)
+	s.ErrorIs(err, user.ErrAlreadyExists)
+	s.Nil(got)
+
+	s.Require().NoError(s.storage.Delete(s.ctx, users[1]))
+
+	changed, err := s.storage.ChangeEmail(s.ctx, created.ID, users[1].Email)
+	if s.NoError(err) {
+		s.Equal(users[1].Email, changed.Email)
+	}
+
+	got, err = s.storage.Restore(s.ctx, users[0].ID)
+	if s.NoError(err) {
+		s.Equal(users[0].Email, got.Email)
+		s.Nil(got.DeletedAt)
+	}
+}
+
+func (s *StorageSuite) Test_Restore() {
+	u := s.createUsers([]string{"DE"})[0]
+
+	got, err := s.storage.Restore(s.ctx, u.ID)
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+
+	s.Require().NoError(s.storage.Delete(s.ctx, u))
+
+	got, err = s.storage.Restore(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Equal(u.ID, got.ID)
+		s.Equal(u.Email, got.Email)
+		s.Nil(got.DeletedAt)
+	}
+
+	got, err = s.storage.Get(s.ctx, u.ID)
+	if s.NoError(err) {
+		s.Nil(got.DeletedAt)
+	}
+
+	got, err = s.storage.Restore(s.ctx, "inexistent")
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_Purge() {
+	users := s.createUsers([]string{"DE", "DE", "DE", "DE"})
+
+	for _, u := range users[:3] {
+		s.Require().NoError(s.storage.Delete(s.ctx, u))
+	}
+
+	// deleted after the given time
+	n, err := s.storage.Purge(s.ctx, time.Now().Add(-time.Hour), 10)
+	if s.NoError(err) {
+		s.Equal(0, n)
+	}
+
+	n, err = s.storage.Purge(s.ctx, time.Now().Add(time.Hour), 2)
+	if s.NoError(err) {
+		s.Equal(2, n)
+	}
+
+	n, err = s.storage.Purge(s.ctx, time.Now().Add(time.Hour), 10)
+	if s.NoError(err) {
+		s.Equal(1, n)
+	}
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{PerPage: 10, IncludeDeleted: true})
+	if s.NoError(err) {
+		s.Equal(users[3:], lr.Users)
+	}
+
+	got, err := s.storage.Restore(s.ctx, users[0].ID)
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(got)
+}
+
+func (s *StorageSuite) Test_List() {
+	users := s.createUsers([]string{
+		"DE", "UK", "DE", "BR", "UK", "UK", "ES", "PT",
+	})
+
+	testCases := []struct {
+		Name          string
+		ListOptions   *user.ListOptions
+		WantTotal     int
+		WantPageUsers []*user.User
+		WantPrevPage  *uint64
+		WantNextPage  *uint64
+	}{
+		{
+			Name:          "empty_options",
+			ListOptions:   &user.ListOptions{},
+			WantPageUsers: users[:],
+			WantTotal:     8,
+		},
+		{
+			Name:          "first_page",
+			ListOptions:   &user.ListOptions{PerPage: 2},
+			WantPageUsers: users[:2],
+			WantTotal:     8,
+			WantNextPage:  page(1),
+		},
+		{
+			Name:          "second_page",
+			ListOptions:   &user.ListOptions{PerPage: 2, Page: 1},
+			WantPageUsers: users[2:4],
+			WantPrevPage:  page(0),
+			WantTotal:     8,
+			WantNextPage:  page(2),
+		},
+		{
+			Name:          "last_page",
+			ListOptions:   &user.ListOptions{PerPage: 2, Page: 3},
+			WantPageUsers: users[6:8],
+			WantPrevPage:  page(2),
+			WantTotal:     8,
+		},
+		{
+			Name:          "exact_page_size",
+			ListOptions:   &user.ListOptions{PerPage: 8},
+			WantPageUsers: users[:],
+			WantTotal:     8,
+		},
+		{
+			Name:          "out_of_bound_page",
+			ListOptions:   &user.ListOptions{PerPage: 2, Page: 10},
+			WantPageUsers: []*user.User{},
+			WantTotal:     8,
+			WantPrevPage:  page(9),
+		},
+		{
+			Name:          "first_page_filter_by_country_uk",
+			ListOptions:   &user.ListOptions{PerPage: 2, Country: "UK"},
+			WantPageUsers: []*user.User{users[1], users[4]},
+			WantTotal:     3,
+			WantNextPage:  page(1),
+		},
+		{
+			Name:          "filter_by_unknown_country",
+			ListOptions:   &user.ListOptions{Country: "XX"},
+			WantPageUsers: []*user.User{},
+			WantTotal:     0,
+		},
+		{
+			Name:          "first_page_search",
+			ListOptions:   &user.ListOptions{PerPage: 2, Search: "u05"},
+			WantPageUsers: []*user.User{users[5]},
+			WantTotal:     1,
+		},
+		{
+			Name:          "filter_by_countries",
+			ListOptions:   &user.ListOptions{Country: "BR,UK"},
+			WantPageUsers: pick(users, 1, 3, 4, 5),
+			WantTotal:     4,
+		},
+		{
+			Name:          "filter_by_countries_ignoring_case",
+			ListOptions:   &user.ListOptions{Country: "es, pt"},
+			WantPageUsers: pick(users, 6, 7),
+			WantTotal:     2,
+		},
+		{
+			Name:          "filter_by_email",
+			ListOptions:   &user.ListOptions{Email: "U03@mail.com"},
+			WantPageUsers: pick(users, 3),
+			WantTotal:     1,
+		},
+		{
+			Name:          "filter_by_partial_email",
+			ListOptions:   &user.ListOptions{Email: "u03"},
+			WantPageUsers: []*user.User{},
+			WantTotal:     0,
+		},
+		{
+			Name:          "filter_by_nickname",
+			ListOptions:   &user.ListOptions{Nickname: "2 NICK"},
+			WantPageUsers: pick(users, 2),
+			WantTotal:     1,
+		},
+		{
+			Name:          "search_first_name",
+			ListOptions:   &user.ListOptions{Search: "6 name"},
+			WantPageUsers: pick(users, 6),
+			WantTotal:     1,
+		},
+		{
+			Name:          "search_last_name",
+			ListOptions:   &user.ListOptions{Search: "7 LAST"},
+			WantPageUsers: pick(users, 7),
+			WantTotal:     1,
+		},
+		{
+			Name:          "search_nickname",
+			ListOptions:   &user.ListOptions{Search: "4 nick"},
+			WantPageUsers: pick(users, 4),
+			WantTotal:     1,
+		},
+		{
+			Name:          "search_all_fields",
+			ListOptions:   &user.ListOptions{Search: "1", PerPage: 2},
+			WantPageUsers: pick(users, 1),
+			WantTotal:     1,
+		},
+		{
+			Name:          "search_and_country",
+			ListOptions:   &user.ListOptions{Search: "u01", Country: "DE"},
+			WantPageUsers: []*user.User{},
+			WantTotal:     0,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		s.Run(tc.Name, func() {
+			lr, err := s.storage.List(s.ctx, tc.ListOptions)
+			if s.NoError(err) {
+				s.Equal(tc.WantTotal, int(lr.Total))
+				s.Equal(tc.WantNextPage, lr.NextPage)
+				s.Equal(tc.WantPrevPage, lr.PrevPage)
+				s.Equal(tc.WantNextPage != nil, lr.NextCursor != "")
+
+				if s.Len(lr.Users, len(tc.WantPageUsers)) {
+					s.Equal(tc.WantPageUsers, lr.Users)
+				}
+			}
+		})
+	}
+}
+
+func (s *StorageSuite) Test_List_FilterByTime() {
+	users := make([]*user.User, 0)
+	for i := 0; i < 3; i++ {
+		// the users are created one at a time to have distinct timestamps
+		time.Sleep(10 * time.Millisecond)
+
+		u, err := s.storage.Save(s.ctx, &user.User{
+			FirstName:       fmt.Sprintf("%d name", i),
+			Email:           fmt.Sprintf("u%02d@mail.com", i),
+			EncodedPassword: fmt.Sprintf("encoded-%d", i),
+			Country:         "DE",
+		})
+		s.Require().NoError(err)
+
+		users = append(users, u)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	updated, err := s.storage.Update(s.ctx, users[1])
+	s.Require().NoError(err)
+
+	testCases := []struct {
+		Name        string
+		ListOptions *user.ListOptions
+		WantUsers   []*user.User
+	}{
+		{
+			Name:        "created_after",
+			ListOptions: &user.ListOptions{CreatedAfter: users[0].CreatedAt, Sort: "created_at"},
+			WantUsers:   []*user.User{updated, users[2]},
+		},
+		{
+			Name:        "created_before",
+			ListOptions: &user.ListOptions{CreatedBefore: users[2].CreatedAt, Sort: "created_at"},
+			WantUsers:   []*user.User{users[0], updated},
+		},
+		{
+			Name:        "created_between",
+			ListOptions: &user.ListOptions{CreatedAfter: users[0].CreatedAt, CreatedBefore: users[2].CreatedAt},
+			WantUsers:   []*user.User{updated},
+		},
+		{
+			Name:        "updated_since",
+			ListOptions: &user.ListOptions{UpdatedSince: updated.UpdatedAt},
+			WantUsers:   []*user.User{updated},
+		},
+		{
+			Name:        "updated_since_other_location",
+			ListOptions: &user.ListOptions{UpdatedSince: updated.UpdatedAt.In(time.FixedZone("BRT", -3*60*60))},
+			WantUsers:   []*user.User{updated},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		s.Run(tc.Name, func() {
+			lr, err := s.storage.List(s.ctx, tc.ListOptions)
+			if s.NoError(err) {
+				s.Equal(len(tc.WantUsers), int(lr.Total))
+				s.Equal(tc.WantUsers, lr.Users)
+			}
+		})
+	}
+}
+
+func (s *StorageSuite) Test_List_SearchMode() {
+	users := s.createUsers([]string{"DE", "UK", "DE", "BR"})
+
+	for _, mode := range []string{user.SearchModeNatural, user.SearchModeBoolean} {
+		lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "u03", SearchMode: mode})
+		if s.NoError(err, mode) && s.Len(lr.Users, 1, mode) {
+			s.Equal(users[3].ID, lr.Users[0].ID, mode)
+		}
+	}
+}
+
+func (s *StorageSuite) Test_List_InvalidSearchMode() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Search: "u03", SearchMode: "regexp"})
+	s.ErrorIs(err, user.ErrInvalid)
+	s.Nil(lr)
+}
+
+func (s *StorageSuite) Test_List_DefaultPerPage() {
+	s.createUsers(make([]string, user.DefaultPerPage+1))
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{})
+	if s.NoError(err) {
+		s.Equal(user.DefaultPerPage+1, int(lr.Total))
+		s.Len(lr.Users, user.DefaultPerPage)
+		s.Nil(lr.PrevPage)
+		s.Equal(page(1), lr.NextPage)
+	}
+}
+
+func (s *StorageSuite) Test_List_Cursor() {
+	users := s.createUsers([]string{
+		"DE", "UK", "DE", "BR", "UK", "UK", "ES", "PT",
+	})
+
+	got := make([]*user.User, 0)
+	opts := &user.ListOptions{PerPage: 3}
+
+	for pages := 1; ; pages++ {
+		lr, err := s.storage.List(s.ctx, opts)
+		s.Require().NoError(err)
+
+		got = append(got, lr.Users...)
+
+		if pages > 1 {
+			// the total and page numbers are not computed with cursor
+			s.Zero(lr.Total)
+			s.Nil(lr.PrevPage)
+			s.Nil(lr.NextPage)
+		}
+
+		if lr.NextCursor == "" {
+			s.Equal(3, pages)
+			break
+		}
+
+		s.Require().Less(pages, 3, "too many pages")
+		opts.Cursor = lr.NextCursor
+	}
+
+	s.Equal(users, got)
+}
+
+func (s *StorageSuite) Test_List_Cursor_Filter() {
+	users := s.createUsers([]string{
+		"DE", "UK", "DE", "BR", "UK", "UK", "ES", "PT",
+	})
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{PerPage: 2, Country: "UK"})
+	s.Require().NoError(err)
+	s.Equal([]*user.User{users[1], users[4]}, lr.Users)
+	s.Require().NotEmpty(lr.NextCursor)
+
+	lr, err = s.storage.List(s.ctx, &user.ListOptions{PerPage: 2, Country: "UK", Cursor: lr.NextCursor})
+	s.Require().NoError(err)
+	s.Equal([]*user.User{users[5]}, lr.Users)
+	s.Empty(lr.NextCursor)
+}
+
+func (s *StorageSuite) Test_List_Cursor_StableOnChanges() {
+	users := s.createUsers([]string{"DE", "DE", "DE", "DE"})
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{PerPage: 2})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(lr.NextCursor)
+
+	// removing the cursor user and adding one before it does not shift the next page
+	s.Require().NoError(s.storage.Delete(s.ctx, users[1]))
+	_, err = s.storage.Save(s.ctx, &user.User{
+		FirstName:       "first",
+		Email:           "a@mail.com",
+		EncodedPassword: "encoded",
+		Country:         "DE",
+	})
+	s.Require().NoError(err)
+
+	lr, err = s.storage.List(s.ctx, &user.ListOptions{PerPage: 2, Cursor: lr.NextCursor})
+	if s.NoError(err) {
+		s.Equal(users[2:], lr.Users)
+		s.Empty(lr.NextCursor)
+	}
+}
+
+func (s *StorageSuite) Test_List_Sort() {
+	users := s.createUsers([]string{
+		"DE", "UK", "DE", "BR", "UK", "UK", "ES", "PT",
+	})
+
+	testCases := []struct {
+		Name      string
+		Sort      string
+		WantUsers []*user.User
+	}{
+		{
+			Name:      "country",
+			Sort:      "country",
+			WantUsers: pick(users, 3, 0, 2, 6, 7, 1, 4, 5),
+		},
+		{
+			Name:      "country_desc",
+			Sort:      "-country",
+			WantUsers: pick(users, 1, 4, 5, 7, 6, 0, 2, 3),
+		},
+		{
+			Name:      "country_desc_email_desc",
+			Sort:      "-country,-email",
+			WantUsers: pick(users, 5, 4, 1, 7, 6, 2, 0, 3),
+		},
+		{
+			Name:      "last_name_desc",
+			Sort:      "-last_name",
+			WantUsers: pick(users, 7, 6, 5, 4, 3, 2, 1, 0),
+		},
+		{
+			Name:      "nickname",
+			Sort:      "nickname",
+			WantUsers: users,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		s.Run(tc.Name, func() {
+			lr, err := s.storage.List(s.ctx, &user.ListOptions{Sort: tc.Sort})
+			if s.NoError(err) {
+				s.Equal(tc.WantUsers, lr.Users)
+			}
+
+			// walking with cursor gives the same order
+			got := make([]*user.User, 0)
+			opts := &user.ListOptions{Sort: tc.Sort, PerPage: 3}
+			for {
+				lr, err := s.storage.List(s.ctx, opts)
+				s.Require().NoError(err)
+
+				got = append(got, lr.Users...)
+				if lr.NextCursor == "" {
+					break
+				}
+				opts.Cursor = lr.NextCursor
+			}
+			s.Equal(tc.WantUsers, got)
+		})
+	}
+}
+
+func (s *StorageSuite) Test_List_Sort_Time() {
+	s.createUsers([]string{"DE", "UK", "DE", "BR"})
+
+	for _, sort := range []string{"created_at", "-created_at", "-updated_at"} {
+		fields, err := user.ParseSort(sort)
+		s.Require().NoError(err)
+
+		lr, err := s.storage.List(s.ctx, &user.ListOptions{Sort: sort})
+		s.Require().NoError(err)
+		s.Require().Len(lr.Users, 4)
+
+		for i := 1; i < len(lr.Users); i++ {
+			s.LessOrEqual(fields[0].Compare(lr.Users[i-1], lr.Users[i]), 0, sort)
+		}
+
+		lr, err = s.storage.List(s.ctx, &user.ListOptions{Sort: sort, PerPage: 2})
+		s.Require().NoError(err)
+		s.Require().NotEmpty(lr.NextCursor)
+
+		next, err := s.storage.List(s.ctx, &user.ListOptions{Sort: sort, PerPage: 2, Cursor: lr.NextCursor})
+		s.Require().NoError(err)
+		s.Len(next.Users, 2)
+		s.NotContains(next.Users, lr.Users[0])
+		s.NotContains(next.Users, lr.Users[1])
+	}
+}
+
+func (s *StorageSuite) Test_List_InvalidSort() {
+	for _, sort := range []string{"password", "id", "country,country"} {
+		lr, err := s.storage.List(s.ctx, &user.ListOptions{Sort: sort})
+		s.ErrorIs(err, user.ErrInvalid, sort)
+		s.Nil(lr)
+	}
+}
+
+func (s *StorageSuite) Test_List_Cursor_OtherSort() {
+	s.createUsers([]string{"DE", "UK", "DE"})
+
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{PerPage: 1})
+	s.Require().NoError(err)
+
+	lr, err = s.storage.List(s.ctx, &user.ListOptions{PerPage: 1, Sort: "country", Cursor: lr.NextCursor})
+	s.ErrorIs(err, user.ErrInvalid)
+	s.Nil(lr)
+}
+
+func (s *StorageSuite) Test_List_InvalidCursor() {
+	lr, err := s.storage.List(s.ctx, &user.ListOptions{Cursor: "invalid"})
+	s.ErrorIs(err, user.ErrInvalid)
+	s.Nil(lr)
+}
+
+// createUsers saves one user per country, the returned users are ordered by email
+func (s *StorageSuite) createUsers(countries []string) []*user.User {
+	users := make([]*user.User, 0)
+
+	for i, country := range countries {
+		if country == "" {
+			country = "DE"
+		}
+
+		u, err := s.storage.Save(s.ctx, &user.User{
+			FirstName:       fmt.Sprintf("%d name", i),
+			LastName:        fmt.Sprintf("%d last", i),
+			Nickname:        fmt.Sprintf("%d nick", i),
+			Email:           fmt.Sprintf("u%02d@mail.com", i),
+			EncodedPassword: fmt.Sprintf("encoded-%d", i),
+			Country:         country,
+		})
+		s.Require().NoError(err)
+		s.Require().NotEmpty(u.ID)
+
+		users = append(users, u)
+	}
+
+	return users
+}
+
+func pick(users []*user.User, idx ...int) []*user.User {
+	picked := make([]*user.User, 0, len(idx))
+	for _, i := range idx {
+		picked = append(picked, users[i])
+	}
+
+	return picked
+}
+
+func page(n uint64) *uint64 {
+	return &n
+}
@@ -0,0 +1,184 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// TokenFactory returns an empty token storage for each test,
+// resources should be released using t.Cleanup
+type TokenFactory func(t *testing.T) user.TokenStorage
+
+// RunTokens certifies the storage created by factory against the user.TokenStorage contract
+func RunTokens(t *testing.T, factory TokenFactory) {
+	suite.Run(t, &TokenStorageSuite{factory: factory})
+}
+
+type TokenStorageSuite struct {
+	suite.Suite
+	factory TokenFactory
+
+	storage user.TokenStorage
+	ctx     context.Context
+}
+
+func (s *TokenStorageSuite) SetupTest() {
+	s.storage = s.factory(s.T())
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", s.T().Name()))
+}
+
+func newRefreshToken(id string) *user.RefreshToken {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	return &user.RefreshToken{
+		ID:        id,
+		UserID:    "user-" + id,
+		Hash:      "hash-" + id,
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	}
+}
+
+func (s *TokenStorageSuite) Test_GetRefreshToken_NotFound() {
+	rt, err := s.storage.GetRefreshToken(s.ctx, "unknown")
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(rt)
+}
+
+func (s *TokenStorageSuite) Test_SaveRefreshToken() {
+	want := newRefreshToken("1")
+	s.Require().NoError(s.storage.SaveRefreshToken(s.ctx, want))
+	s.Require().NoError(s.storage.SaveRefreshToken(s.ctx, newRefreshToken("2")))
+
+	got, err := s.storage.GetRefreshToken(s.ctx, want.Hash)
+	s.Require().NoError(err)
+
+	s.Equal(want.ID, got.ID)
+	s.Equal(want.UserID, got.UserID)
+	s.Equal(want.Hash, got.Hash)
+	s.True(want.ExpiresAt.Equal(got.ExpiresAt), got.ExpiresAt)
+	s.True(want.CreatedAt.Equal(got.CreatedAt), got.CreatedAt)
+	s.Nil(got.RevokedAt)
+}
+
+func (s *TokenStorageSuite) Test_RevokeRefreshToken() {
+	rt := newRefreshToken("1")
+	s.Require().NoError(s.storage.SaveRefreshToken(s.ctx, rt))
+
+	s.Require().NoError(s.storage.RevokeRefreshToken(s.ctx, rt.Hash))
+
+	got, err := s.storage.GetRefreshToken(s.ctx, rt.Hash)
+	s.Require().NoError(err)
+	s.NotNil(got.RevokedAt)
+
+	// a token is revoked only once
+	err = s.storage.RevokeRefreshToken(s.ctx, rt.Hash)
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *TokenStorageSuite) Test_RevokeRefreshToken_NotFound() {
+	err := s.storage.RevokeRefreshToken(s.ctx, "unknown")
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *TokenStorageSuite) Test_RevokeRefreshTokens() {
+	revoked := newRefreshToken("1")
+	s.Require().NoError(s.storage.SaveRefreshToken(s.ctx, revoked))
+
+	kept := newRefreshToken("2")
+	s.Require().NoError(s.storage.SaveRefreshToken(s.ctx, kept))
+
+	s.Require().NoError(s.storage.RevokeRefreshTokens(s.ctx, revoked.UserID))
+
+	got, err := s.storage.GetRefreshToken(s.ctx, revoked.Hash)
+	s.Require().NoError(err)
+	s.NotNil(got.RevokedAt)
+
+	got, err = s.storage.GetRefreshToken(s.ctx, kept.Hash)
+	s.Require().NoError(err)
+	s.Nil(got.RevokedAt)
+
+	// users without tokens are ignored
+	s.NoError(s.storage.RevokeRefreshTokens(s.ctx, "unknown"))
+}
+
+func newVerificationToken(id, purpose string) *user.VerificationToken {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	return &user.VerificationToken{
+		ID:        id,
+		UserID:    "user-" + id,
+		Purpose:   purpose,
+		Email:     id + "@mail.com",
+		Hash:      "hash-" + id,
+		ExpiresAt: now.Add(time.Hour),
+		CreatedAt: now,
+	}
+}
+
+func (s *TokenStorageSuite) Test_UseVerificationToken() {
+	want := newVerificationToken("1", user.PurposeEmailVerification)
+	s.Require().NoError(s.storage.SaveVerificationToken(s.ctx, want))
+	s.Require().NoError(s.storage.SaveVerificationToken(s.ctx, newVerificationToken("2", user.PurposeEmailVerification)))
+
+	got, err := s.storage.UseVerificationToken(s.ctx, want.Hash, want.Purpose)
+	s.Require().NoError(err)
+
+	s.Equal(want.ID, got.ID)
+	s.Equal(want.UserID, got.UserID)
+	s.Equal(want.Purpose, got.Purpose)
+	s.Equal(want.Email, got.Email)
+	s.Equal(want.Hash, got.Hash)
+	s.True(want.ExpiresAt.Equal(got.ExpiresAt), got.ExpiresAt)
+	s.True(want.CreatedAt.Equal(got.CreatedAt), got.CreatedAt)
+	s.NotNil(got.UsedAt)
+
+	// a token is used only once
+	_, err = s.storage.UseVerificationToken(s.ctx, want.Hash, want.Purpose)
+	s.ErrorIs(err, user.ErrNotFound)
+}
+
+func (s *TokenStorageSuite) Test_UseVerificationToken_NotFound() {
+	vt := newVerificationToken("1", user.PurposeEmailVerification)
+	s.Require().NoError(s.storage.SaveVerificationToken(s.ctx, vt))
+
+	_, err := s.storage.UseVerificationToken(s.ctx, "unknown", vt.Purpose)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	// a token is only used for its purpose
+	_, err = s.storage.UseVerificationToken(s.ctx, vt.Hash, "other")
+	s.ErrorIs(err, user.ErrNotFound)
+
+	_, err = s.storage.UseVerificationToken(s.ctx, vt.Hash, vt.Purpose)
+	s.NoError(err)
+}
+
+func (s *TokenStorageSuite) Test_GetVerificationToken() {
+	want := newVerificationToken("1", user.PurposePasswordReset)
+	s.Require().NoError(s.storage.SaveVerificationToken(s.ctx, want))
+
+	got, err := s.storage.GetVerificationToken(s.ctx, want.Hash)
+	s.Require().NoError(err)
+	s.Equal(want.ID, got.ID)
+	s.Equal(want.Purpose, got.Purpose)
+	s.Nil(got.UsedAt)
+
+	// getting does not use the token
+	_, err = s.storage.UseVerificationToken(s.ctx, want.Hash, want.Purpose)
+	s.Require().NoError(err)
+
+	got, err = s.storage.GetVerificationToken(s.ctx, want.Hash)
+	s.Require().NoError(err)
+	s.NotNil(got.UsedAt)
+
+	_, err = s.storage.GetVerificationToken(s.ctx, "unknown")
+	s.ErrorIs(err, user.ErrNotFound)
+}
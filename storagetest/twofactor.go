@@ -0,0 +1,158 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/pkg/xlogger"
+)
+
+// TwoFactorFactory returns an empty two-factor storage for each test,
+// resources should be released using t.Cleanup
+type TwoFactorFactory func(t *testing.T) user.TwoFactorStorage
+
+// RunTwoFactors certifies the storage created by factory against the user.TwoFactorStorage contract
+func RunTwoFactors(t *testing.T, factory TwoFactorFactory) {
+	suite.Run(t, &TwoFactorStorageSuite{factory: factory})
+}
+
+type TwoFactorStorageSuite struct {
+	suite.Suite
+	factory TwoFactorFactory
+
+	storage user.TwoFactorStorage
+	ctx     context.Context
+}
+
+func (s *TwoFactorStorageSuite) SetupTest() {
+	s.storage = s.factory(s.T())
+
+	ctx := context.Background()
+	s.ctx = xlogger.SetLogger(ctx, xlogger.New(nil).WithField("test", s.T().Name()))
+}
+
+func newTwoFactor(userID, secret string) *user.TwoFactor {
+	return &user.TwoFactor{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func (s *TwoFactorStorageSuite) Test_GetTwoFactor_NotFound() {
+	tf, err := s.storage.GetTwoFactor(s.ctx, "unknown")
+	s.ErrorIs(err, user.ErrNotFound)
+	s.Nil(tf)
+}
+
+func (s *TwoFactorStorageSuite) Test_SaveTwoFactor() {
+	want := newTwoFactor("user-1", "SECRET1")
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, want))
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, newTwoFactor("user-2", "SECRET2")))
+
+	got, err := s.storage.GetTwoFactor(s.ctx, want.UserID)
+	s.Require().NoError(err)
+	s.Equal(want.UserID, got.UserID)
+	s.Equal(want.Secret, got.Secret)
+	s.Zero(got.LastStep)
+	s.True(want.CreatedAt.Equal(got.CreatedAt), got.CreatedAt)
+	s.Nil(got.ConfirmedAt)
+
+	// a new enrollment replaces the pending one
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, newTwoFactor("user-1", "SECRET3")))
+
+	got, err = s.storage.GetTwoFactor(s.ctx, want.UserID)
+	s.Require().NoError(err)
+	s.Equal("SECRET3", got.Secret)
+}
+
+func (s *TwoFactorStorageSuite) Test_ConfirmTwoFactor() {
+	s.ErrorIs(s.storage.ConfirmTwoFactor(s.ctx, "unknown", 1, nil), user.ErrNotFound)
+
+	tf := newTwoFactor("user-1", "SECRET")
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, tf))
+
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, tf.UserID, 10, []string{"hash-1", "hash-2"}))
+
+	got, err := s.storage.GetTwoFactor(s.ctx, tf.UserID)
+	s.Require().NoError(err)
+	s.NotNil(got.ConfirmedAt)
+	s.Equal(int64(10), got.LastStep)
+
+	// only the pending enrollments are confirmed
+	s.ErrorIs(s.storage.ConfirmTwoFactor(s.ctx, tf.UserID, 11, nil), user.ErrNotFound)
+}
+
+func (s *TwoFactorStorageSuite) Test_UseTwoFactorStep() {
+	tf := newTwoFactor("user-1", "SECRET")
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, tf))
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, tf.UserID, 10, nil))
+
+	s.ErrorIs(s.storage.UseTwoFactorStep(s.ctx, tf.UserID, 10), user.ErrNotFound)
+	s.ErrorIs(s.storage.UseTwoFactorStep(s.ctx, tf.UserID, 9), user.ErrNotFound)
+	s.Require().NoError(s.storage.UseTwoFactorStep(s.ctx, tf.UserID, 11))
+	s.ErrorIs(s.storage.UseTwoFactorStep(s.ctx, tf.UserID, 11), user.ErrNotFound)
+
+	got, err := s.storage.GetTwoFactor(s.ctx, tf.UserID)
+	s.Require().NoError(err)
+	s.Equal(int64(11), got.LastStep)
+
+	s.ErrorIs(s.storage.UseTwoFactorStep(s.ctx, "unknown", 1), user.ErrNotFound)
+}
+
+func (s *TwoFactorStorageSuite) Test_UseRecoveryCode() {
+	for _, userID := range []string{"user-1", "user-2"} {
+		s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, newTwoFactor(userID, "SECRET")))
+		s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, userID, 1, []string{userID + "-hash-1", userID + "-hash-2"}))
+	}
+
+	s.Require().NoError(s.storage.UseRecoveryCode(s.ctx, "user-1", "user-1-hash-1"))
+
+	// the codes are used once, and only by their user
+	s.ErrorIs(s.storage.UseRecoveryCode(s.ctx, "user-1", "user-1-hash-1"), user.ErrNotFound)
+	s.ErrorIs(s.storage.UseRecoveryCode(s.ctx, "user-1", "user-2-hash-1"), user.ErrNotFound)
+	s.ErrorIs(s.storage.UseRecoveryCode(s.ctx, "user-1", "unknown"), user.ErrNotFound)
+
+	s.NoError(s.storage.UseRecoveryCode(s.ctx, "user-1", "user-1-hash-2"))
+	s.NoError(s.storage.UseRecoveryCode(s.ctx, "user-2", "user-2-hash-1"))
+}
+
+func (s *TwoFactorStorageSuite) Test_DeleteTwoFactor() {
+	tf := newTwoFactor("user-1", "SECRET")
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, tf))
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, tf.UserID, 1, []string{"hash-1"}))
+
+	s.Require().NoError(s.storage.DeleteTwoFactor(s.ctx, tf.UserID))
+
+	_, err := s.storage.GetTwoFactor(s.ctx, tf.UserID)
+	s.ErrorIs(err, user.ErrNotFound)
+
+	// the recovery codes are deleted as well
+	s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, tf))
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, tf.UserID, 1, nil))
+	s.ErrorIs(s.storage.UseRecoveryCode(s.ctx, tf.UserID, "hash-1"), user.ErrNotFound)
+
+	// unknown users are ignored
+	s.NoError(s.storage.DeleteTwoFactor(s.ctx, "unknown"))
+}
+
+func (s *TwoFactorStorageSuite) Test_CountTwoFactors() {
+	n, err := s.storage.CountTwoFactors(s.ctx)
+	s.Require().NoError(err)
+	s.Zero(n)
+
+	for _, id := range []string{"user-1", "user-2", "pending"} {
+		s.Require().NoError(s.storage.SaveTwoFactor(s.ctx, newTwoFactor(id, "SECRET")))
+	}
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, "user-1", 1, nil))
+	s.Require().NoError(s.storage.ConfirmTwoFactor(s.ctx, "user-2", 1, nil))
+
+	// the pending enrollments are not counted
+	n, err = s.storage.CountTwoFactors(s.ctx)
+	s.Require().NoError(err)
+	s.Equal(2, n)
+}
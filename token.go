@@ -0,0 +1,290 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/cadicallegari/user/pkg/xjwt"
+)
+
+const TokenTypeBearer = "Bearer"
+
+type TokenConfig struct {
+	Issuer          string        `envconfig:"ISSUER" default:"user"`
+	Algorithm       string        `envconfig:"ALGORITHM" default:"EdDSA"`
+	AccessTokenTTL  time.Duration `envconfig:"ACCESS_TOKEN_TTL" default:"15m"`
+	RefreshTokenTTL time.Duration `envconfig:"REFRESH_TOKEN_TTL" default:"720h"`
+	// KeyRotation is the lifetime of the generated signing keys
+	KeyRotation time.Duration `envconfig:"KEY_ROTATION" default:"24h"`
+	// KeyFiles are PEM encoded PKCS #8 private keys shared by the instances,
+	// the first signs the tokens. When empty the keys are generated in memory.
+	KeyFiles []string `envconfig:"KEY_FILES"`
+}
+
+func (cfg *TokenConfig) setDefault() {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "user"
+	}
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = xjwt.AlgorithmEdDSA
+	}
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = 30 * 24 * time.Hour
+	}
+	if cfg.KeyRotation == 0 {
+		cfg.KeyRotation = 24 * time.Hour
+	}
+}
+
+// Tokens is the response of the token endpoints, as in RFC 6749
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Claims are the claims of the access tokens, the subject is the user ID
+type Claims struct {
+	jwt.RegisteredClaims
+	Email       string   `json:"email"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+// RefreshToken is an opaque token exchanged for new tokens,
+// only its hash is stored
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	Hash      string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at" db:"revoked_at"`
+}
+
+//go:generate mockgen -package mock -mock_names TokenStorage=TokenStorage -destination mock/token.go github.com/cadicallegari/user TokenStorage
+type TokenStorage interface {
+	SaveRefreshToken(context.Context, *RefreshToken) error
+	// GetRefreshToken returns ErrNotFound for unknown hashes
+	GetRefreshToken(_ context.Context, hash string) (*RefreshToken, error)
+	// RevokeRefreshToken returns ErrNotFound when the token is unknown or
+	// already revoked, so a refresh token is exchanged only once
+	RevokeRefreshToken(_ context.Context, hash string) error
+	// RevokeRefreshTokens revokes all the refresh tokens of the user, e.g. after a password reset
+	RevokeRefreshTokens(_ context.Context, userID string) error
+
+	SaveVerificationToken(context.Context, *VerificationToken) error
+	// GetVerificationToken returns ErrNotFound for unknown hashes
+	GetVerificationToken(_ context.Context, hash string) (*VerificationToken, error)
+	// UseVerificationToken marks the token as used and returns it, it returns
+	// ErrNotFound when the token is unknown, of other purpose or already used,
+	// so a verification token is used only once
+	UseVerificationToken(_ context.Context, hash, purpose string) (*VerificationToken, error)
+}
+
+type TokenService interface {
+	// Issue returns new tokens for the authenticated user
+	Issue(context.Context, *User) (*Tokens, error)
+	// Refresh exchanges the refresh token for new tokens, revoking it
+	Refresh(_ context.Context, refreshToken string) (*Tokens, error)
+	// Revoke revokes the refresh token, unknown tokens are ignored
+	Revoke(_ context.Context, refreshToken string) error
+	// Verify returns the claims of a valid access token
+	Verify(_ context.Context, accessToken string) (*Claims, error)
+	// JWKS returns the public keys verifying the access tokens
+	JWKS() *xjwt.JWKS
+}
+
+type tokenService struct {
+	storage Storage
+	tokens  TokenStorage
+	keys    *xjwt.KeySet
+
+	cfg *TokenConfig
+}
+
+// NewTokenService creates the token issuer, the access tokens are JWTs
+// signed by the configured keys and the refresh tokens are kept in tokens
+func NewTokenService(storage Storage, tokens TokenStorage, cfg *TokenConfig) (*tokenService, error) {
+	if cfg == nil {
+		cfg = new(TokenConfig)
+	}
+	cfg.setDefault()
+
+	var (
+		keys *xjwt.KeySet
+		err  error
+	)
+
+	if len(cfg.KeyFiles) > 0 {
+		keys, err = xjwt.LoadKeySet(cfg.KeyFiles...)
+	} else {
+		// the previous keys are kept until the tokens they signed expire
+		keys, err = xjwt.NewRotatingKeySet(cfg.Algorithm, cfg.KeyRotation, cfg.AccessTokenTTL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenService{
+		storage: storage,
+		tokens:  tokens,
+		keys:    keys,
+		cfg:     cfg,
+	}, nil
+}
+
+// hashToken returns the stored form of the refresh token, a fast hash
+// is enough because the tokens are long random strings
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// permissions returns the permissions of the user roles
+func (s *tokenService) permissions(ctx context.Context, usr *User) ([]string, error) {
+	if len(usr.Roles) == 0 {
+		return []string{}, nil
+	}
+
+	roles, err := s.storage.Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return Permissions(roles, usr.Roles), nil
+}
+
+func (s *tokenService) Issue(ctx context.Context, usr *User) (*Tokens, error) {
+	now := TimeNow()
+
+	permissions, err := s.permissions(ctx, usr)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := s.keys.Sign(&Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    s.cfg.Issuer,
+			Subject:   usr.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.AccessTokenTTL)),
+		},
+		Email:       usr.Email,
+		Roles:       usr.Roles,
+		Permissions: permissions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tokens.SaveRefreshToken(ctx, &RefreshToken{
+		ID:        uuid.NewString(),
+		UserID:    usr.ID,
+		Hash:      hashToken(refresh),
+		ExpiresAt: now.Add(s.cfg.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{
+		AccessToken:  access,
+		TokenType:    TokenTypeBearer,
+		ExpiresIn:    int64(s.cfg.AccessTokenTTL.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+func (s *tokenService) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	hash := hashToken(refreshToken)
+
+	rt, err := s.tokens.GetRefreshToken(ctx, hash)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rt.RevokedAt != nil || !TimeNow().Before(rt.ExpiresAt) {
+		return nil, ErrInvalidCredentials
+	}
+
+	// revoked first, a concurrent refresh with the same token fails
+	err = s.tokens.RevokeRefreshToken(ctx, hash)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usr, err := s.storage.Get(ctx, rt.UserID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Issue(ctx, usr)
+}
+
+func (s *tokenService) Revoke(ctx context.Context, refreshToken string) error {
+	err := s.tokens.RevokeRefreshToken(ctx, hashToken(refreshToken))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *tokenService) Verify(_ context.Context, accessToken string) (*Claims, error) {
+	var claims Claims
+
+	err := s.keys.Parse(accessToken, &claims,
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(TimeNow),
+	)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &claims, nil
+}
+
+func (s *tokenService) JWKS() *xjwt.JWKS {
+	return s.keys.JWKS()
+}
@@ -0,0 +1,218 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+func newTokenService(t *testing.T, storage user.Storage, tokens user.TokenStorage) user.TokenService {
+	svc, err := user.NewTokenService(storage, tokens, &user.TokenConfig{Issuer: "test"})
+	require.NoError(t, err)
+
+	return svc
+}
+
+func Test_Token_IssueAndVerify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Email: "email@mail.com"}
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		SaveRefreshToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, rt *user.RefreshToken) error {
+			require.Equal(t, usr.ID, rt.UserID)
+			require.NotEmpty(t, rt.Hash)
+			require.True(t, rt.ExpiresAt.After(rt.CreatedAt))
+			return nil
+		})
+
+	svc := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+
+	tokens, err := svc.Issue(context.TODO(), usr)
+	require.NoError(t, err)
+	require.Equal(t, user.TokenTypeBearer, tokens.TokenType)
+	require.Equal(t, int64(15*60), tokens.ExpiresIn)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	claims, err := svc.Verify(context.TODO(), tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, usr.ID, claims.Subject)
+	require.Equal(t, usr.Email, claims.Email)
+	require.Equal(t, "test", claims.Issuer)
+
+	require.Len(t, svc.JWKS().Keys, 1)
+}
+
+func Test_Token_Roles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Roles: []string{user.RoleSupport}}
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().Roles(gomock.Any()).Return(user.DefaultRoles, nil)
+
+	svc := newTokenService(t, mockStorage, mockTokens)
+
+	tokens, err := svc.Issue(context.TODO(), usr)
+	require.NoError(t, err)
+
+	claims, err := svc.Verify(context.TODO(), tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, []string{user.RoleSupport}, claims.Roles)
+	require.Equal(t, []string{user.PermissionUsersRead}, claims.Permissions)
+}
+
+func Test_Token_Verify_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().SaveRefreshToken(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	svc := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+	other := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+
+	tokens, err := svc.Issue(context.TODO(), &user.User{ID: "id"})
+	require.NoError(t, err)
+
+	otherTokens, err := other.Issue(context.TODO(), &user.User{ID: "id"})
+	require.NoError(t, err)
+
+	for name, token := range map[string]string{
+		"garbage":   "garbage",
+		"tampered":  tokens.AccessToken + "x",
+		"other_key": otherTokens.AccessToken,
+	} {
+		claims, err := svc.Verify(context.TODO(), token)
+		require.ErrorIs(t, err, user.ErrInvalidCredentials, name)
+		require.Nil(t, claims, name)
+	}
+
+	defer func(now func() time.Time) { user.TimeNow = now }(user.TimeNow)
+	user.TimeNow = func() time.Time { return time.Now().UTC().Add(time.Hour) }
+
+	claims, err := svc.Verify(context.TODO(), tokens.AccessToken)
+	require.ErrorIs(t, err, user.ErrInvalidCredentials, "expired")
+	require.Nil(t, claims)
+}
+
+func Test_Token_Refresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	usr := &user.User{ID: "id", Email: "email@mail.com"}
+
+	saved := make([]*user.RefreshToken, 0)
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		SaveRefreshToken(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, rt *user.RefreshToken) error {
+			saved = append(saved, rt)
+			return nil
+		}).
+		Times(2)
+
+	mockStorage := mock.NewStorage(ctrl)
+
+	svc := newTokenService(t, mockStorage, mockTokens)
+
+	tokens, err := svc.Issue(context.TODO(), usr)
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+
+	mockTokens.EXPECT().
+		GetRefreshToken(gomock.Any(), saved[0].Hash).
+		Return(saved[0], nil)
+
+	mockTokens.EXPECT().
+		RevokeRefreshToken(gomock.Any(), saved[0].Hash).
+		Return(nil)
+
+	mockStorage.EXPECT().
+		Get(gomock.Any(), usr.ID).
+		Return(usr, nil)
+
+	refreshed, err := svc.Refresh(context.TODO(), tokens.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	require.Len(t, saved, 2)
+
+	claims, err := svc.Verify(context.TODO(), refreshed.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, usr.ID, claims.Subject)
+}
+
+func Test_Token_Refresh_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	revokedAt := time.Now()
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		GetRefreshToken(gomock.Any(), gomock.Any()).
+		Return(nil, user.ErrNotFound)
+	mockTokens.EXPECT().
+		GetRefreshToken(gomock.Any(), gomock.Any()).
+		Return(&user.RefreshToken{UserID: "id", ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}, nil)
+	mockTokens.EXPECT().
+		GetRefreshToken(gomock.Any(), gomock.Any()).
+		Return(&user.RefreshToken{UserID: "id", ExpiresAt: time.Now().Add(-time.Second)}, nil)
+
+	svc := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+
+	for _, name := range []string{"unknown", "revoked", "expired"} {
+		tokens, err := svc.Refresh(context.TODO(), "refresh-token")
+		require.ErrorIs(t, err, user.ErrInvalidCredentials, name)
+		require.Nil(t, tokens, name)
+	}
+}
+
+func Test_Token_Refresh_ConcurrentUse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		GetRefreshToken(gomock.Any(), gomock.Any()).
+		Return(&user.RefreshToken{UserID: "id", ExpiresAt: time.Now().Add(time.Hour)}, nil)
+
+	// revoked by another request after it was read
+	mockTokens.EXPECT().
+		RevokeRefreshToken(gomock.Any(), gomock.Any()).
+		Return(user.ErrNotFound)
+
+	svc := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+
+	tokens, err := svc.Refresh(context.TODO(), "refresh-token")
+	require.ErrorIs(t, err, user.ErrInvalidCredentials)
+	require.Nil(t, tokens)
+}
+
+func Test_Token_Revoke_Unknown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokens := mock.NewTokenStorage(ctrl)
+	mockTokens.EXPECT().
+		RevokeRefreshToken(gomock.Any(), gomock.Any()).
+		Return(user.ErrNotFound)
+
+	svc := newTokenService(t, mock.NewStorage(ctrl), mockTokens)
+
+	require.NoError(t, svc.Revoke(context.TODO(), "unknown"))
+}
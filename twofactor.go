@@ -0,0 +1,258 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cadicallegari/user/pkg/xtotp"
+)
+
+// ErrTwoFactorRequired is returned by Authenticate when the user has two-factor
+// authentication enabled and no code was given, the password was right
+var ErrTwoFactorRequired = errors.New("two factor required")
+
+type TwoFactorConfig struct {
+	// Issuer names the accounts in the authenticator apps
+	Issuer        string `envconfig:"ISSUER" default:"user"`
+	RecoveryCodes int    `envconfig:"RECOVERY_CODES" default:"10"`
+	// EncryptionKey is the base64 encoded AES-256 key encrypting
+	// the secrets in the SQL storages
+	EncryptionKey string `envconfig:"ENCRYPTION_KEY"`
+}
+
+func (cfg *TwoFactorConfig) setDefault() {
+	if cfg.Issuer == "" {
+		cfg.Issuer = "user"
+	}
+	if cfg.RecoveryCodes == 0 {
+		cfg.RecoveryCodes = 10
+	}
+}
+
+// TwoFactor is the TOTP enrollment of a user, it is enabled once confirmed
+type TwoFactor struct {
+	UserID string `json:"user_id" db:"user_id"`
+	// Secret is the base32 TOTP secret, the SQL storages keep it encrypted
+	Secret string `json:"-" db:"secret"`
+	// LastStep is the time step of the last code used, so each code is used once
+	LastStep    int64      `json:"-" db:"last_step"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at" db:"confirmed_at"`
+}
+
+// TwoFactorEnrollment is shown to the user once, to add the account to an authenticator app
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth URI of the secret, usually shown as a QR code
+	URI string `json:"uri"`
+}
+
+type TwoFactorStorage interface {
+	// SaveTwoFactor saves a pending enrollment, replacing the previous one of the user
+	SaveTwoFactor(context.Context, *TwoFactor) error
+	// GetTwoFactor returns ErrNotFound when the user is not enrolled
+	GetTwoFactor(_ context.Context, userID string) (*TwoFactor, error)
+	// ConfirmTwoFactor enables the pending enrollment of the user, recording the step of
+	// the confirmation code and replacing the recovery codes by the hashes. It returns
+	// ErrNotFound when there is no pending enrollment
+	ConfirmTwoFactor(_ context.Context, userID string, step int64, recoveryHashes []string) error
+	// UseTwoFactorStep records the step of a code used by the user, it returns
+	// ErrNotFound when the step is not after the last one, so a code is used once
+	UseTwoFactorStep(_ context.Context, userID string, step int64) error
+	// UseRecoveryCode marks the recovery code as used, it returns
+	// ErrNotFound when the code is unknown or already used
+	UseRecoveryCode(_ context.Context, userID, hash string) error
+	// DeleteTwoFactor removes the enrollment and the recovery codes of the user,
+	// unknown users are ignored
+	DeleteTwoFactor(_ context.Context, userID string) error
+	// CountTwoFactors returns how many users have the two-factor enabled,
+	// the pending enrollments are not counted
+	CountTwoFactors(context.Context) (int, error)
+}
+
+// TwoFactorService manages the TOTP two-factor authentication of the users
+type TwoFactorService interface {
+	// Enroll generates a new secret for the user, replacing a pending enrollment,
+	// it returns ErrAlreadyExists when the two-factor is already enabled
+	Enroll(context.Context, *User) (*TwoFactorEnrollment, error)
+	// Confirm enables the two-factor with a first code of the enrolled secret, returning
+	// the recovery codes, they are only shown once. It returns ErrNotFound when there is
+	// no pending enrollment and ErrInvalid for wrong codes
+	Confirm(_ context.Context, _ *User, code string) ([]string, error)
+	// Enabled reports if the user has a confirmed enrollment
+	Enabled(context.Context, *User) (bool, error)
+	// Verify checks the TOTP or recovery code of the users with the two-factor enabled,
+	// it returns ErrTwoFactorRequired for empty codes and ErrInvalidCredentials for wrong
+	// or already used codes. The users without two-factor are always verified
+	Verify(_ context.Context, _ *User, code string) error
+	// Reset disables the two-factor of the user, e.g. after losing the device and the recovery codes
+	Reset(context.Context, *User) error
+}
+
+type twoFactorService struct {
+	storage TwoFactorStorage
+
+	cfg *TwoFactorConfig
+}
+
+func NewTwoFactorService(storage TwoFactorStorage, cfg *TwoFactorConfig) *twoFactorService {
+	if cfg == nil {
+		cfg = new(TwoFactorConfig)
+	}
+	cfg.setDefault()
+
+	return &twoFactorService{
+		storage: storage,
+		cfg:     cfg,
+	}
+}
+
+func (s *twoFactorService) Enroll(ctx context.Context, usr *User) (*TwoFactorEnrollment, error) {
+	tf, err := s.storage.GetTwoFactor(ctx, usr.ID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	if tf != nil && tf.ConfirmedAt != nil {
+		return nil, ErrAlreadyExists
+	}
+
+	secret, err := xtotp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.storage.SaveTwoFactor(ctx, &TwoFactor{
+		UserID:    usr.ID,
+		Secret:    secret,
+		CreatedAt: TimeNow(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    xtotp.URI(s.cfg.Issuer, usr.Email, secret),
+	}, nil
+}
+
+func (s *twoFactorService) Confirm(ctx context.Context, usr *User, code string) ([]string, error) {
+	tf, err := s.storage.GetTwoFactor(ctx, usr.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if tf.ConfirmedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	step, ok := xtotp.Validate(tf.Secret, code, TimeNow())
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	codes := make([]string, s.cfg.RecoveryCodes)
+	hashes := make([]string, s.cfg.RecoveryCodes)
+
+	for i := range codes {
+		codes[i], err = recoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	err = s.storage.ConfirmTwoFactor(ctx, usr.ID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *twoFactorService) Enabled(ctx context.Context, usr *User) (bool, error) {
+	tf, err := s.storage.GetTwoFactor(ctx, usr.ID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return tf.ConfirmedAt != nil, nil
+}
+
+func (s *twoFactorService) Verify(ctx context.Context, usr *User, code string) error {
+	tf, err := s.storage.GetTwoFactor(ctx, usr.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if tf.ConfirmedAt == nil {
+		return nil
+	}
+
+	if code == "" {
+		return ErrTwoFactorRequired
+	}
+
+	if step, ok := xtotp.Validate(tf.Secret, code, TimeNow()); ok {
+		err = s.storage.UseTwoFactorStep(ctx, usr.ID, step)
+	} else {
+		err = s.storage.UseRecoveryCode(ctx, usr.ID, hashToken(normalizeRecoveryCode(code)))
+	}
+	if errors.Is(err, ErrNotFound) {
+		return ErrInvalidCredentials
+	}
+
+	return err
+}
+
+func (s *twoFactorService) Reset(ctx context.Context, usr *User) error {
+	return s.storage.DeleteTwoFactor(ctx, usr.ID)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCode returns a random code of 80 bits, as xxxx-xxxx-xxxx-xxxx,
+// a fast hash is enough to store it as for the tokens
+func recoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	s := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// normalizeRecoveryCode ignores the case and the separators typed by the user
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+type twoFactorCodeKey struct{}
+
+// WithTwoFactorCode returns a copy of ctx with the TOTP or recovery
+// code given along the password to Authenticate
+func WithTwoFactorCode(ctx context.Context, code string) context.Context {
+	return context.WithValue(ctx, twoFactorCodeKey{}, code)
+}
+
+// TwoFactorCode returns the code set by WithTwoFactorCode
+func TwoFactorCode(ctx context.Context) string {
+	code, _ := ctx.Value(twoFactorCodeKey{}).(string)
+	return code
+}
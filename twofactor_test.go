@@ -0,0 +1,168 @@
+package user_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mem"
+	"github.com/cadicallegari/user/mock"
+	"github.com/cadicallegari/user/pkg/xtotp"
+)
+
+// enroll returns the secret of a confirmed enrollment of usr and its recovery codes
+func enroll(t *testing.T, svc user.TwoFactorService, usr *user.User) (string, []string) {
+	enrollment, err := svc.Enroll(context.TODO(), usr)
+	require.NoError(t, err)
+
+	code, err := xtotp.Code(enrollment.Secret, xtotp.Step(user.TimeNow())-1)
+	require.NoError(t, err)
+
+	codes, err := svc.Confirm(context.TODO(), usr, code)
+	require.NoError(t, err)
+
+	return enrollment.Secret, codes
+}
+
+func Test_TwoFactor_Enroll(t *testing.T) {
+	ctx := context.TODO()
+	svc := user.NewTwoFactorService(mem.NewTwoFactorStorage(), &user.TwoFactorConfig{Issuer: "acme"})
+
+	usr := &user.User{ID: "id", Email: "email@mail.com"}
+
+	enabled, err := svc.Enabled(ctx, usr)
+	require.NoError(t, err)
+	require.False(t, enabled)
+
+	_, err = svc.Confirm(ctx, usr, "123456")
+	require.ErrorIs(t, err, user.ErrNotFound)
+
+	enrollment, err := svc.Enroll(ctx, usr)
+	require.NoError(t, err)
+
+	uri, err := url.Parse(enrollment.URI)
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", uri.Scheme)
+	require.Equal(t, "/acme:email@mail.com", uri.Path)
+	require.Equal(t, enrollment.Secret, uri.Query().Get("secret"))
+
+	// the pending enrollments are not enforced
+	require.NoError(t, svc.Verify(ctx, usr, ""))
+
+	_, err = svc.Confirm(ctx, usr, "000000")
+	require.ErrorIs(t, err, user.ErrInvalid)
+
+	code, err := xtotp.Code(enrollment.Secret, xtotp.Step(user.TimeNow()))
+	require.NoError(t, err)
+
+	codes, err := svc.Confirm(ctx, usr, code)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	enabled, err = svc.Enabled(ctx, usr)
+	require.NoError(t, err)
+	require.True(t, enabled)
+
+	_, err = svc.Enroll(ctx, usr)
+	require.ErrorIs(t, err, user.ErrAlreadyExists)
+
+	_, err = svc.Confirm(ctx, usr, code)
+	require.ErrorIs(t, err, user.ErrNotFound)
+
+	require.NoError(t, svc.Reset(ctx, usr))
+
+	enabled, err = svc.Enabled(ctx, usr)
+	require.NoError(t, err)
+	require.False(t, enabled)
+}
+
+func Test_TwoFactor_Verify(t *testing.T) {
+	ctx := context.TODO()
+	svc := user.NewTwoFactorService(mem.NewTwoFactorStorage(), nil)
+
+	usr := &user.User{ID: "id", Email: "email@mail.com"}
+
+	// the users without two-factor are verified
+	require.NoError(t, svc.Verify(ctx, usr, ""))
+
+	secret, codes := enroll(t, svc, usr)
+
+	require.ErrorIs(t, svc.Verify(ctx, usr, ""), user.ErrTwoFactorRequired)
+	require.ErrorIs(t, svc.Verify(ctx, usr, "000000"), user.ErrInvalidCredentials)
+
+	code, err := xtotp.Code(secret, xtotp.Step(user.TimeNow()))
+	require.NoError(t, err)
+
+	// the codes are used once, and the previous steps are not accepted after it
+	require.NoError(t, svc.Verify(ctx, usr, code))
+	require.ErrorIs(t, svc.Verify(ctx, usr, code), user.ErrInvalidCredentials)
+
+	// the recovery codes ignore the case and the separators
+	require.NoError(t, svc.Verify(ctx, usr, strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+	require.ErrorIs(t, svc.Verify(ctx, usr, codes[0]), user.ErrInvalidCredentials)
+	require.NoError(t, svc.Verify(ctx, usr, codes[1]))
+}
+
+func Test_Authenticate_TwoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	now := time.Now().UTC()
+
+	defer func(now func() time.Time) { user.TimeNow = now }(user.TimeNow)
+	user.TimeNow = func() time.Time { return now }
+
+	encoded, err := bcrypt.GenerateFromPassword([]byte("passwd"), 4)
+	require.NoError(t, err)
+
+	usr := &user.User{ID: "id", Email: "email", EncodedPassword: string(encoded)}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: usr.Email}).
+		Return(&user.List{Total: 1, Users: []*user.User{usr}}, nil).
+		Times(5)
+
+	mockStorage.EXPECT().
+		AddEvent(gomock.Any(), user.EventUserLoggedIn, usr).
+		Return(nil)
+
+	twoFactorSvc := user.NewTwoFactorService(mem.NewTwoFactorStorage(), nil)
+	secret, _ := enroll(t, twoFactorSvc, usr)
+
+	lockout := user.NewLockout(mem.NewAttemptStorage(), &user.LockoutConfig{MaxFailures: 2})
+	svc := user.NewService(mockStorage, 4, user.WithLockout(lockout), user.WithTwoFactor(twoFactorSvc))
+
+	_, err = svc.Authenticate(context.TODO(), usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrTwoFactorRequired)
+
+	// the wrong codes count as failed logins
+	_, err = svc.Authenticate(user.WithTwoFactorCode(context.TODO(), "000000"), usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrInvalidCredentials)
+
+	// a step after the confirmation code
+	now = now.Add(xtotp.Period)
+	code, err := xtotp.Code(secret, xtotp.Step(now))
+	require.NoError(t, err)
+
+	gotUser, err := svc.Authenticate(user.WithTwoFactorCode(context.TODO(), code), usr.Email, "passwd")
+	require.NoError(t, err)
+	require.Equal(t, usr.ID, gotUser.ID)
+
+	_, err = svc.Authenticate(user.WithTwoFactorCode(context.TODO(), "000000"), usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrInvalidCredentials)
+
+	// the successful login reset the failures, the lockout needs two more
+	_, err = svc.Authenticate(user.WithTwoFactorCode(context.TODO(), "000000"), usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrInvalidCredentials)
+
+	_, err = svc.Authenticate(user.WithTwoFactorCode(context.TODO(), code), usr.Email, "passwd")
+	require.ErrorIs(t, err, user.ErrLocked)
+}
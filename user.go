@@ -2,7 +2,9 @@ package user
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -14,6 +16,10 @@ var (
 	ErrNotFound      = errors.New("not_found")
 	ErrInvalid       = errors.New("invalid")
 	ErrAlreadyExists = errors.New("already exists")
+	// ErrConflict is returned when the user was changed since the given Version
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidCredentials is returned for unknown emails and wrong passwords alike
+	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
 type User struct {
@@ -27,15 +33,75 @@ type User struct {
 	Country         string    `json:"country"`
 	CreatedAt       time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+	// EmailVerifiedAt is set when the user confirms the email, see AccountService
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	// DeletedAt is set by Delete, the deleted users are kept until purged
+	// and can be restored meanwhile
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Version is incremented by each Update, a non zero Version makes
+	// Update and Delete fail with ErrConflict when the user was changed since
+	Version uint64 `json:"version" db:"version"`
+	// Roles are loaded by the Storage, they are changed only
+	// by GrantRole and RevokeRole
+	Roles []string `json:"roles" db:"-"`
+
+	// Score is the relevance of the user in a full text search,
+	// it is only set in the List results when a SearchMode is used
+	Score float64 `json:"score,omitempty" db:"score"`
+}
+
+const (
+	// SearchModeNatural and SearchModeBoolean are the full text search modes,
+	// the users are ranked by relevance. The storages without full text
+	// support fall back to the substring search.
+	SearchModeNatural = "natural"
+	SearchModeBoolean = "boolean"
+)
+
+// ValidSearchMode reports if mode is empty, the substring search, or one of the full text modes
+func ValidSearchMode(mode string) bool {
+	return mode == "" || mode == SearchModeNatural || mode == SearchModeBoolean
 }
 
 type ListOptions struct {
 	Page    uint64 `schema:"page"`
 	PerPage uint64 `schema:"per_page"`
+	// Cursor is the next_cursor of a previous List, when set Page is
+	// ignored and the Total is not computed
+	Cursor string `schema:"cursor"`
+	// Sort is a comma separated list of fields, prefixed with - for
+	// descending order, the users are ordered by email by default
+	Sort string `schema:"sort"`
 
+	// Country is a comma separated list of countries, e.g. BR,US
 	Country string `schema:"country"`
-	// Search is used for text search in the email field for now
+	// Search is used for text search in the first name, last name, nickname and email fields
 	Search string `schema:"search"`
+	// SearchMode selects a relevance ranked full text Search, by default
+	// the Search matches any part of the fields
+	SearchMode string `schema:"search_mode"`
+	// Email and Nickname are exact matches, ignoring case
+	Email    string `schema:"email"`
+	Nickname string `schema:"nickname"`
+
+	CreatedAfter  time.Time `schema:"created_after"`
+	CreatedBefore time.Time `schema:"created_before"`
+	UpdatedSince  time.Time `schema:"updated_since"`
+
+	// IncludeDeleted lists the deleted users not purged yet along the others
+	IncludeDeleted bool `schema:"include_deleted"`
+}
+
+// Countries returns the countries of the Country filter
+func (opts *ListOptions) Countries() []string {
+	countries := make([]string, 0)
+	for _, c := range strings.Split(opts.Country, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			countries = append(countries, c)
+		}
+	}
+
+	return countries
 }
 
 func NewListOptions() *ListOptions {
@@ -45,10 +111,11 @@ func NewListOptions() *ListOptions {
 }
 
 type List struct {
-	Users    []*User `json:"users"`
-	Total    uint64  `json:"total"`
-	PrevPage *uint64 `json:"prev_page"`
-	NextPage *uint64 `json:"next_page"`
+	Users      []*User `json:"users"`
+	Total      uint64  `json:"total"`
+	PrevPage   *uint64 `json:"prev_page"`
+	NextPage   *uint64 `json:"next_page"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 type Service interface {
@@ -56,7 +123,28 @@ type Service interface {
 	List(context.Context, *ListOptions) (*List, error)
 	Save(context.Context, *User) (*User, error)
 	Update(context.Context, *User) (*User, error)
+	// Patch updates only the fields set in the patch, it returns ErrInvalid when
+	// the patched user is not valid, e.g. without the first name
+	Patch(_ context.Context, id string, _ *Patch) (*User, error)
+	// Delete soft deletes the user, it is purged after the retention period
 	Delete(context.Context, *User) error
+	// Restore undeletes the user not purged yet, it returns ErrNotFound
+	// for unknown users and the users not deleted, and ErrAlreadyExists
+	// when another user took the email meanwhile
+	Restore(_ context.Context, id string) (*User, error)
+	// Authenticate returns the user with the given email and password, it returns
+	// a LockedError while the account or the client IP is locked, and
+	// ErrTwoFactorRequired when the two-factor code is missing
+	Authenticate(_ context.Context, email, password string) (*User, error)
+	// Unlock forgets the failed logins locking the account of the user
+	Unlock(context.Context, *User) error
+	// EncodePassword checks the new password of the user against the
+	// password policy, returning its encoded hash
+	EncodePassword(_ context.Context, usr *User, password string) (string, error)
+
+	Roles(context.Context) ([]*Role, error)
+	GrantRole(_ context.Context, usr *User, role string) (*User, error)
+	RevokeRole(_ context.Context, usr *User, role string) (*User, error)
 }
 
 //go:generate mockgen -package mock -mock_names Storage=Storage -destination mock/storage.go github.com/cadicallegari/user Storage
@@ -64,8 +152,47 @@ type Storage interface {
 	Get(_ context.Context, id string) (*User, error)
 	List(context.Context, *ListOptions) (*List, error)
 	Save(context.Context, *User) (*User, error)
+	// Update does not change the email, it is changed by ChangeEmail, it returns
+	// ErrConflict when the Version of the user is not zero nor the current one
 	Update(context.Context, *User) (*User, error)
+	// Delete sets the DeletedAt of the user, the deleted users are not returned
+	// by Get and List, unless IncludeDeleted, and are not changed by the other methods.
+	// Their emails are released, Save and ChangeEmail may give them to other users.
+	// As Update, it returns ErrConflict for a Version not current
 	Delete(context.Context, *User) error
+	// Restore clears the DeletedAt of the user, it returns ErrNotFound
+	// for unknown users and the users not deleted, and ErrAlreadyExists
+	// when another active user has its email
+	Restore(_ context.Context, userID string) (*User, error)
+	// Purge removes up to limit users deleted before the given time, recording
+	// an EventUserPurged for each, it returns the number of users removed
+	Purge(_ context.Context, deletedBefore time.Time, limit int) (int, error)
+	// SetPassword replaces the encoded password of the user, without changing
+	// its updated_at, it returns ErrNotFound for unknown users
+	SetPassword(_ context.Context, userID, encodedPassword string) error
+	// ResetPassword sets the password as SetPassword, marking the password reset token
+	// of the hash as used and revoking the refresh tokens of the user in the same
+	// transaction. It returns ErrNotFound for unknown users and for tokens unknown,
+	// already used or of another user, so a token resets the password once
+	ResetPassword(_ context.Context, userID, tokenHash, encodedPassword string) error
+	// AddEvent records in the outbox an event not caused by a change
+	// in the storage, e.g. a login
+	AddEvent(_ context.Context, typ string, _ *User) error
+
+	// Roles returns the roles with their permissions
+	Roles(context.Context) ([]*Role, error)
+	// GrantRole adds the role to the user, it returns ErrNotFound for
+	// unknown users and ErrInvalid for unknown roles
+	GrantRole(_ context.Context, userID, role string) (*User, error)
+	// RevokeRole removes the role from the user, it returns ErrNotFound for unknown users
+	RevokeRole(_ context.Context, userID, role string) (*User, error)
+
+	// VerifyEmail sets the EmailVerifiedAt of the user, it returns ErrNotFound
+	// for unknown users and when the email of the user is not email anymore
+	VerifyEmail(_ context.Context, userID, email string) (*User, error)
+	// ChangeEmail replaces the email of the user by the confirmed email, it returns
+	// ErrNotFound for unknown users and ErrAlreadyExists when the email is taken
+	ChangeEmail(_ context.Context, userID, email string) (*User, error)
 }
 
 //go:generate mockgen -package mock -mock_names EventService=EventService -destination mock/event.go github.com/cadicallegari/user EventService
@@ -73,4 +200,79 @@ type EventService interface {
 	UserCreated(context.Context, *User) error
 	UserUpdated(context.Context, *User) error
 	UserDeleted(context.Context, *User) error
+	UserRestored(context.Context, *User) error
+	UserPurged(context.Context, *User) error
+	UserLoggedIn(context.Context, *User) error
+	UserEmailVerified(context.Context, *User) error
+	UserEmailChanged(context.Context, *EmailChange) error
+}
+
+const (
+	EventUserCreated  = "user.created"
+	EventUserUpdated  = "user.updated"
+	EventUserDeleted  = "user.deleted"
+	EventUserLoggedIn = "user.logged_in"
+
+	EventUserRestored = "user.restored"
+	// EventUserPurged is recorded when a deleted user is removed for good
+	EventUserPurged = "user.purged"
+
+	EventUserEmailVerified = "user.email_verified"
+	EventUserEmailChanged  = "user.email_changed"
+)
+
+// EmailChange is the payload of the EventUserEmailChanged events, the user has the new email
+type EmailChange struct {
+	*User
+	OldEmail string `json:"old_email"`
+	NewEmail string `json:"new_email"`
+}
+
+// Event is a state change recorded in the outbox by the Storage
+// in the same transaction as the change itself
+type Event struct {
+	ID            uint64          `json:"id"`
+	Type          string          `json:"type"`
+	UserID        string          `json:"user_id" db:"user_id"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int             `json:"attempts"`
+	CreatedAt     time.Time       `json:"created_at" db:"created_at"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+}
+
+func NewEvent(typ string, usr *User) (*Event, error) {
+	return newEvent(typ, usr.ID, usr)
+}
+
+// NewEmailChangedEvent returns the EventUserEmailChanged event of the user with the new email
+func NewEmailChangedEvent(usr *User, oldEmail string) (*Event, error) {
+	return newEvent(EventUserEmailChanged, usr.ID, &EmailChange{
+		User:     usr,
+		OldEmail: oldEmail,
+		NewEmail: usr.Email,
+	})
+}
+
+func newEvent(typ, userID string, payload interface{}) (*Event, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Type:    typ,
+		UserID:  userID,
+		Payload: b,
+	}, nil
+}
+
+//go:generate mockgen -package mock -mock_names Outbox=Outbox -destination mock/outbox.go github.com/cadicallegari/user Outbox
+type Outbox interface {
+	// Fetch returns up to limit events ready to be published, only the
+	// oldest pending event of each user is returned to keep the ordering
+	Fetch(_ context.Context, limit int) ([]*Event, error)
+	// Ack removes the event from the outbox after it has been published
+	Ack(context.Context, *Event) error
+	// Retry schedules the event to be published again at the given time
+	Retry(_ context.Context, _ *Event, next time.Time) error
 }
@@ -0,0 +1,189 @@
+package user
+
+import (
+	"bufio"
+	_ "embed"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// The codes of the FieldError, the password fields have
+// the rules broken of the PasswordPolicy instead
+const (
+	FieldRequired = "required"
+	FieldFormat   = "format"
+	FieldLength   = "length"
+	FieldEnum     = "enum"
+)
+
+// maxFieldLength is the size of the text columns of the users
+const maxFieldLength = 100
+
+var countryRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// countriesTable has the ISO 3166-1 alpha-2 codes, one per line followed by the name
+//
+//go:embed countries.txt
+var countriesTable string
+
+// countries are the codes accepted as the country of the users
+var countries = parseCountries(countriesTable)
+
+func parseCountries(table string) map[string]bool {
+	codes := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(table))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		code, _, _ := strings.Cut(line, "\t")
+		codes[code] = true
+	}
+
+	return codes
+}
+
+// FieldError is the problem of one field
+type FieldError struct {
+	Field string `json:"field"`
+	Code  string `json:"code"`
+	// Detail explains the problem, e.g. the max length
+	Detail string `json:"detail,omitempty"`
+}
+
+// ValidationError lists the invalid fields, it is an ErrInvalid
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		problems = append(problems, f.Field+" "+f.Code)
+	}
+
+	return "invalid fields: " + strings.Join(problems, ", ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+// Add records the problem of the field
+func (e *ValidationError) Add(field, code, detail string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Detail: detail})
+}
+
+// Required records the field when it is empty
+func (e *ValidationError) Required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		e.Add(field, FieldRequired, "")
+	}
+}
+
+// MaxLength records the field longer than max characters
+func (e *ValidationError) MaxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		e.Add(field, FieldLength, "at most "+strconv.Itoa(max)+" characters")
+	}
+}
+
+// Printable records the field with control characters, e.g. line breaks
+func (e *ValidationError) Printable(field, value string) {
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		e.Add(field, FieldFormat, "no control characters")
+	}
+}
+
+// Err returns the ValidationError when a problem was recorded, nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// normalizeEmail trims and lower-cases the email, so the
+// same address is stored and looked up in the same form
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeText trims the names and composes their characters (NFC), so the
+// same name typed in different ways is stored, compared and measured the same
+func normalizeText(s string) string {
+	return norm.NFC.String(strings.TrimSpace(s))
+}
+
+// normalizeCountry trims and upper-cases the country code
+func normalizeCountry(country string) string {
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// normalizeUser puts the fields given by the clients in the form they are stored,
+// it runs before validateUser on both creation and updates, the patches
+// normalize only their fields
+func normalizeUser(u *User) {
+	u.FirstName = normalizeText(u.FirstName)
+	u.LastName = normalizeText(u.LastName)
+	u.Nickname = normalizeText(u.Nickname)
+	u.Country = normalizeCountry(u.Country)
+	u.Email = normalizeEmail(u.Email)
+}
+
+// validateEmail records the email out of the RFC 5322 addr-spec syntax,
+// the display names and comments, e.g. "Alice <alice@mail.com>", are rejected
+func validateEmail(verr *ValidationError, email string) {
+	if email == "" {
+		verr.Add("email", FieldRequired, "")
+	} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		verr.Add("email", FieldFormat, "")
+	}
+	verr.MaxLength("email", email, maxFieldLength)
+}
+
+// validateUser checks the normalized fields given by the clients, the email and
+// password are checked only on creation, they are not changed by the updates
+func validateUser(u *User, create bool) error {
+	verr := new(ValidationError)
+
+	verr.Required("first_name", u.FirstName)
+	for _, f := range []struct {
+		name, value string
+	}{
+		{"first_name", u.FirstName},
+		{"last_name", u.LastName},
+		{"nickname", u.Nickname},
+	} {
+		verr.MaxLength(f.name, f.value, maxFieldLength)
+		verr.Printable(f.name, f.value)
+	}
+
+	if u.Country == "" {
+		verr.Add("country", FieldRequired, "")
+	} else if !countryRe.MatchString(u.Country) {
+		verr.Add("country", FieldFormat, "two letters country code, e.g. BR")
+	} else if !countries[u.Country] {
+		verr.Add("country", FieldEnum, "ISO 3166-1 alpha-2 country code")
+	}
+
+	if create {
+		validateEmail(verr, u.Email)
+
+		if u.EncodedPassword == "" {
+			verr.Required("password", u.Password)
+		}
+	}
+
+	return verr.Err()
+}
@@ -0,0 +1,217 @@
+package user_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cadicallegari/user"
+	"github.com/cadicallegari/user/mock"
+)
+
+func Test_ValidationError(t *testing.T) {
+	verr := new(user.ValidationError)
+	require.NoError(t, verr.Err())
+
+	verr.Required("first_name", " ")
+	verr.Required("country", "DE")
+	verr.MaxLength("nickname", strings.Repeat("á", 10), 10)
+	verr.MaxLength("last_name", strings.Repeat("a", 11), 10)
+
+	err := verr.Err()
+	require.ErrorIs(t, err, user.ErrInvalid)
+	require.EqualError(t, err, "invalid fields: first_name required, last_name length")
+	require.Equal(t, []user.FieldError{
+		{Field: "first_name", Code: user.FieldRequired},
+		{Field: "last_name", Code: user.FieldLength, Detail: "at most 10 characters"},
+	}, verr.Fields)
+}
+
+func Test_Create_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := user.NewService(mock.NewStorage(ctrl), 4)
+
+	tests := []struct {
+		name string
+		usr  *user.User
+		want []user.FieldError
+	}{
+		{
+			name: "empty",
+			usr:  &user.User{},
+			want: []user.FieldError{
+				{Field: "first_name", Code: user.FieldRequired},
+				{Field: "country", Code: user.FieldRequired},
+				{Field: "email", Code: user.FieldRequired},
+				{Field: "password", Code: user.FieldRequired},
+			},
+		},
+		{
+			name: "format",
+			usr: &user.User{
+				FirstName: "first",
+				Country:   "Brazil",
+				Email:     "First <email@mail.com>",
+				Password:  "correct horse",
+			},
+			want: []user.FieldError{
+				{Field: "country", Code: user.FieldFormat, Detail: "two letters country code, e.g. BR"},
+				{Field: "email", Code: user.FieldFormat},
+			},
+		},
+		{
+			name: "unknown country",
+			usr: &user.User{
+				FirstName: "first",
+				Country:   "XX",
+				Email:     "email@mail.com",
+				Password:  "correct horse",
+			},
+			want: []user.FieldError{
+				{Field: "country", Code: user.FieldEnum, Detail: "ISO 3166-1 alpha-2 country code"},
+			},
+		},
+		{
+			name: "control characters",
+			usr: &user.User{
+				FirstName: "first\nline",
+				LastName:  "last\x00",
+				Country:   "BR",
+				Email:     "email@mail.com",
+				Password:  "correct horse",
+			},
+			want: []user.FieldError{
+				{Field: "first_name", Code: user.FieldFormat, Detail: "no control characters"},
+				{Field: "last_name", Code: user.FieldFormat, Detail: "no control characters"},
+			},
+		},
+		{
+			name: "length",
+			usr: &user.User{
+				FirstName: strings.Repeat("a", 101),
+				Nickname:  strings.Repeat("a", 101),
+				Country:   "BR",
+				Email:     strings.Repeat("a", 92) + "@mail.com",
+				Password:  "correct horse",
+			},
+			want: []user.FieldError{
+				{Field: "first_name", Code: user.FieldLength, Detail: "at most 100 characters"},
+				{Field: "nickname", Code: user.FieldLength, Detail: "at most 100 characters"},
+				{Field: "email", Code: user.FieldLength, Detail: "at most 100 characters"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// rejected before reaching the storage
+			_, err := svc.Save(context.TODO(), tt.usr)
+
+			var verr *user.ValidationError
+			require.True(t, errors.As(err, &verr))
+			require.Equal(t, tt.want, verr.Fields)
+		})
+	}
+}
+
+func Test_Create_Normalizes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the decomposed "e" followed by the combining acute accent
+	usr := &user.User{
+		FirstName: " Jose\u0301 ",
+		LastName:  "Mu\u0308ller",
+		Nickname:  "\tnick",
+		Password:  "correct horse",
+		Email:     " Email@Mail.COM",
+		Country:   "br",
+	}
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), &user.ListOptions{Email: "email@mail.com"}).
+		Return(&user.List{}, nil)
+	mockStorage.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *user.User) (*user.User, error) {
+			return u, nil
+		})
+
+	svc := user.NewService(mockStorage, 4)
+
+	got, err := svc.Save(context.TODO(), usr)
+	require.NoError(t, err)
+	require.Equal(t, "Jos\u00e9", got.FirstName)
+	require.Equal(t, "M\u00fcller", got.LastName)
+	require.Equal(t, "nick", got.Nickname)
+	require.Equal(t, "email@mail.com", got.Email)
+	require.Equal(t, "BR", got.Country)
+}
+
+func Test_Create_LengthAfterNormalization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		List(gomock.Any(), gomock.Any()).
+		Return(&user.List{}, nil)
+	mockStorage.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, u *user.User) (*user.User, error) {
+			return u, nil
+		})
+
+	svc := user.NewService(mockStorage, 4)
+
+	// 200 code points decomposed, 100 characters composed
+	_, err := svc.Save(context.TODO(), &user.User{
+		FirstName: strings.Repeat("e\u0301", 100),
+		Password:  "correct horse",
+		Email:     "email@mail.com",
+		Country:   "BR",
+	})
+	require.NoError(t, err)
+}
+
+func Test_Update_Invalid(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	svc := user.NewService(mock.NewStorage(ctrl), 4)
+
+	// the email is not changed by the updates, it is not checked
+	_, err := svc.Update(context.TODO(), &user.User{ID: "id", FirstName: "first"})
+
+	var verr *user.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, []user.FieldError{{Field: "country", Code: user.FieldRequired}}, verr.Fields)
+
+	_, err = svc.Update(context.TODO(), &user.User{ID: "id", FirstName: "first", Country: "ZZ"})
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, []user.FieldError{{Field: "country", Code: user.FieldEnum, Detail: "ISO 3166-1 alpha-2 country code"}}, verr.Fields)
+}
+
+func Test_Update_Normalizes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mock.NewStorage(ctrl)
+	mockStorage.EXPECT().
+		Update(gomock.Any(), &user.User{ID: "id", FirstName: "first", Country: "DE"}).
+		DoAndReturn(func(_ context.Context, u *user.User) (*user.User, error) {
+			return u, nil
+		})
+
+	svc := user.NewService(mockStorage, 4)
+
+	_, err := svc.Update(context.TODO(), &user.User{ID: "id", FirstName: "first ", Country: " de"})
+	require.NoError(t, err)
+}